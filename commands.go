@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bihe/mydms/features/documents"
+	"github.com/bihe/mydms/internal/config"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/schema"
+)
+
+// commands are executed instead of the API server, if the first argument
+// of the application is the name of the command: mydms.api <command> [options]
+var commands = map[string]func(args []string) error{
+	"migrate":       migrateCommand,
+	"migrate-files": migrateFilesCommand,
+	"verify":        verifyCommand,
+}
+
+// runCommand executes a command if requested by the arguments
+// the return value indicates if a command was found
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false, nil
+	}
+	return true, cmd(args[1:])
+}
+
+// commandArgs splits the arguments into the action and the options of a command
+// the action can be supplied either before or after the options
+func commandArgs(fs *flag.FlagSet, args []string, defaultAction string) (string, error) {
+	action := defaultAction
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action = args[0]
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		action = fs.Arg(0)
+	}
+	return action, nil
+}
+
+// migrateCommand applies, reverts or lists the schema migrations of the database
+func migrateCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configFile := fs.String("c", "application.json", "path to the application config file")
+	steps := fs.Int("steps", 0, "number of migrations to apply (default: all) or revert (default: 1)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s migrate [up|down|status] [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	action, err := commandArgs(fs, args, "up")
+	if err != nil {
+		return err
+	}
+
+	c := configFromFile(*configFile)
+	con := persistence.NewConn(c.DB.Driver, c.DB.ConnStr)
+	defer con.Close()
+
+	m, err := persistence.NewMigrator(con, schema.Migrations)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		applied, err := m.Up(*steps)
+		for _, mig := range applied {
+			fmt.Printf("applied migration %d: %s\n", mig.Version, mig.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("the database schema is up to date")
+		}
+	case "down":
+		if *steps <= 0 {
+			*steps = 1
+		}
+		reverted, err := m.Down(*steps)
+		for _, mig := range reverted {
+			fmt.Printf("reverted migration %d: %s\n", mig.Version, mig.Description)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-19s  %s\n", s.Version, applied, s.Description)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate action '%s'", action)
+	}
+	return nil
+}
+
+// verifyCommand checks the stored files of the documents and writes a JSON report
+// the command fails if a problem was found
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configFile := fs.String("c", "application.json", "path to the application config file")
+	checksums := fs.Bool("checksums", false, "compare the SHA-256 of the files with the hash of the documents")
+	output := fs.String("o", "", "path of the report (default: stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s verify [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c := configFromFile(*configFile)
+	con := persistence.NewConn(c.DB.Driver, c.DB.ConnStr)
+	defer con.Close()
+
+	dr, err := documents.NewRepository(con)
+	if err != nil {
+		return err
+	}
+	store, err := newFileService(c.Store)
+	if err != nil {
+		return err
+	}
+	report, err := documents.NewVerifier(documents.Repositories{DocRepo: dr}, store).Verify(*checksums)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("found %d missing, %d changed and %d orphaned files", len(report.Missing), len(report.Changed), len(report.Orphans))
+	}
+	return nil
+}
+
+// migrateFilesCommand copies the files of the documents from the source to the target filestore
+// the copied files are recorded in a journal, a failed or interrupted migration is resumed by starting it again
+func migrateFilesCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate-files", flag.ExitOnError)
+	configFile := fs.String("c", "application.json", "path to the application config file")
+	sourceFile := fs.String("source", "", "path to the config of the source filestore (default: the filestore of the application config)")
+	targetFile := fs.String("target", "", "path to the config of the target filestore")
+	journal := fs.String("journal", "migrate-files.journal", "path of the journal of the copied files")
+	rewrite := fs.String("rewrite", "", "regular expression to change the paths of the files in the target filestore")
+	replace := fs.String("replace", "", "replacement of the rewrite expression, can reference groups, e.g. $1")
+	rename := fs.Bool("rename", false, "update the documents with the rewritten paths once all files are copied, the application needs to be stopped")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s migrate-files -target <config> [options]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *targetFile == "" {
+		fs.Usage()
+		return fmt.Errorf("no target filestore supplied")
+	}
+
+	c := configFromFile(*configFile)
+	con := persistence.NewConn(c.DB.Driver, c.DB.ConnStr)
+	defer con.Close()
+
+	dr, err := documents.NewRepository(con)
+	if err != nil {
+		return err
+	}
+	sourceConfig := c.Store
+	if *sourceFile != "" {
+		if sourceConfig, err = fileStoreFromFile(*sourceFile); err != nil {
+			return err
+		}
+	}
+	source, err := newFileService(sourceConfig)
+	if err != nil {
+		return err
+	}
+	targetConfig, err := fileStoreFromFile(*targetFile)
+	if err != nil {
+		return err
+	}
+	target, err := newFileService(targetConfig)
+	if err != nil {
+		return err
+	}
+
+	options := documents.TransferOptions{
+		Journal: *journal,
+		Rename:  *rename,
+		Progress: func(p documents.TransferProgress) {
+			switch {
+			case p.Err != nil:
+				fmt.Fprintf(os.Stderr, "[%d/%d] failed %s: %v\n", p.Current, p.Total, p.FileName, p.Err)
+			case p.Skipped:
+				fmt.Printf("[%d/%d] skipped %s\n", p.Current, p.Total, p.FileName)
+			default:
+				fmt.Printf("[%d/%d] copied %s -> %s (%d bytes)\n", p.Current, p.Total, p.FileName, p.Target, p.Size)
+			}
+		},
+	}
+	if *rewrite != "" {
+		if options.Rewrite, err = documents.PathRewrite(*rewrite, *replace); err != nil {
+			return err
+		}
+	}
+	result, err := documents.NewTransfer(documents.Repositories{DocRepo: dr}, source, target, options).Run()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("copied %d of %d files (%d bytes), %d skipped, %d renamed\n", result.Copied, result.Total, result.Bytes, result.Skipped, result.Renamed)
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("could not migrate %d files, start the migration again to retry them", len(result.Failed))
+	}
+	if *rewrite != "" && !*rename {
+		fmt.Println("the paths of the documents are not changed, start the migration again with -rename to update them")
+	}
+	return nil
+}
+
+// fileStoreFromFile reads the config of a filestore, the file has the form of the "filestore" section of the application config
+func fileStoreFromFile(fileName string) (config.FileStore, error) {
+	var c config.FileStore
+	f, err := os.Open(fileName)
+	if err != nil {
+		return c, fmt.Errorf("could not open the filestore config '%s': %v", fileName, err)
+	}
+	defer f.Close()
+	if err = json.NewDecoder(f).Decode(&c); err != nil {
+		return c, fmt.Errorf("could not read the filestore config '%s': %v", fileName, err)
+	}
+	return c, nil
+}
+
+// migrateDatabase applies all pending schema migrations
+func migrateDatabase(con persistence.Connection) error {
+	m, err := persistence.NewMigrator(con, schema.Migrations)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(0)
+	return err
+}
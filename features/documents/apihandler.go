@@ -2,13 +2,14 @@ package documents
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,6 +18,7 @@ import (
 	"github.com/bihe/mydms/features/filestore"
 	"github.com/bihe/mydms/features/upload"
 	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/pdf"
 	"github.com/bihe/mydms/internal/persistence"
 	"github.com/labstack/echo/v4"
 	"github.com/microcosm-cc/bluemonday"
@@ -24,6 +26,7 @@ import (
 )
 
 const jsonTimeLayout = "2006-01-02T15:04:05+07:00"
+const pdfMimeType = "application/pdf"
 
 // --------------------------------------------------------------------------
 // JSON models
@@ -43,6 +46,8 @@ type Document struct {
 	Tags          []string `json:"tags"`
 	Senders       []string `json:"senders"`
 	InvoiceNumber string   `json:"invoiceNumber,omitempty"`
+	// Deleted is the time the document was moved to the trash
+	Deleted string `json:"deleted,omitempty"`
 }
 
 // PagedDcoument represents a paged result
@@ -125,6 +130,20 @@ func (a *ActionResult) UnmarshalJSON(b []byte) error {
 type Result struct {
 	Message string       `json:"message"`
 	Result  ActionResult `json:"result"`
+	// Duplicates links to existing documents with the same file
+	Duplicates []string `json:"duplicates,omitempty"`
+}
+
+// DuplicateGroup lists the documents with the same file
+type DuplicateGroup struct {
+	Hash      string     `json:"hash"`
+	Documents []Document `json:"documents"`
+}
+
+// Duplicates lists all groups of documents with the same file
+type Duplicates struct {
+	Groups       []DuplicateGroup `json:"groups"`
+	TotalEntries int              `json:"totalEntries"`
 }
 
 // --------------------------------------------------------------------------
@@ -135,7 +154,6 @@ type Result struct {
 type Handler struct {
 	docRepo    Repository
 	uploadRepo upload.Repository
-	r          Repositories
 	fs         filestore.FileService
 	uc         upload.Config
 	policy     *bluemonday.Policy
@@ -184,12 +202,14 @@ func (h *Handler) GetDocumentByID(c echo.Context) error {
 
 // DeleteDocumentByID godoc
 // @Summary delete a document by id
-// @Description use the supplied id to delete the document from the store
+// @Description use the supplied id to move the document to the trash
+// @Description the document is deleted permanently when it is purged from the trash
 // @Tags documents
 // @Param id path string true "document ID"
 // @Success 200 {object} documents.Result
 // @Failure 401 {object} errors.ProblemDetail
 // @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
 // @Failure 500 {object} errors.ProblemDetail
 // @Router /api/v1/documents/{id} [delete]
 func (h *Handler) DeleteDocumentByID(c echo.Context) (err error) {
@@ -205,30 +225,21 @@ func (h *Handler) DeleteDocumentByID(c echo.Context) (err error) {
 		err = persistence.HandleTX(true, &atomic, err)
 	}()
 
-	fileName, err := h.docRepo.Exists(id, atomic)
-	if err != nil {
+	if _, err = h.docRepo.Exists(id, atomic); err != nil {
 		log.Warnf("the document '%s' is not available, %v", id, err)
 		err = fmt.Errorf("document '%s' not available", id)
 		return errors.NotFoundError{Err: err, Request: c.Request()}
 	}
 
-	err = h.docRepo.Delete(id, atomic)
+	err = h.docRepo.Trash(id, atomic)
 	if err != nil {
 		log.Warnf("error during delete operation of '%s', %v", id, err)
 		err = fmt.Errorf("could not delete '%s', %v", id, err)
 		return errors.ServerError{Err: err, Request: c.Request()}
 	}
 
-	// also remove the file payload stored in the backend store
-	err = h.fs.DeleteFile(fileName)
-	if err != nil {
-		log.Errorf("could not delete file in backend store '%s', %v", fileName, err)
-		err = fmt.Errorf("could not delete '%s', %v", id, err)
-		return errors.ServerError{Err: err, Request: c.Request()}
-	}
-
 	return c.JSON(http.StatusOK, Result{
-		Message: fmt.Sprintf("Document with id '%s' was deleted.", id),
+		Message: fmt.Sprintf("Document with id '%s' was moved to the trash.", id),
 		Result:  Deleted,
 	})
 }
@@ -237,6 +248,7 @@ func (h *Handler) DeleteDocumentByID(c echo.Context) (err error) {
 // @Summary search for documents
 // @Description use filters to search for docments. the result is a paged set
 // @Tags documents
+// @Param q query string false "full-text search: terms are combined with AND, use OR for alternatives and quotes for phrases"
 // @Param title query string false "title search"
 // @Param tag query string false "tag search"
 // @Param sender query string false "sender search"
@@ -251,6 +263,7 @@ func (h *Handler) DeleteDocumentByID(c echo.Context) (err error) {
 // @Router /api/v1/documents/search [get]
 func (h *Handler) SearchDocuments(c echo.Context) (err error) {
 	var (
+		query     string
 		title     string
 		tag       string
 		sender    string
@@ -261,6 +274,7 @@ func (h *Handler) SearchDocuments(c echo.Context) (err error) {
 		order     []OrderBy
 	)
 
+	query = c.QueryParam("q")
 	title = c.QueryParam("title")
 	tag = c.QueryParam("tag")
 	sender = c.QueryParam("sender")
@@ -274,6 +288,7 @@ func (h *Handler) SearchDocuments(c echo.Context) (err error) {
 	orderByCreated := OrderBy{Field: "created", Order: DESC}
 
 	docs, err := h.docRepo.Search(DocSearch{
+		Query:  query,
 		Title:  title,
 		Tag:    tag,
 		Sender: sender,
@@ -310,16 +325,6 @@ func (h *Handler) SearchDocuments(c echo.Context) (err error) {
 // @Failure 500 {object} errors.ProblemDetail
 // @Router /api/v1/documents [post]
 func (h *Handler) SaveDocument(c echo.Context) (err error) {
-	atomic, err := h.startAtomic(c)
-	if err != nil {
-		return
-	}
-
-	// complete the atomic method
-	defer func() {
-		err = persistence.HandleTX(true, &atomic, err)
-	}()
-
 	d := new(Document)
 	if err = c.Bind(d); err != nil {
 		log.Warnf("could not bind supplied payload, %v", err)
@@ -329,39 +334,70 @@ func (h *Handler) SaveDocument(c echo.Context) (err error) {
 
 	d = sanitize(h.policy, d)
 
-	d.FileName, err = h.procssUploadFile(d.UploadToken, d.FileName, atomic)
+	// the upload and the existing document are read before the transaction is started, a SQLite database only provides a single connection
+	u, err := h.readUpload(d.UploadToken)
 	if err != nil {
-		log.Warnf("could not process the uploaded file, %v", err)
+		log.Warnf("could not read the uploaded file, %v", err)
 		err = fmt.Errorf("upload-file error: %v", err)
 		return errors.ServerError{Err: err, Request: c.Request()}
 	}
-
-	tagList := strings.Join(d.Tags, ";")
-	senderList := strings.Join(d.Senders, ";")
-
 	var doc DocumentEntity
 	newDoc := true
-	if d.ID == "" {
-		doc = initDocument(d, senderList, tagList)
-	} else {
+	if d.ID != "" {
 		// supplied ID needs to be checked if exists
-		doc, err = h.docRepo.Get(d.ID)
-		if err != nil {
+		if doc, err = h.docRepo.Get(d.ID); err != nil {
 			log.Warnf("cannot find document by ID '%s' - create a new entry, %v", d.ID, err)
-			doc = initDocument(d, senderList, tagList)
 		} else {
 			newDoc = false
-			log.Infof("will update existing document ID '%s'", d.ID)
-			doc.Title = d.Title
-			doc.FileName = d.FileName
-			doc.PreviewLink = sql.NullString{String: base64.StdEncoding.EncodeToString([]byte(d.FileName)), Valid: true}
-			doc.Amount = d.Amount
-			doc.SenderList = senderList
-			doc.TagList = tagList
-			doc.InvoiceNumber = sql.NullString{String: d.InvoiceNumber, Valid: true}
 		}
 	}
 
+	atomic, err := h.startAtomic(c)
+	if err != nil {
+		return
+	}
+
+	// complete the atomic method, the stored file is deleted again if the document was not saved
+	var file storedFile
+	defer func() {
+		err = persistence.HandleTX(true, &atomic, err)
+		h.completeUpload(file, err)
+	}()
+
+	file, err = h.procssUploadFile(d.UploadToken, u, d.FileName, d.ID, atomic)
+	if err != nil {
+		log.Warnf("could not process the uploaded file, %v", err)
+		if dup, ok := err.(duplicateError); ok {
+			return errors.ConflictError{Err: dup, Request: c.Request(), URL: documentLink(c, dup.duplicates[0].ID)}
+		}
+		err = fmt.Errorf("upload-file error: %v", err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+	d.FileName = file.path
+
+	tagList := strings.Join(d.Tags, ";")
+	senderList := strings.Join(d.Senders, ";")
+
+	if newDoc {
+		doc = initDocument(d, senderList, tagList)
+	} else {
+		log.Infof("will update existing document ID '%s'", d.ID)
+		doc.Title = d.Title
+		doc.FileName = d.FileName
+		doc.PreviewLink = sql.NullString{String: base64.StdEncoding.EncodeToString([]byte(d.FileName)), Valid: true}
+		doc.Amount = d.Amount
+		doc.SenderList = senderList
+		doc.TagList = tagList
+		doc.InvoiceNumber = sql.NullString{String: d.InvoiceNumber, Valid: true}
+	}
+
+	if file.content.Valid {
+		doc.Content = file.content
+	}
+	if file.hash.Valid {
+		doc.Hash = file.hash
+	}
+
 	doc, err = h.docRepo.Save(doc, atomic)
 	if err != nil {
 		log.Errorf("could not save document: %v", err)
@@ -384,10 +420,46 @@ func (h *Handler) SaveDocument(c echo.Context) (err error) {
 		}
 		code = http.StatusOK
 	}
+	if len(file.duplicates) > 0 {
+		r.Message += fmt.Sprintf(" - the file is already stored by %d document(s)", len(file.duplicates))
+		for _, dup := range file.duplicates {
+			r.Duplicates = append(r.Duplicates, documentLink(c, dup.ID))
+		}
+	}
 	c.JSON(code, r)
 	return
 }
 
+// GetDuplicates godoc
+// @Summary get duplicate documents
+// @Description lists the groups of documents which store the same file, based on the SHA-256 hash of the file
+// @Tags documents
+// @Produce  json
+// @Success 200 {object} documents.Duplicates
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/documents/duplicates [get]
+func (h *Handler) GetDuplicates(c echo.Context) error {
+	docs, err := h.docRepo.Duplicates()
+	if err != nil {
+		log.Warnf("could not get duplicate documents, %v", err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+
+	result := Duplicates{Groups: make([]DuplicateGroup, 0)}
+	for _, d := range docs {
+		n := len(result.Groups)
+		if n == 0 || result.Groups[n-1].Hash != d.Hash.String {
+			result.Groups = append(result.Groups, DuplicateGroup{Hash: d.Hash.String})
+			n++
+		}
+		result.Groups[n-1].Documents = append(result.Groups[n-1].Documents, convert(h.policy, d))
+	}
+	result.TotalEntries = len(result.Groups)
+	return c.JSON(http.StatusOK, result)
+}
+
 // SearchList godoc
 // @Summary search for tags/senders
 // @Description search either by tags or senders with the supplied search term
@@ -435,32 +507,104 @@ func (h *Handler) SearchList(c echo.Context) (err error) {
 // helpers and internal functions
 // --------------------------------------------------------------------------
 
-func (h *Handler) procssUploadFile(token, fileName string, atomic persistence.Atomic) (string, error) {
-	if token == "" || token == "-" {
-		return fileName, nil
+// storedFile describes an upload-file which was saved in the filestore
+type storedFile struct {
+	path string
+	// content is the text layer of a PDF file, it is valid if an upload was processed
+	content sql.NullString
+	// hash is the SHA-256 of the file, it is valid if an upload was processed
+	hash sql.NullString
+	// duplicates are the existing documents with the same file
+	duplicates []DocumentEntity
+	// upload is the upload-file of the stored file, it is removed when the document was saved
+	upload string
+}
+
+// duplicateError indicates that the uploaded file is already stored by existing documents
+type duplicateError struct {
+	duplicates []DocumentEntity
+}
+
+func (e duplicateError) Error() string {
+	var ids []string
+	for _, d := range e.duplicates {
+		ids = append(ids, d.ID)
 	}
+	return fmt.Sprintf("the file is already stored by document(s) '%s'", strings.Join(ids, "', '"))
+}
 
+// readUpload returns the upload identified by the token, an empty upload is returned if no token is supplied
+func (h *Handler) readUpload(token string) (upload.Upload, error) {
+	if token == "" || token == "-" {
+		return upload.Upload{}, nil
+	}
 	u, err := h.uploadRepo.Read(token)
 	if err != nil {
 		log.Errorf("could not read upload-file for token '%s', %v", token, err)
-		return "", fmt.Errorf("upload token error: %v", err)
+		return upload.Upload{}, fmt.Errorf("upload token error: %v", err)
+	}
+	return u, nil
+}
+
+// procssUploadFile stores the uploaded file identified by the token in the filestore
+// the document id is used to ignore the document itself when checking for duplicates
+func (h *Handler) procssUploadFile(token string, u upload.Upload, fileName, id string, atomic persistence.Atomic) (storedFile, error) {
+	if token == "" || token == "-" {
+		return storedFile{path: fileName}, nil
 	}
 
 	log.Infof("use uploaded file identified by token '%s'", token)
 
+	file, err := h.storeUploadFile(u, uploadFileName(fileName, u), id, atomic)
+	if err != nil {
+		return storedFile{}, err
+	}
+	err = h.uploadRepo.Delete(token, atomic)
+	if err != nil {
+		// this error is ignored, does not invalidate the overall operation
+		log.Errorf("could not delete the upload-item by id '%s', %v", token, err)
+	}
+	return file, nil
+}
+
+// storeUploadFile saves the upload-file in the filestore using the given file name
+// the file is not saved if it is already stored by other documents and duplicates are rejected
+// the upload-file is kept until the document is saved, see completeUpload
+func (h *Handler) storeUploadFile(u upload.Upload, fileName, id string, atomic persistence.Atomic) (storedFile, error) {
+	var file storedFile
 	now := time.Now().UTC()
 	folder := now.Format("2006_01_02")
 
-	ext := filepath.Ext(fileName)
-	uploadFile := filepath.Join(h.uc.UploadPath, token+ext)
+	// the upload-file is named by the upload, the extension can differ in case from the file name of the document
+	uploadFile := filepath.Join(h.uc.UploadPath, u.ID+filepath.Ext(u.FileName))
 	payload, err := ioutil.ReadFile(uploadFile)
 	if err != nil {
 		log.Errorf("could not read upload file '%s', %v", uploadFile, err)
-		return "", fmt.Errorf("error reading upload-file: %v", err)
+		return file, fmt.Errorf("error reading upload-file: %v", err)
 	}
 
 	log.Debugf("got upload file '%s' with payload size '%d'!", uploadFile, len(payload))
 
+	sum := sha256.Sum256(payload)
+	file.hash = sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true}
+	if file.duplicates, err = h.findDuplicates(file.hash.String, id, atomic); err != nil {
+		return file, err
+	}
+	if len(file.duplicates) > 0 {
+		if h.uc.RejectDuplicates {
+			return file, duplicateError{duplicates: file.duplicates}
+		}
+		log.Warnf("the upload file '%s' is already stored by %d document(s)", uploadFile, len(file.duplicates))
+	}
+
+	file.content.Valid = true
+	if u.MimeType == pdfMimeType {
+		if file.content.String, err = pdf.ExtractText(payload); err != nil {
+			// the document is stored without content, the text is only used for search
+			log.Warnf("could not extract the text of upload file '%s', %v", uploadFile, err)
+		}
+	}
+
 	item := filestore.FileItem{
 		FileName:   fileName,
 		FolderName: folder,
@@ -470,21 +614,43 @@ func (h *Handler) procssUploadFile(token, fileName string, atomic persistence.At
 	err = h.fs.SaveFile(item)
 	if err != nil {
 		log.Errorf("could not save file '%s', %v", uploadFile, err)
-		return "", fmt.Errorf("error while saving file: %v", err)
+		return file, fmt.Errorf("error while saving file: %v", err)
 	}
+	file.path = fmt.Sprintf("/%s/%s", folder, fileName)
+	file.upload = uploadFile
+	h.storeThumbnail(file.path, u.MimeType, payload)
+	return file, nil
+}
 
-	err = os.Remove(uploadFile)
+// findDuplicates returns the documents with the given hash, except the document with the given id
+func (h *Handler) findDuplicates(hash, id string, atomic persistence.Atomic) ([]DocumentEntity, error) {
+	docs, err := h.docRepo.FindByHash(hash, atomic)
 	if err != nil {
-		// this error is ignored, does not invalidate the overall operation
-		log.Warnf("could not delete upload-file '%s', %v", uploadFile, err)
+		log.Errorf("could not check for duplicates of hash '%s', %v", hash, err)
+		return nil, fmt.Errorf("error checking for duplicates: %v", err)
 	}
-	err = h.uploadRepo.Delete(token, atomic)
-	if err != nil {
-		// this error is ignored, does not invalidate the overall operation
-		log.Errorf("could not delete the upload-item by id '%s', %v", token, err)
+	var duplicates []DocumentEntity
+	for _, d := range docs {
+		if d.ID != id {
+			duplicates = append(duplicates, d)
+		}
 	}
+	return duplicates, nil
+}
+
+// documentLink returns the URL of the document with the given id, relative to the documents API of the request
+func documentLink(c echo.Context, id string) string {
+	return strings.TrimSuffix(c.Request().URL.Path, "/") + "/" + id
+}
 
-	return fmt.Sprintf("/%s/%s", folder, fileName), nil
+// uploadFileName returns the file name with the extension of the uploaded file
+// the uploaded file differs from the original file, if an image was converted or uploads were merged
+func uploadFileName(fileName string, u upload.Upload) string {
+	ext := filepath.Ext(u.FileName)
+	if ext == "" || strings.EqualFold(ext, filepath.Ext(fileName)) {
+		return fileName
+	}
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ext
 }
 
 func (h *Handler) startAtomic(c echo.Context) (persistence.Atomic, error) {
@@ -522,6 +688,7 @@ func sanitize(policy *bluemonday.Policy, d *Document) *Document {
 	doc.PreviewLink = policy.Sanitize(d.PreviewLink)
 	doc.UploadToken = policy.Sanitize(d.UploadToken)
 	doc.InvoiceNumber = policy.Sanitize(d.InvoiceNumber)
+	doc.Deleted = policy.Sanitize(d.Deleted)
 
 	for _, t := range d.Tags {
 		doc.Tags = append(doc.Tags, policy.Sanitize(t))
@@ -563,6 +730,10 @@ func convert(policy *bluemonday.Policy, d DocumentEntity) Document {
 	if d.InvoiceNumber.Valid {
 		inv = d.InvoiceNumber.String
 	}
+	deleted := ""
+	if d.Deleted.Valid {
+		deleted = d.Deleted.Time.Format(jsonTimeLayout)
+	}
 	doc := sanitize(policy, &Document{
 		ID:            d.ID,
 		Title:         d.Title,
@@ -575,6 +746,7 @@ func convert(policy *bluemonday.Policy, d DocumentEntity) Document {
 		Tags:          tags,
 		Senders:       senders,
 		InvoiceNumber: inv,
+		Deleted:       deleted,
 	})
 	return *doc
 }
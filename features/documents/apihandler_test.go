@@ -1,9 +1,15 @@
 package documents
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	stdimage "image"
+	"image/png"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -15,6 +21,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/errors"
 	"github.com/bihe/mydms/internal/persistence"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
@@ -232,20 +239,8 @@ func TestDeleteDocumentByID(t *testing.T) {
 		t.Errorf(errExp)
 	}
 
-	// error no file delete
-	mock.ExpectBegin()
-	mock.ExpectRollback()
-	svc.callCount = 0
-	svc.errMap[1] = errRaise
-	h = NewHandler(repos, svc, uploadConfig)
-
-	c = e.NewContext(req, rec)
-	c.SetParamNames(ID)
-	c.SetParamValues(noFileDelete)
-	err = h.DeleteDocumentByID(c)
-	if err == nil {
-		t.Errorf(errExp)
-	}
+	// the files are kept in the trash
+	assert.Equal(t, 0, svc.callCount)
 
 	// we make sure that all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -368,8 +363,9 @@ func TestSaveUpdateDocument(t *testing.T) {
 	// error get document - create new
 	_, rec, c = newReq(strings.NewReader(updateJSON))
 
+	// the document is read before the transaction is started
 	docRepo.callCount = 0
-	docRepo.errMap[2] = errRaise
+	docRepo.errMap[1] = errRaise
 	h = NewHandler(repos, svc, uploadConfig)
 	mock.ExpectBegin()
 	mock.ExpectCommit()
@@ -470,12 +466,10 @@ func TestSaveNewDocument(t *testing.T) {
 	}
 	assert.Equal(t, Created, result.Result)
 
-	// error processUploadFile
+	// error reading the upload, no transaction is started
 	ioutil.WriteFile(uploadFile, []byte(pdfPayload), 0644)
 	_, rec, c = newReq()
 
-	mock.ExpectBegin()
-	mock.ExpectRollback()
 	uploadRepo.callCount = 0
 	uploadRepo.errMap[1] = doError
 	h = NewHandler(repos, svc, uploadConfig)
@@ -534,6 +528,138 @@ func TestSaveNewDocument(t *testing.T) {
 	}
 }
 
+func TestSaveConvertedUpload(t *testing.T) {
+	e := echo.New()
+	con := sqliteConn(t)
+	defer con.Close()
+
+	docRepo, err := NewRepository(con)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+	uploadRepo, err := upload.NewRepository(con)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+	config := upload.Config{
+		AllowedFileTypes: []string{"png", "pdf"},
+		MaxUploadSize:    10000,
+		UploadPath:       getTempPath(),
+		ConvertImages:    true,
+	}
+	defer os.RemoveAll(config.UploadPath)
+	uh := upload.NewHandler(uploadRepo, config)
+	h := NewHandler(Repositories{DocRepo: docRepo, UploadRepo: uploadRepo}, newFileService(), config)
+
+	for _, fileName := range []string{"receipt.png", "receipt.PDF"} {
+		// the image is converted to a PDF upload
+		var image bytes.Buffer
+		png.Encode(&image, stdimage.NewGray(stdimage.Rect(0, 0, 20, 10)))
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "receipt.png")
+		if err != nil {
+			t.Fatalf("could not create the multipart form: %v", err)
+		}
+		io.Copy(part, &image)
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		if err = uh.UploadFile(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("could not upload the image: %v", err)
+		}
+		var r upload.Result
+		if err = json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+			t.Fatalf(errorUnmarshal, err)
+		}
+
+		// the document is saved with the file name of the client
+		req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(fmt.Sprintf(`{"title":"Receipt","fileName":"%s","uploadFileToken":"%s"}`, fileName, r.Token)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec = httptest.NewRecorder()
+		if err = h.SaveDocument(e.NewContext(req, rec)); err != nil {
+			t.Fatalf("could not save the document of '%s': %v", fileName, err)
+		}
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		if _, err = os.Stat(filepath.Join(config.UploadPath, r.Token+".pdf")); !os.IsNotExist(err) {
+			t.Errorf("the upload-file was not removed")
+		}
+	}
+
+	var fileNames []string
+	if err = con.Select(&fileNames, "SELECT filename FROM DOCUMENTS ORDER BY filename"); err != nil {
+		t.Fatalf("could not get the documents: %v", err)
+	}
+	if assert.Equal(t, 2, len(fileNames)) {
+		assert.True(t, strings.HasSuffix(fileNames[0], "/receipt.PDF"))
+		assert.True(t, strings.HasSuffix(fileNames[1], "/receipt.pdf"))
+	}
+}
+
+func TestSQLiteSaveDocument(t *testing.T) {
+	e := echo.New()
+	con := sqliteConn(t)
+	defer con.Close()
+
+	docRepo, err := NewRepository(con)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+	uploadRepo, err := upload.NewRepository(con)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+	config := uploadConfig
+	config.UploadPath = getTempPath()
+	defer os.RemoveAll(config.UploadPath)
+	h := NewHandler(Repositories{DocRepo: docRepo, UploadRepo: uploadRepo}, newFileService(), config)
+
+	save := func(payload string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, h.SaveDocument(e.NewContext(req, rec))
+	}
+	newUpload := func(token string) {
+		if err := uploadRepo.Write(upload.Upload{ID: token, FileName: "test.pdf", MimeType: "application/pdf", Created: time.Now().UTC()}, persistence.Atomic{}); err != nil {
+			t.Fatalf("could not write the upload: %v", err)
+		}
+		ioutil.WriteFile(filepath.Join(config.UploadPath, token+".pdf"), []byte(pdfPayload), 0644)
+	}
+
+	// a new document with an upload token
+	newUpload("ABC")
+	rec, err := save(`{"title":"Test","fileName":"test.pdf","uploadFileToken":"ABC"}`)
+	if err != nil {
+		t.Fatalf(couldNotSave, err)
+	}
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var id string
+	if err = con.Get(&id, "SELECT id FROM DOCUMENTS"); err != nil {
+		t.Fatalf("could not get the document: %v", err)
+	}
+	if _, err = uploadRepo.Read("ABC"); err == nil {
+		t.Errorf("the upload was not deleted")
+	}
+
+	// the existing document is updated with a new upload
+	newUpload("DEF")
+	rec, err = save(fmt.Sprintf(`{"id":"%s","title":"Updated","fileName":"test.pdf","uploadFileToken":"DEF"}`, id))
+	if err != nil {
+		t.Fatalf(couldNotSave, err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	doc, err := docRepo.Get(id)
+	if err != nil {
+		t.Fatalf("could not get the document: %v", err)
+	}
+	assert.Equal(t, "Updated", doc.Title)
+	if _, err = uploadRepo.Read("DEF"); err == nil {
+		t.Errorf("the upload was not deleted")
+	}
+}
+
 func TestSearchList(t *testing.T) {
 	var (
 		rec *httptest.ResponseRecorder
@@ -623,3 +749,156 @@ func getTempPath() string {
 	dir, _ := ioutil.TempDir("", "mydms")
 	return dir
 }
+
+func TestUploadFileName(t *testing.T) {
+	assert.Equal(t, "receipt.pdf", uploadFileName("receipt.jpg", upload.Upload{FileName: "receipt.pdf"}))
+	assert.Equal(t, "invoice.PDF", uploadFileName("invoice.PDF", upload.Upload{FileName: "invoice.pdf"}))
+	assert.Equal(t, "invoice.pdf", uploadFileName("invoice.pdf", upload.Upload{}))
+}
+
+func TestSaveDuplicateDocument(t *testing.T) {
+	// Setup
+	e := echo.New()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	dbx := sqlx.NewDb(db, "mysql")
+	con := persistence.NewFromDB(dbx)
+
+	newReq := func(payload string) (recorder *httptest.ResponseRecorder, context echo.Context) {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/documents", strings.NewReader(payload))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder = httptest.NewRecorder()
+		context = e.NewContext(request, recorder)
+		return
+	}
+
+	docRepo := newDocRepo(con)
+	docRepo.duplicates = []DocumentEntity{{ID: "existing", Hash: sql.NullString{String: "hash", Valid: true}}}
+	svc := newFileService()
+	repos := Repositories{
+		DocRepo:    docRepo,
+		UploadRepo: newUploadRepo(),
+	}
+
+	config := uploadConfig
+	config.UploadPath = getTempPath()
+	defer os.RemoveAll(config.UploadPath)
+	uploadFile := filepath.Join(config.UploadPath, "ABC.pdf")
+	const newJSON = `{"title":"Test","fileName":"test.pdf","uploadFileToken":"ABC"}`
+
+	// the document is saved, the existing document is reported
+	ioutil.WriteFile(uploadFile, []byte(pdfPayload), 0644)
+	rec, c := newReq(newJSON)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	if err = NewHandler(repos, svc, config).SaveDocument(c); err != nil {
+		t.Errorf(couldNotSave, err)
+	}
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var result Result
+	if err = json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, Created, result.Result)
+	assert.Equal(t, []string{"/api/v1/documents/existing"}, result.Duplicates)
+
+	// the existing document is the updated document
+	ioutil.WriteFile(uploadFile, []byte(pdfPayload), 0644)
+	rec, c = newReq(`{"id":"existing","title":"Test","fileName":"test.pdf","uploadFileToken":"ABC"}`)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	config.RejectDuplicates = true
+	if err = NewHandler(repos, svc, config).SaveDocument(c); err != nil {
+		t.Errorf(couldNotSave, err)
+	}
+	result = Result{}
+	if err = json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, Updated, result.Result)
+	assert.Equal(t, 0, len(result.Duplicates))
+
+	// the duplicate is rejected, the file is not saved
+	ioutil.WriteFile(uploadFile, []byte(pdfPayload), 0644)
+	_, c = newReq(newJSON)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	svc.callCount = 0
+	err = NewHandler(repos, svc, config).SaveDocument(c)
+	if conflict, ok := err.(errors.ConflictError); assert.True(t, ok, "conflict expected") {
+		assert.Equal(t, "/api/v1/documents/existing", conflict.URL)
+	}
+	assert.Equal(t, 0, svc.callCount)
+
+	// error checking for duplicates
+	_, c = newReq(newJSON)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	docRepo.callCount = 0
+	docRepo.errMap[2] = errRaise
+	if err = NewHandler(repos, svc, config).SaveDocument(c); err == nil {
+		t.Errorf(errExp)
+	}
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
+
+func TestGetDuplicates(t *testing.T) {
+	// Setup
+	e := echo.New()
+	newReq := func() (*httptest.ResponseRecorder, echo.Context) {
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	}
+
+	hash := func(h string) sql.NullString {
+		return sql.NullString{String: h, Valid: true}
+	}
+	mdr := &mockRepository{duplicates: []DocumentEntity{
+		{ID: "1", Title: "invoice", Hash: hash("a")},
+		{ID: "2", Title: "invoice copy", Hash: hash("a")},
+		{ID: "3", Title: "contract", Hash: hash("b")},
+		{ID: "4", Title: "contract copy", Hash: hash("b")},
+		{ID: "5", Title: "contract scan", Hash: hash("b")},
+	}}
+	h := NewHandler(Repositories{DocRepo: mdr}, &mockFileService{}, uploadConfig)
+
+	rec, c := newReq()
+	if err := h.GetDuplicates(c); err != nil {
+		t.Errorf("cannot get duplicates: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result Duplicates
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, 2, result.TotalEntries)
+	assert.Equal(t, "a", result.Groups[0].Hash)
+	assert.Equal(t, 2, len(result.Groups[0].Documents))
+	assert.Equal(t, "b", result.Groups[1].Hash)
+	assert.Equal(t, 3, len(result.Groups[1].Documents))
+	assert.Equal(t, "contract scan", result.Groups[1].Documents[2].Title)
+
+	// no duplicates
+	mdr.duplicates = nil
+	rec, c = newReq()
+	if err := h.GetDuplicates(c); err != nil {
+		t.Errorf("cannot get duplicates: %v", err)
+	}
+	assert.Equal(t, `{"groups":[],"totalEntries":0}`, strings.TrimSpace(rec.Body.String()))
+
+	// error result
+	mdr.fail = true
+	_, c = newReq()
+	if err := h.GetDuplicates(c); err == nil {
+		t.Errorf(errExp)
+	}
+}
@@ -0,0 +1,59 @@
+package documents
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/persistence"
+)
+
+// Importer creates documents outside of an API request, e.g. for files received by mail
+// it uses the same logic to process the upload-file as the API
+type Importer struct {
+	h *Handler
+}
+
+// NewImporter returns a pointer to a new importer instance
+func NewImporter(repos Repositories, fs filestore.FileService, config upload.Config) *Importer {
+	return &Importer{h: NewHandler(repos, fs, config)}
+}
+
+// Import creates a new document, the file is taken from the upload identified by the UploadToken
+func (i *Importer) Import(d Document) (id string, err error) {
+	d.ID = ""
+	d = *sanitize(i.h.policy, &d)
+	if d.UploadToken == "" || d.UploadToken == "-" {
+		return "", fmt.Errorf("an upload token is needed to import a document")
+	}
+
+	// the upload is read before the transaction is started, a SQLite database only provides a single connection
+	u, err := i.h.uploadRepo.Read(d.UploadToken)
+	if err != nil {
+		return "", fmt.Errorf("upload token error: %v", err)
+	}
+	file, err := i.h.storeUploadFile(u, uploadFileName(d.FileName, u), "", persistence.Atomic{})
+	if err != nil {
+		return "", fmt.Errorf("upload-file error: %v", err)
+	}
+	fileName := file.path
+	d.FileName = fileName
+
+	atomic, err := i.h.docRepo.CreateAtomic()
+	if err == nil {
+		doc := initDocument(&d, strings.Join(d.Senders, ";"), strings.Join(d.Tags, ";"))
+		doc.Content = file.content
+		doc.Hash = file.hash
+		if doc, err = i.h.docRepo.Save(doc, atomic); err == nil {
+			id = doc.ID
+			err = i.h.uploadRepo.Delete(d.UploadToken, atomic)
+		}
+		err = persistence.HandleTX(true, &atomic, err)
+	}
+	i.h.completeUpload(file, err)
+	if err != nil {
+		return "", fmt.Errorf("could not save document: %v", err)
+	}
+	return id, nil
+}
@@ -3,6 +3,8 @@ package documents
 import (
 	"database/sql"
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/bihe/mydms/features/filestore"
@@ -19,10 +21,16 @@ var errTx = fmt.Errorf("start transaction failed")
 var _ Repository = (*mockRepository)(nil)
 
 type mockRepository struct {
-	c         persistence.Connection
-	fail      bool
-	errMap    map[int]error
-	callCount int
+	c          persistence.Connection
+	fail       bool
+	errMap     map[int]error
+	callCount  int
+	duplicates []DocumentEntity
+	versions   []DocumentVersionEntity
+	trashed    []DocumentEntity
+	outbox     []OutboxEntity
+	references []FileReference
+	renamed    map[string]string
 }
 
 func newDocRepo(c persistence.Connection) *mockRepository {
@@ -113,6 +121,129 @@ func (m *mockRepository) SearchLists(s string, st SearchType) ([]string, error)
 	return []string{"one", "two"}, nil
 }
 
+func (m *mockRepository) FindByHash(hash string, a persistence.Atomic) ([]DocumentEntity, error) {
+	m.callCount++
+	return m.duplicates, m.errMap[m.callCount]
+}
+
+func (m *mockRepository) Duplicates() ([]DocumentEntity, error) {
+	if m.fail {
+		return nil, Err
+	}
+	return m.duplicates, nil
+}
+
+func (m *mockRepository) Versions(id string, a persistence.Atomic) ([]DocumentVersionEntity, error) {
+	m.callCount++
+	return m.versions, m.errMap[m.callCount]
+}
+
+func (m *mockRepository) Version(id string, version int) (DocumentVersionEntity, error) {
+	m.callCount++
+	for _, v := range m.versions {
+		if v.ID == id && v.Version == version {
+			return v, m.errMap[m.callCount]
+		}
+	}
+	return DocumentVersionEntity{}, fmt.Errorf("no version")
+}
+
+func (m *mockRepository) Trash(id string, a persistence.Atomic) (err error) {
+	m.callCount++
+	if id == noDelete {
+		return fmt.Errorf("delete error")
+	}
+	return m.errMap[m.callCount]
+}
+
+func (m *mockRepository) Untrash(id string, a persistence.Atomic) (err error) {
+	m.callCount++
+	return m.errMap[m.callCount]
+}
+
+func (m *mockRepository) InTrash(id string, a persistence.Atomic) (filePath string, err error) {
+	m.callCount++
+	if id == notExists {
+		return "", fmt.Errorf("exists error")
+	}
+	if id == noFileDelete {
+		return noFileDelete, nil
+	}
+	return "file", nil
+}
+
+func (m *mockRepository) Trashed(before time.Time) ([]DocumentEntity, error) {
+	if m.fail {
+		return nil, Err
+	}
+	var docs []DocumentEntity
+	for _, d := range m.trashed {
+		if before.IsZero() || d.Deleted.Time.Before(before) {
+			docs = append(docs, d)
+		}
+	}
+	return docs, nil
+}
+
+func (m *mockRepository) Enqueue(paths []string, a persistence.Atomic) ([]OutboxEntity, error) {
+	m.callCount++
+	if err := m.errMap[m.callCount]; err != nil {
+		return nil, err
+	}
+	var entries []OutboxEntity
+	for _, p := range paths {
+		entries = append(entries, OutboxEntity{ID: p, Path: p, Created: time.Now().UTC()})
+	}
+	m.outbox = append(m.outbox, entries...)
+	return entries, nil
+}
+
+func (m *mockRepository) Outbox() ([]OutboxEntity, error) {
+	if m.fail {
+		return nil, Err
+	}
+	return m.outbox, nil
+}
+
+func (m *mockRepository) Dequeue(id string) error {
+	for i, e := range m.outbox {
+		if e.ID == id {
+			m.outbox = append(m.outbox[:i], m.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeliveryFailed(id, reason string) error {
+	for i, e := range m.outbox {
+		if e.ID == id {
+			m.outbox[i].Attempts++
+			m.outbox[i].LastError = sql.NullString{String: reason, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) FileReferences() ([]FileReference, error) {
+	if m.fail {
+		return nil, Err
+	}
+	return m.references, nil
+}
+
+func (m *mockRepository) RenameFile(from, to string, a persistence.Atomic) error {
+	m.callCount++
+	if err := m.errMap[m.callCount]; err != nil {
+		return err
+	}
+	if m.renamed == nil {
+		m.renamed = make(map[string]string)
+	}
+	m.renamed[from] = to
+	return nil
+}
+
 // --------------------------------------------------------------------------
 // MOCK: filestore.FileService
 // --------------------------------------------------------------------------
@@ -120,6 +251,7 @@ func (m *mockRepository) SearchLists(s string, st SearchType) ([]string, error)
 type mockFileService struct {
 	errMap    map[int]error
 	callCount int
+	files     []filestore.FileEntry
 }
 
 func newFileService() *mockFileService {
@@ -130,7 +262,11 @@ func newFileService() *mockFileService {
 
 // SaveFile(file FileItem) error
 // GetFile(filePath string) (FileItem, error)
+// OpenFile(filePath string) (FileStream, error)
+// OpenFileRange(filePath string, offset, length int64) (FileStream, error)
+// StatFile(filePath string) (FileInfo, error)
 // DeleteFile(filePath string) error
+// ListFiles() ([]FileEntry, error)
 
 func (m *mockFileService) SaveFile(file filestore.FileItem) error {
 	m.callCount++
@@ -145,10 +281,41 @@ func (m *mockFileService) GetFile(filePath string) (filestore.FileItem, error) {
 		Payload:    []byte(pdfPayload),
 	}, m.errMap[m.callCount]
 }
+func (m *mockFileService) OpenFile(filePath string) (filestore.FileStream, error) {
+	m.callCount++
+	return filestore.FileStream{
+		FileInfo: filestore.FileInfo{
+			Size:     int64(len(pdfPayload)),
+			MimeType: "application/pdf",
+		},
+		ReadCloser: ioutil.NopCloser(strings.NewReader(pdfPayload)),
+	}, m.errMap[m.callCount]
+}
+func (m *mockFileService) OpenFileRange(filePath string, offset, length int64) (filestore.FileStream, error) {
+	m.callCount++
+	return filestore.FileStream{
+		FileInfo: filestore.FileInfo{
+			Size:     length,
+			MimeType: "application/pdf",
+		},
+		ReadCloser: ioutil.NopCloser(strings.NewReader(pdfPayload[offset : offset+length])),
+	}, m.errMap[m.callCount]
+}
+func (m *mockFileService) StatFile(filePath string) (filestore.FileInfo, error) {
+	m.callCount++
+	return filestore.FileInfo{
+		Size:     int64(len(pdfPayload)),
+		MimeType: "application/pdf",
+	}, m.errMap[m.callCount]
+}
 func (m *mockFileService) DeleteFile(filePath string) error {
 	m.callCount++
 	return m.errMap[m.callCount]
 }
+func (m *mockFileService) ListFiles() ([]filestore.FileEntry, error) {
+	m.callCount++
+	return m.files, m.errMap[m.callCount]
+}
 
 // --------------------------------------------------------------------------
 // MOCK: upload.Repository
@@ -171,6 +338,8 @@ func newUploadRepo() *mockUploadRepository {
 // persistence.BaseRepository
 // Write(item Upload, a persistence.Atomic) (err error)
 // Read(id string) (Upload, error)
+// List() ([]Upload, error)
+// ListByOwner(owner string) ([]Upload, error)
 // Delete(id string, a persistence.Atomic) (err error)
 
 func (m *mockUploadRepository) Write(item upload.Upload, a persistence.Atomic) (err error) {
@@ -179,7 +348,19 @@ func (m *mockUploadRepository) Write(item upload.Upload, a persistence.Atomic) (
 }
 func (m *mockUploadRepository) Read(id string) (upload.Upload, error) {
 	m.callCount++
-	return m.resultMap[m.callCount], m.errMap[m.callCount]
+	u, ok := m.resultMap[m.callCount]
+	if !ok {
+		u = upload.Upload{ID: id, FileName: id + ".pdf"}
+	}
+	return u, m.errMap[m.callCount]
+}
+func (m *mockUploadRepository) List() ([]upload.Upload, error) {
+	m.callCount++
+	return nil, m.errMap[m.callCount]
+}
+func (m *mockUploadRepository) ListByOwner(owner string) ([]upload.Upload, error) {
+	m.callCount++
+	return nil, m.errMap[m.callCount]
 }
 func (m *mockUploadRepository) Delete(id string, a persistence.Atomic) (err error) {
 	m.callCount++
@@ -0,0 +1,87 @@
+package documents
+
+import (
+	"os"
+	"strings"
+
+	"github.com/bihe/mydms/internal/persistence"
+	log "github.com/sirupsen/logrus"
+)
+
+// The database and the filestore cannot be changed within a single transaction.
+// A stored file is deleted only after the transaction which removes its reference
+// was committed: the delete is added to the outbox within the transaction and the
+// entry is removed from the outbox as soon as the file was deleted. Deletes which
+// fail are retried by the Reconciler.
+// A file which was stored for a document, which could not be saved afterwards, is
+// deleted again as compensation.
+
+// deliver deletes the files of the outbox entries, an entry is removed from the outbox when its file was deleted
+// the number of failed deletes is returned, these entries are kept in the outbox
+func (h *Handler) deliver(entries []OutboxEntity) (failed int) {
+	for _, e := range entries {
+		if err := h.fs.DeleteFile(e.Path); err != nil {
+			log.Warnf("could not delete the file '%s', the delete is retried: %v", e.Path, err)
+			if err := h.docRepo.DeliveryFailed(e.ID, err.Error()); err != nil {
+				log.Errorf("could not record the failed delete of '%s': %v", e.Path, err)
+			}
+			failed++
+			continue
+		}
+		if err := h.docRepo.Dequeue(e.ID); err != nil {
+			// the delete is repeated, it is not an error to delete a missing file
+			log.Warnf("could not remove the delete of '%s' from the outbox: %v", e.Path, err)
+		}
+	}
+	return
+}
+
+// compensate deletes the files stored for a document which was not saved
+// files which cannot be deleted are added to the outbox
+func (h *Handler) compensate(paths ...string) {
+	var pending []string
+	for _, p := range paths {
+		if err := h.fs.DeleteFile(p); err != nil {
+			log.Warnf("could not delete the file '%s' of the unsaved document: %v", p, err)
+			pending = append(pending, p)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if _, err := h.docRepo.Enqueue(pending, persistence.Atomic{}); err != nil {
+		log.Errorf("could not add the delete of '%s' to the outbox, the files are orphaned: %v", strings.Join(pending, "', '"), err)
+	}
+}
+
+// completeUpload finishes the processing of the upload-file after the transaction was completed
+// the upload-file is removed if the document was saved, otherwise the stored file is deleted again
+// and the upload-file is kept to save the document later on
+func (h *Handler) completeUpload(file storedFile, err error) {
+	if file.upload == "" {
+		return
+	}
+	if err != nil {
+		log.Warnf("the document of file '%s' was not saved, the stored file is deleted", file.path)
+		h.compensate(file.path, thumbnailPath(file.path))
+		return
+	}
+	if ioerr := os.Remove(file.upload); ioerr != nil {
+		// this error is ignored, does not invalidate the overall operation
+		log.Warnf("could not delete upload-file '%s', %v", file.upload, ioerr)
+	}
+}
+
+// documentFiles returns the stored files of the document and of its versions, including the previews
+func documentFiles(fileName string, versions []DocumentVersionEntity) []string {
+	files := []string{fileName, thumbnailPath(fileName)}
+	seen := map[string]bool{fileName: true}
+	for _, v := range versions {
+		if seen[v.FileName] {
+			continue
+		}
+		seen[v.FileName] = true
+		files = append(files, v.FileName, thumbnailPath(v.FileName))
+	}
+	return files
+}
@@ -0,0 +1,127 @@
+package documents
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliver(t *testing.T) {
+	mdr := newDocRepo(persistence.Connection{})
+	svc := newFileService()
+	h := NewHandler(Repositories{DocRepo: mdr}, svc, uploadConfig)
+
+	entries, _ := mdr.Enqueue([]string{"/2020_01_01/a.pdf", "/2020_01_01/b.pdf"}, persistence.Atomic{})
+	svc.errMap[2] = errRaise
+	assert.Equal(t, 1, h.deliver(entries))
+	if assert.Equal(t, 1, len(mdr.outbox)) {
+		assert.Equal(t, "/2020_01_01/b.pdf", mdr.outbox[0].Path)
+		assert.Equal(t, 1, mdr.outbox[0].Attempts)
+		assert.Equal(t, errRaise.Error(), mdr.outbox[0].LastError.String)
+	}
+
+	// the delete is retried
+	assert.Equal(t, 0, h.deliver(mdr.outbox))
+	assert.Equal(t, 0, len(mdr.outbox))
+}
+
+func TestCompensate(t *testing.T) {
+	mdr := newDocRepo(persistence.Connection{})
+	svc := newFileService()
+	h := NewHandler(Repositories{DocRepo: mdr}, svc, uploadConfig)
+
+	h.compensate("/2020_01_01/a.pdf", "/2020_01_01/a.pdf.thumb.jpg")
+	assert.Equal(t, 2, svc.callCount)
+	assert.Equal(t, 0, len(mdr.outbox))
+
+	// the failed delete is added to the outbox
+	svc.errMap[3] = errRaise
+	h.compensate("/2020_01_01/a.pdf", "/2020_01_01/a.pdf.thumb.jpg")
+	if assert.Equal(t, 1, len(mdr.outbox)) {
+		assert.Equal(t, "/2020_01_01/a.pdf", mdr.outbox[0].Path)
+	}
+}
+
+func TestSaveDocumentCompensation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	e := echo.New()
+	newReq := func() echo.Context {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title":"Test","fileName":"test.pdf","uploadFileToken":"ABC"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	docRepo := newDocRepo(persistence.NewFromDB(sqlx.NewDb(db, "mysql")))
+	svc := newFileService()
+	repos := Repositories{DocRepo: docRepo, UploadRepo: newUploadRepo()}
+	config := uploadConfig
+	config.UploadPath = getTempPath()
+	defer os.RemoveAll(config.UploadPath)
+	uploadFile := filepath.Join(config.UploadPath, "ABC.pdf")
+	ioutil.WriteFile(uploadFile, []byte(pdfPayload), 0644)
+
+	// the document is not saved: the stored file is deleted, the upload-file is kept
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	docRepo.errMap[3] = errRaise
+	if err = NewHandler(repos, svc, config).SaveDocument(newReq()); err == nil {
+		t.Errorf(errExp)
+	}
+	// save the file, delete the file and the preview
+	assert.Equal(t, 3, svc.callCount)
+	assert.Equal(t, 0, len(docRepo.outbox))
+	if _, err = os.Stat(uploadFile); err != nil {
+		t.Errorf("the upload-file was removed: %v", err)
+	}
+
+	// the document is saved: the upload-file is removed
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	docRepo.callCount = 0
+	delete(docRepo.errMap, 3)
+	svc.callCount = 0
+	if err = NewHandler(repos, svc, config).SaveDocument(newReq()); err != nil {
+		t.Errorf(couldNotSave, err)
+	}
+	assert.Equal(t, 1, svc.callCount)
+	if _, err = os.Stat(uploadFile); !os.IsNotExist(err) {
+		t.Errorf("the upload-file was not removed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
+
+func TestDocumentFiles(t *testing.T) {
+	assert.Equal(t, []string{
+		"/2020_01_03/invoice.pdf",
+		"/2020_01_03/invoice.pdf.thumb.jpg",
+		"/2020_01_01/invoice.pdf",
+		"/2020_01_01/invoice.pdf.thumb.jpg",
+		"/2020_01_02/invoice.pdf",
+		"/2020_01_02/invoice.pdf.thumb.jpg",
+	}, documentFiles("/2020_01_03/invoice.pdf", testVersions()))
+
+	assert.Equal(t, []string{
+		"/2020_01_02/invoice.pdf",
+		"/2020_01_02/invoice.pdf.thumb.jpg",
+		"/2020_01_01/invoice.pdf",
+		"/2020_01_01/invoice.pdf.thumb.jpg",
+	}, documentFiles("/2020_01_02/invoice.pdf", testVersions()))
+}
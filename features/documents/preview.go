@@ -0,0 +1,142 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/pdf"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
+
+	// decoders of documents stored as images
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// thumbnailWidth is the width of the preview image in pixels
+	thumbnailWidth = 300
+	// thumbnailSuffix is appended to the name of the document file to store the preview image
+	thumbnailSuffix = ".thumb.jpg"
+	thumbnailType   = "image/jpeg"
+)
+
+// GetPreview godoc
+// @Summary get the preview image of a document
+// @Description returns a thumbnail of the first page of the document
+// @Description the thumbnail is created if it is not available, e.g. for documents saved before thumbnails were introduced
+// @Tags documents
+// @Produce  image/jpeg
+// @Param id path string true "document ID"
+// @Param regenerate query bool false "create the thumbnail again"
+// @Success 200 {file} binary
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Router /api/v1/documents/{id}/preview [get]
+func (h *Handler) GetPreview(c echo.Context) error {
+	id := c.Param("id")
+	d, err := h.docRepo.Get(id)
+	if err != nil {
+		return errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+
+	var payload []byte
+	if c.QueryParam("regenerate") != "true" {
+		if item, err := h.fs.GetFile(thumbnailPath(d.FileName)); err == nil {
+			payload = item.Payload
+		}
+	}
+	if payload == nil {
+		file, err := h.fs.GetFile(d.FileName)
+		if err != nil {
+			return errors.NotFoundError{Err: fmt.Errorf("the file of document '%s' is not available: %v", id, err), Request: c.Request()}
+		}
+		if payload, err = createThumbnail(file.Payload, file.MimeType); err != nil {
+			return errors.NotFoundError{Err: fmt.Errorf("no preview available for document '%s': %v", id, err), Request: c.Request()}
+		}
+		h.saveThumbnail(d.FileName, payload)
+	}
+
+	c.Response().Header().Set("Cache-Control", "private, max-age=3600")
+	return c.Blob(http.StatusOK, thumbnailType, payload)
+}
+
+// storeThumbnail creates the preview image of the document file, errors are only logged
+// the preview is created again on demand
+func (h *Handler) storeThumbnail(filePath, mimeType string, payload []byte) {
+	thumbnail, err := createThumbnail(payload, mimeType)
+	if err != nil {
+		log.Warnf("could not create the preview of '%s': %v", filePath, err)
+		return
+	}
+	h.saveThumbnail(filePath, thumbnail)
+}
+
+// saveThumbnail stores the preview image next to the document file
+func (h *Handler) saveThumbnail(filePath string, thumbnail []byte) {
+	folder, name := path.Split(thumbnailPath(filePath))
+	err := h.fs.SaveFile(filestore.FileItem{
+		FileName:   name,
+		FolderName: strings.Trim(folder, "/"),
+		MimeType:   thumbnailType,
+		Payload:    thumbnail,
+	})
+	if err != nil {
+		log.Warnf("could not save the preview of '%s': %v", filePath, err)
+	}
+}
+
+// thumbnailPath returns the path of the preview image of the document file
+func thumbnailPath(filePath string) string {
+	return filePath + thumbnailSuffix
+}
+
+// createThumbnail renders the first page of a PDF document or scales an image to a JPEG thumbnail
+func createThumbnail(payload []byte, mimeType string) ([]byte, error) {
+	var (
+		img image.Image
+		err error
+	)
+	if mimeType == pdfMimeType {
+		img, err = pdf.RenderPage(payload, 1)
+	} else if strings.HasPrefix(mimeType, "image/") {
+		img, _, err = image.Decode(bytes.NewReader(payload))
+	} else {
+		err = fmt.Errorf("a preview of type '%s' is not supported", mimeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return nil, fmt.Errorf("the page is empty")
+	}
+	width, height := b.Dx(), b.Dy()
+	if width > thumbnailWidth {
+		width, height = thumbnailWidth, b.Dy()*thumbnailWidth/b.Dx()
+		if height == 0 {
+			height = 1
+		}
+	}
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("could not encode the preview: %v", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,109 @@
+package documents
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPreview(t *testing.T) {
+	e := echo.New()
+	request := func(id, query string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodGet, "/"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return c, rec
+	}
+	svc := newFileService()
+	h := NewHandler(Repositories{DocRepo: &mockRepository{}}, svc, uploadConfig)
+
+	// the stored preview is returned
+	c, rec := request(ID, "")
+	if assert.NoError(t, h.GetPreview(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/jpeg", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, pdfPayload, rec.Body.String())
+	}
+
+	// the missing preview is created from the document file
+	svc.callCount = 0
+	svc.errMap[1] = errRaise
+	scan := &scanFileService{svc}
+	h.fs = scan
+	c, rec = request(ID, "")
+	if assert.NoError(t, h.GetPreview(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		img, err := jpeg.Decode(rec.Body)
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Rect(0, 0, thumbnailWidth, 150), img.Bounds())
+		}
+		assert.Equal(t, 3, svc.callCount, "the preview should be saved")
+	}
+
+	// the preview is created again
+	svc.callCount = 0
+	delete(svc.errMap, 1)
+	c, rec = request(ID, "?regenerate=true")
+	if assert.NoError(t, h.GetPreview(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, 2, svc.callCount, "the stored preview should not be read")
+	}
+	h.fs = svc
+
+	// the document file is not available
+	svc.callCount = 0
+	svc.errMap[1] = errRaise
+	svc.errMap[2] = errRaise
+	c, _ = request(ID, "")
+	assert.Error(t, h.GetPreview(c))
+	delete(svc.errMap, 1)
+	delete(svc.errMap, 2)
+
+	// unknown document
+	c, _ = request("", "")
+	assert.Error(t, h.GetPreview(c))
+}
+
+// scanFileService returns the document file as scanned image
+type scanFileService struct {
+	*mockFileService
+}
+
+func (m *scanFileService) GetFile(filePath string) (filestore.FileItem, error) {
+	item, err := m.mockFileService.GetFile(filePath)
+	var b bytes.Buffer
+	png.Encode(&b, image.NewGray(image.Rect(0, 0, 600, 300)))
+	item.FileName, item.MimeType, item.Payload = "scan.png", "image/png", b.Bytes()
+	return item, err
+}
+
+func TestCreateThumbnail(t *testing.T) {
+	var b bytes.Buffer
+	png.Encode(&b, image.NewGray(image.Rect(0, 0, 600, 400)))
+	payload, err := createThumbnail(b.Bytes(), "image/png")
+	if err != nil {
+		t.Fatalf("could not create thumbnail: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("could not decode thumbnail: %v", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, thumbnailWidth, 200), img.Bounds())
+
+	if _, err := createThumbnail([]byte("text"), "text/plain"); err == nil {
+		t.Errorf("error for unsupported type expected")
+	}
+	if _, err := createThumbnail([]byte("no image"), "image/png"); err == nil {
+		t.Errorf("error for invalid image expected")
+	}
+}
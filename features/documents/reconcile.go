@@ -0,0 +1,173 @@
+package documents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/persistence"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultGracePeriod is the minimum age of an orphaned file if no grace period is defined
+const defaultGracePeriod = time.Hour
+
+// ReconcileConfig defines how the documents and the stored files are reconciled
+type ReconcileConfig struct {
+	// Enabled compares the stored files with the files of the documents
+	// the pending deletes of the outbox are retried in any case
+	Enabled bool
+	// Interval defines how often the outbox is delivered and the files are compared
+	Interval time.Duration
+	// GracePeriod is the minimum age of a stored file without document to be an orphan
+	// the file of a document is stored before the document is saved
+	GracePeriod time.Duration
+	// Fix deletes the orphaned files and moves documents without a file to the trash
+	// the differences are only reported otherwise
+	Fix bool
+}
+
+// ReconcileResult lists the differences between the documents and the stored files
+type ReconcileResult struct {
+	// Pending is the number of deletes of the outbox which failed again
+	Pending int
+	// Orphans are stored files which are not used by a document or a version
+	Orphans []string
+	// Dangling are the files of documents and versions which are not available in the filestore
+	Dangling []FileReference
+	// Deleted are the orphaned files which were deleted
+	Deleted []string
+	// Trashed are the documents without a file which were moved to the trash
+	Trashed []string
+}
+
+// Reconciler makes the documents and the stored files converge
+type Reconciler struct {
+	h      *Handler
+	config ReconcileConfig
+}
+
+// NewReconciler returns a reconciler for the documents of the repository and the filestore
+func NewReconciler(repos Repositories, fs filestore.FileService, config ReconcileConfig) *Reconciler {
+	return &Reconciler{h: NewHandler(repos, fs, upload.Config{}), config: config}
+}
+
+// Start periodically reconciles the documents and the stored files until the context is done, wg is done when the worker returned
+func (r *Reconciler) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if !r.config.Enabled {
+		log.Info("reconciliation is not enabled, only the pending deletes of files are retried")
+	}
+	interval := r.config.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := r.Reconcile(); err != nil {
+				log.Errorf("could not reconcile the documents and the stored files: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Reconcile retries the pending deletes of the outbox and compares the stored files with the files of the documents
+func (r *Reconciler) Reconcile() (ReconcileResult, error) {
+	var result ReconcileResult
+	entries, err := r.h.docRepo.Outbox()
+	if err != nil {
+		return result, err
+	}
+	result.Pending = r.h.deliver(entries)
+	if !r.config.Enabled {
+		return result, nil
+	}
+
+	// the references are read first, a file stored meanwhile is protected by the grace period
+	refs, err := r.h.docRepo.FileReferences()
+	if err != nil {
+		return result, err
+	}
+	files, err := r.h.fs.ListFiles()
+	if err != nil {
+		return result, err
+	}
+
+	grace := r.config.GracePeriod
+	if grace <= 0 {
+		grace = defaultGracePeriod
+	}
+	referenced := referencedFiles(refs)
+	stored := make(map[string]bool)
+	cutoff := time.Now().UTC().Add(-grace)
+	for _, f := range files {
+		stored[f.Path] = true
+		if !referenced[f.Path] && f.LastModified.Before(cutoff) {
+			result.Orphans = append(result.Orphans, f.Path)
+		}
+	}
+	for _, ref := range refs {
+		if !stored[storePath(ref.FileName)] {
+			result.Dangling = append(result.Dangling, ref)
+		}
+	}
+	if len(result.Orphans) > 0 || len(result.Dangling) > 0 {
+		log.Warnf("found %d orphaned files and %d missing files of documents", len(result.Orphans), len(result.Dangling))
+	}
+	if !r.config.Fix {
+		return result, nil
+	}
+	if len(refs) > 0 && len(result.Dangling) == len(refs) {
+		// nothing is fixed if none of the files is available, the filestore is most likely misconfigured
+		return result, fmt.Errorf("none of the %d files of the documents is available in the filestore", len(refs))
+	}
+
+	for _, o := range result.Orphans {
+		if err := r.h.fs.DeleteFile(o); err != nil {
+			log.Warnf("could not delete the orphaned file '%s': %v", o, err)
+			continue
+		}
+		log.Infof("deleted the orphaned file '%s'", o)
+		result.Deleted = append(result.Deleted, o)
+	}
+	for _, ref := range result.Dangling {
+		// the file of a version cannot be fixed, the version is only reported
+		if ref.Version != 0 || ref.Deleted.Valid {
+			continue
+		}
+		if err := r.h.docRepo.Trash(ref.DocumentID, persistence.Atomic{}); err != nil {
+			log.Warnf("could not move the document '%s' without file to the trash: %v", ref.DocumentID, err)
+			continue
+		}
+		log.Infof("moved the document '%s' to the trash, the file '%s' is not available", ref.DocumentID, ref.FileName)
+		result.Trashed = append(result.Trashed, ref.DocumentID)
+	}
+	return result, nil
+}
+
+// referencedFiles returns the paths of the files used by the documents and versions, including the previews
+func referencedFiles(refs []FileReference) map[string]bool {
+	referenced := make(map[string]bool)
+	for _, ref := range refs {
+		referenced[storePath(ref.FileName)] = true
+		referenced[storePath(thumbnailPath(ref.FileName))] = true
+	}
+	return referenced
+}
+
+// storePath returns the file name of a document in the form of the listed files "/FolderName/FileName"
+func storePath(fileName string) string {
+	return "/" + strings.TrimPrefix(fileName, "/")
+}
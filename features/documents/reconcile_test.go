@@ -0,0 +1,116 @@
+package documents
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	old := time.Now().UTC().Add(-24 * time.Hour)
+	mdr := newDocRepo(persistence.Connection{})
+	mdr.references = []FileReference{
+		{DocumentID: "invoice", FileName: "/2020_01_02/invoice.pdf"},
+		{DocumentID: "invoice", Version: 1, FileName: "/2020_01_01/invoice.pdf"},
+		{DocumentID: "contract", FileName: "/2020_01_01/contract.pdf"},
+		{DocumentID: "trashed", FileName: "2020_01_01/trashed.pdf", Deleted: sql.NullTime{Time: old, Valid: true}},
+	}
+	svc := newFileService()
+	svc.files = []filestore.FileEntry{
+		{Path: "/2020_01_02/invoice.pdf", LastModified: old},
+		{Path: "/2020_01_02/invoice.pdf.thumb.jpg", LastModified: old},
+		{Path: "/2020_01_01/trashed.pdf", LastModified: old},
+		{Path: "/2020_01_01/orphan.pdf", LastModified: old},
+		// the document of a new file is not saved yet
+		{Path: "/2020_01_03/new.pdf", LastModified: time.Now().UTC()},
+	}
+	repos := Repositories{DocRepo: mdr}
+	mdr.Enqueue([]string{"/2019_01_01/purged.pdf"}, persistence.Atomic{})
+
+	// only the outbox is delivered
+	result, err := NewReconciler(repos, svc, ReconcileConfig{}).Reconcile()
+	if err != nil {
+		t.Fatalf("could not reconcile: %v", err)
+	}
+	assert.Equal(t, 0, result.Pending)
+	assert.Equal(t, 0, len(mdr.outbox))
+	assert.Equal(t, 0, len(result.Orphans))
+
+	// the differences are reported
+	result, err = NewReconciler(repos, svc, ReconcileConfig{Enabled: true}).Reconcile()
+	if err != nil {
+		t.Fatalf("could not reconcile: %v", err)
+	}
+	assert.Equal(t, []string{"/2020_01_01/orphan.pdf"}, result.Orphans)
+	if assert.Equal(t, 2, len(result.Dangling)) {
+		assert.Equal(t, 1, result.Dangling[0].Version)
+		assert.Equal(t, "contract", result.Dangling[1].DocumentID)
+	}
+	assert.Equal(t, 0, len(result.Deleted))
+	assert.Equal(t, 0, len(result.Trashed))
+
+	// the differences are fixed
+	svc.callCount = 0
+	result, err = NewReconciler(repos, svc, ReconcileConfig{Enabled: true, Fix: true}).Reconcile()
+	if err != nil {
+		t.Fatalf("could not reconcile: %v", err)
+	}
+	assert.Equal(t, []string{"/2020_01_01/orphan.pdf"}, result.Deleted)
+	assert.Equal(t, []string{"contract"}, result.Trashed)
+	assert.Equal(t, 2, svc.callCount)
+
+	// a grace period protects the orphaned file
+	result, err = NewReconciler(repos, svc, ReconcileConfig{Enabled: true, GracePeriod: 48 * time.Hour}).Reconcile()
+	if err != nil {
+		t.Fatalf("could not reconcile: %v", err)
+	}
+	assert.Equal(t, 0, len(result.Orphans))
+
+	// nothing is fixed if the store is empty
+	svc.files = nil
+	mdr.callCount = 0
+	result, err = NewReconciler(repos, svc, ReconcileConfig{Enabled: true, Fix: true}).Reconcile()
+	if err == nil {
+		t.Errorf(errExp)
+	}
+	assert.Equal(t, 4, len(result.Dangling))
+	assert.Equal(t, 0, len(result.Trashed))
+	// no document is moved to the trash
+	assert.Equal(t, 0, mdr.callCount)
+
+	// the files of a wrong store are not deleted
+	svc.files = []filestore.FileEntry{
+		{Path: "/backup/invoice.pdf", LastModified: old},
+		{Path: "/backup/contract.pdf", LastModified: old},
+	}
+	svc.callCount = 0
+	mdr.callCount = 0
+	result, err = NewReconciler(repos, svc, ReconcileConfig{Enabled: true, Fix: true}).Reconcile()
+	if err == nil {
+		t.Errorf(errExp)
+	}
+	assert.Equal(t, 2, len(result.Orphans))
+	assert.Equal(t, 0, len(result.Deleted))
+	assert.Equal(t, 0, len(result.Trashed))
+	// no document is moved to the trash
+	assert.Equal(t, 0, mdr.callCount)
+	// only the listing of the files
+	assert.Equal(t, 1, svc.callCount)
+
+	// error listing the files
+	svc.callCount = 0
+	svc.errMap[1] = errRaise
+	if _, err = NewReconciler(repos, svc, ReconcileConfig{Enabled: true}).Reconcile(); err == nil {
+		t.Errorf(errExp)
+	}
+
+	// error reading the outbox
+	mdr.fail = true
+	if _, err = NewReconciler(repos, svc, ReconcileConfig{}).Reconcile(); err == nil {
+		t.Errorf(errExp)
+	}
+}
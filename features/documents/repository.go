@@ -2,6 +2,7 @@ package documents
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"math/rand"
 	"sort"
@@ -12,6 +13,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/bihe/mydms/internal/fulltext"
 	"github.com/bihe/mydms/internal/persistence"
 )
 
@@ -28,6 +30,43 @@ type DocumentEntity struct {
 	TagList       string         `db:"taglist"`
 	SenderList    string         `db:"senderlist"`
 	InvoiceNumber sql.NullString `db:"invoicenumber"`
+	// Content is the text extracted from the document file, it is not returned by Get or Search
+	Content sql.NullString `db:"content"`
+	// Hash is the hex encoded SHA-256 of the document file, it is not returned by Get or Search
+	Hash sql.NullString `db:"hash"`
+	// Deleted is the time the document was moved to the trash, trashed documents are not returned by Get or Search
+	Deleted sql.NullTime `db:"deleted"`
+}
+
+// DocumentVersionEntity is a saved state of a document, each save of a document creates a new version
+// the versions are not changed afterwards
+type DocumentVersionEntity struct {
+	DocumentEntity
+	Version int `db:"version"`
+	// Versioned is the time the version was saved
+	Versioned time.Time `db:"versioned"`
+}
+
+// OutboxEntity is a pending delete of a stored file
+// the entry is created within the transaction which removes the reference to the file
+// and is removed as soon as the file is deleted
+type OutboxEntity struct {
+	ID       string    `db:"id"`
+	Path     string    `db:"path"`
+	Created  time.Time `db:"created"`
+	Attempts int       `db:"attempts"`
+	// LastError is the reason of the last failed delete
+	LastError sql.NullString `db:"lasterror"`
+}
+
+// FileReference links a stored file to a document, or to a version of the document
+type FileReference struct {
+	DocumentID string `db:"document_id"`
+	// Version is 0 for the current file of the document
+	Version  int            `db:"version"`
+	FileName string         `db:"filename"`
+	Hash     sql.NullString `db:"hash"`
+	Deleted  sql.NullTime   `db:"deleted"`
 }
 
 // PagedDocuments wraps a list of documents and returns the total number of documents
@@ -61,6 +100,8 @@ func (s SortDirection) String() string {
 
 // DocSearch is used to search for documents
 type DocSearch struct {
+	// Query is a full-text query, the result is ordered by relevance
+	Query  string
 	Title  string
 	Tag    string
 	Sender string
@@ -85,6 +126,20 @@ type Repository interface {
 	Delete(id string, a persistence.Atomic) (err error)
 	Search(s DocSearch, order []OrderBy) (PagedDocuments, error)
 	SearchLists(s string, st SearchType) ([]string, error)
+	FindByHash(hash string, a persistence.Atomic) ([]DocumentEntity, error)
+	Duplicates() ([]DocumentEntity, error)
+	Versions(id string, a persistence.Atomic) ([]DocumentVersionEntity, error)
+	Version(id string, version int) (DocumentVersionEntity, error)
+	Trash(id string, a persistence.Atomic) (err error)
+	Untrash(id string, a persistence.Atomic) (err error)
+	InTrash(id string, a persistence.Atomic) (filePath string, err error)
+	Trashed(before time.Time) ([]DocumentEntity, error)
+	Enqueue(paths []string, a persistence.Atomic) ([]OutboxEntity, error)
+	Outbox() ([]OutboxEntity, error)
+	Dequeue(id string) error
+	DeliveryFailed(id, reason string) error
+	FileReferences() ([]FileReference, error)
+	RenameFile(from, to string, a persistence.Atomic) error
 }
 
 // compiler interface check
@@ -132,13 +187,24 @@ func (rw *dbRepository) Save(doc DocumentEntity, a persistence.Atomic) (d Docume
 	if doc.ID != "" {
 		var find DocumentEntity
 		// use the database logic for row-locking to prevent issues concurrently updating entries
-		err = rw.c.Get(&find, "SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber FROM DOCUMENTS WHERE id=? FOR UPDATE", doc.ID)
+		err = atomic.Get(&find, atomic.Rebind("SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,content,hash,deleted FROM DOCUMENTS WHERE id=?"+rw.c.Dialect().LockForUpdate()), doc.ID)
 		if err != nil {
 			log.Warnf("could not get a Document by ID '%s' - a new entry will be created", doc.ID)
 			newEnty = true
+		} else if find.Deleted.Valid {
+			// a trashed document needs to be restored before it is changed
+			err = fmt.Errorf("the document '%s' is in the trash", doc.ID)
+			return
 		} else {
 			newEnty = false
 			doc.Created = find.Created
+			// keep the extracted content and the hash of the unchanged file
+			if !doc.Content.Valid && doc.FileName == find.FileName {
+				doc.Content = find.Content
+			}
+			if !doc.Hash.Valid && doc.FileName == find.FileName {
+				doc.Hash = find.Hash
+			}
 		}
 	}
 
@@ -146,11 +212,11 @@ func (rw *dbRepository) Save(doc DocumentEntity, a persistence.Atomic) (d Docume
 		doc.ID = uuid.New().String()
 		doc.Created = time.Now().UTC()
 		doc.AltID = randomString(8)
-		r, err = atomic.NamedExec("INSERT INTO DOCUMENTS (id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,invoicenumber) VALUES (:id,:title,:filename,:alternativeid,:previewlink,:amount,:taglist,:senderlist,:created,:invoicenumber)", &doc)
+		r, err = atomic.NamedExec("INSERT INTO DOCUMENTS (id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,invoicenumber,content,hash) VALUES (:id,:title,:filename,:alternativeid,:previewlink,:amount,:taglist,:senderlist,:created,:invoicenumber,:content,:hash)", &doc)
 	} else {
 		m := sql.NullTime{Time: time.Now().UTC(), Valid: true}
 		doc.Modified = m
-		r, err = atomic.NamedExec("UPDATE DOCUMENTS SET title=:title,filename=:filename,alternativeid=:alternativeid,previewlink=:previewlink,amount=:amount,taglist=:taglist,senderlist=:senderlist,modified=:modified,invoicenumber=:invoicenumber WHERE id=:id", &doc)
+		r, err = atomic.NamedExec("UPDATE DOCUMENTS SET title=:title,filename=:filename,alternativeid=:alternativeid,previewlink=:previewlink,amount=:amount,taglist=:taglist,senderlist=:senderlist,modified=:modified,invoicenumber=:invoicenumber,content=:content,hash=:hash WHERE id=:id", &doc)
 	}
 
 	if err != nil {
@@ -167,12 +233,41 @@ func (rw *dbRepository) Save(doc DocumentEntity, a persistence.Atomic) (d Docume
 		return
 	}
 
+	if err = rw.saveList(atomic, doc.ID, TAGS, doc.TagList); err != nil {
+		return
+	}
+	if err = rw.saveList(atomic, doc.ID, SENDERS, doc.SenderList); err != nil {
+		return
+	}
+	if err = fulltext.Update(atomic, doc.ID, indexFields(doc)...); err != nil {
+		return
+	}
+	if err = rw.saveVersion(atomic, doc); err != nil {
+		return
+	}
+
 	return doc, nil
 }
 
+// saveVersion adds the saved state of the document as new version to the history of the document
+func (rw *dbRepository) saveVersion(a *persistence.Atomic, doc DocumentEntity) error {
+	v := DocumentVersionEntity{DocumentEntity: doc, Versioned: doc.Created}
+	if doc.Modified.Valid {
+		v.Versioned = doc.Modified.Time
+	}
+	if err := a.Get(&v.Version, a.Rebind("SELECT COALESCE(MAX(version),0)+1 FROM DOCUMENT_VERSIONS WHERE document_id = ?"), doc.ID); err != nil {
+		return fmt.Errorf("could not get the version of document: %v", err)
+	}
+	_, err := a.NamedExec("INSERT INTO DOCUMENT_VERSIONS (document_id,version,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,content,hash,versioned) VALUES (:id,:version,:title,:filename,:alternativeid,:previewlink,:amount,:taglist,:senderlist,:created,:modified,:invoicenumber,:content,:hash,:versioned)", &v)
+	if err != nil {
+		return fmt.Errorf("could not save the version of document: %v", err)
+	}
+	return nil
+}
+
 // Get retuns a document by the given id
 func (rw *dbRepository) Get(id string) (d DocumentEntity, err error) {
-	err = rw.c.Get(&d, "SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber FROM DOCUMENTS WHERE id=?", id)
+	err = rw.c.Get(&d, rw.c.Rebind("SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber FROM DOCUMENTS WHERE id=? AND deleted IS NULL"), id)
 	if err != nil {
 		err = fmt.Errorf("cannot get document by id '%s': %v", id, err)
 		return
@@ -195,7 +290,7 @@ func (rw *dbRepository) Exists(id string, a persistence.Atomic) (filePath string
 	}
 
 	var filename string
-	err = atomic.Get(&filename, "SELECT filename FROM DOCUMENTS WHERE id = ?", id)
+	err = atomic.Get(&filename, atomic.Rebind("SELECT filename FROM DOCUMENTS WHERE id = ? AND deleted IS NULL"), id)
 	if err != nil {
 		err = fmt.Errorf("cannot query document or document not available. %v", err)
 		return
@@ -204,7 +299,156 @@ func (rw *dbRepository) Exists(id string, a persistence.Atomic) (filePath string
 
 }
 
-// Delete a document by its id
+// FindByHash returns the documents with the given hash of the document file
+func (rw *dbRepository) FindByHash(hash string, a persistence.Atomic) (docs []DocumentEntity, err error) {
+	var (
+		atomic *persistence.Atomic
+	)
+
+	defer func() {
+		err = persistence.HandleTX(!a.Active, atomic, err)
+	}()
+
+	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
+		return
+	}
+
+	err = atomic.Select(&docs, atomic.Rebind("SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,hash FROM DOCUMENTS WHERE hash = ? AND deleted IS NULL ORDER BY created"), hash)
+	if err != nil {
+		err = fmt.Errorf("cannot get documents by hash '%s': %v", hash, err)
+	}
+	return
+}
+
+// Duplicates returns all documents which share the hash of the document file with other documents
+// trashed documents are not considered
+// the documents are ordered by hash, documents with the same hash are ordered by creation
+func (rw *dbRepository) Duplicates() ([]DocumentEntity, error) {
+	var docs []DocumentEntity
+	query := `SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,hash FROM DOCUMENTS
+WHERE deleted IS NULL AND hash IN (SELECT hash FROM DOCUMENTS WHERE hash IS NOT NULL AND deleted IS NULL GROUP BY hash HAVING count(id) > 1)
+ORDER BY hash, created`
+	if err := rw.c.Select(&docs, query); err != nil {
+		return nil, fmt.Errorf("could not get the duplicate documents: %v", err)
+	}
+	return docs, nil
+}
+
+// Versions returns the history of the document with the given id, ordered by version
+// the content of the versions is not returned
+func (rw *dbRepository) Versions(id string, a persistence.Atomic) (versions []DocumentVersionEntity, err error) {
+	var (
+		atomic *persistence.Atomic
+	)
+
+	defer func() {
+		err = persistence.HandleTX(!a.Active, atomic, err)
+	}()
+
+	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
+		return
+	}
+
+	err = atomic.Select(&versions, atomic.Rebind("SELECT document_id AS id,version,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,hash,versioned FROM DOCUMENT_VERSIONS WHERE document_id = ? ORDER BY version"), id)
+	if err != nil {
+		err = fmt.Errorf("cannot get the versions of document '%s': %v", id, err)
+	}
+	return
+}
+
+// Version returns the given version of a document including the content
+func (rw *dbRepository) Version(id string, version int) (v DocumentVersionEntity, err error) {
+	err = rw.c.Get(&v, rw.c.Rebind("SELECT document_id AS id,version,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,content,hash,versioned FROM DOCUMENT_VERSIONS WHERE document_id = ? AND version = ?"), id, version)
+	if err != nil {
+		err = fmt.Errorf("cannot get version %d of document '%s': %v", version, id, err)
+		return
+	}
+	return v, nil
+}
+
+// Trash marks the document as deleted, the document is kept until it is deleted
+func (rw *dbRepository) Trash(id string, a persistence.Atomic) (err error) {
+	return rw.setDeleted(id, sql.NullTime{Time: time.Now().UTC(), Valid: true}, a)
+}
+
+// Untrash restores the document from the trash
+func (rw *dbRepository) Untrash(id string, a persistence.Atomic) (err error) {
+	return rw.setDeleted(id, sql.NullTime{}, a)
+}
+
+// setDeleted moves the document into the trash or out of the trash
+func (rw *dbRepository) setDeleted(id string, deleted sql.NullTime, a persistence.Atomic) (err error) {
+	var (
+		atomic *persistence.Atomic
+		r      sql.Result
+	)
+
+	defer func() {
+		err = persistence.HandleTX(!a.Active, atomic, err)
+	}()
+
+	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
+		return
+	}
+
+	query := "UPDATE DOCUMENTS SET deleted = ? WHERE id = ? AND deleted IS NULL"
+	if !deleted.Valid {
+		query = "UPDATE DOCUMENTS SET deleted = ? WHERE id = ? AND deleted IS NOT NULL"
+	}
+	if r, err = atomic.Exec(atomic.Rebind(query), deleted, id); err != nil {
+		err = fmt.Errorf("cannot update document item: %v", err)
+		return
+	}
+	c, err := r.RowsAffected()
+	if err != nil {
+		err = fmt.Errorf("could not get affected rows: %v", err)
+		return
+	}
+	if c != 1 {
+		err = fmt.Errorf("document '%s' not available", id)
+	}
+	return
+}
+
+// InTrash checks if the given id is available in the trash
+func (rw *dbRepository) InTrash(id string, a persistence.Atomic) (filePath string, err error) {
+	var (
+		atomic *persistence.Atomic
+	)
+
+	defer func() {
+		err = persistence.HandleTX(!a.Active, atomic, err)
+	}()
+
+	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
+		return
+	}
+
+	err = atomic.Get(&filePath, atomic.Rebind("SELECT filename FROM DOCUMENTS WHERE id = ? AND deleted IS NOT NULL"), id)
+	if err != nil {
+		err = fmt.Errorf("cannot query document or document not in trash. %v", err)
+	}
+	return
+}
+
+// Trashed returns the documents moved to the trash before the given time, all trashed documents if the time is zero
+// the most recently trashed documents are returned first
+func (rw *dbRepository) Trashed(before time.Time) ([]DocumentEntity, error) {
+	var docs []DocumentEntity
+	query := "SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,deleted FROM DOCUMENTS WHERE deleted IS NOT NULL"
+	var args []interface{}
+	if !before.IsZero() {
+		query += " AND deleted < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY deleted DESC"
+	if err := rw.c.Select(&docs, rw.c.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("could not get the trashed documents: %v", err)
+	}
+	return docs, nil
+}
+
+// Delete a document by its id, the document and its versions are removed permanently
 func (rw *dbRepository) Delete(id string, a persistence.Atomic) (err error) {
 	var (
 		atomic *persistence.Atomic
@@ -218,13 +462,114 @@ func (rw *dbRepository) Delete(id string, a persistence.Atomic) (err error) {
 		return
 	}
 
-	_, err = atomic.Exec("DELETE FROM DOCUMENTS WHERE id = ?", id)
+	if err = fulltext.Remove(atomic, id); err != nil {
+		return
+	}
+	for _, st := range []SearchType{TAGS, SENDERS} {
+		if _, err = atomic.Exec(atomic.Rebind(fmt.Sprintf("DELETE FROM %s WHERE document_id = ?", listTables[st].join)), id); err != nil {
+			err = fmt.Errorf("cannot delete %s of document item: %v", listTables[st].table, err)
+			return
+		}
+	}
+	if _, err = atomic.Exec(atomic.Rebind("DELETE FROM DOCUMENT_VERSIONS WHERE document_id = ?"), id); err != nil {
+		err = fmt.Errorf("cannot delete the versions of document item: %v", err)
+		return
+	}
+	_, err = atomic.Exec(atomic.Rebind("DELETE FROM DOCUMENTS WHERE id = ?"), id)
 	if err != nil {
 		err = fmt.Errorf("cannot delete document item: %v", err)
 	}
 	return
 }
 
+// Enqueue adds pending deletes of the given files to the outbox
+func (rw *dbRepository) Enqueue(paths []string, a persistence.Atomic) (entries []OutboxEntity, err error) {
+	var (
+		atomic *persistence.Atomic
+	)
+
+	defer func() {
+		err = persistence.HandleTX(!a.Active, atomic, err)
+	}()
+
+	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, p := range paths {
+		e := OutboxEntity{ID: uuid.New().String(), Path: p, Created: now}
+		if _, err = atomic.NamedExec("INSERT INTO FILE_OUTBOX (id,path,created,attempts) VALUES (:id,:path,:created,:attempts)", &e); err != nil {
+			err = fmt.Errorf("cannot add the delete of '%s' to the outbox: %v", p, err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+// Outbox returns the pending deletes ordered by their creation
+func (rw *dbRepository) Outbox() ([]OutboxEntity, error) {
+	var entries []OutboxEntity
+	if err := rw.c.Select(&entries, "SELECT id,path,created,attempts,lasterror FROM FILE_OUTBOX ORDER BY created"); err != nil {
+		return nil, fmt.Errorf("could not get the outbox: %v", err)
+	}
+	return entries, nil
+}
+
+// Dequeue removes the entry of a completed delete from the outbox
+func (rw *dbRepository) Dequeue(id string) error {
+	if _, err := rw.c.Exec(rw.c.Rebind("DELETE FROM FILE_OUTBOX WHERE id = ?"), id); err != nil {
+		return fmt.Errorf("cannot remove '%s' from the outbox: %v", id, err)
+	}
+	return nil
+}
+
+// DeliveryFailed records the failed attempt to delete the file of the outbox entry
+func (rw *dbRepository) DeliveryFailed(id, reason string) error {
+	if _, err := rw.c.Exec(rw.c.Rebind("UPDATE FILE_OUTBOX SET attempts = attempts + 1, lasterror = ? WHERE id = ?"), reason, id); err != nil {
+		return fmt.Errorf("cannot update the outbox entry '%s': %v", id, err)
+	}
+	return nil
+}
+
+// FileReferences returns the files of all documents, including the trashed documents, and of their versions
+func (rw *dbRepository) FileReferences() ([]FileReference, error) {
+	var refs, versions []FileReference
+	if err := rw.c.Select(&refs, "SELECT id AS document_id,filename,hash,deleted FROM DOCUMENTS"); err != nil {
+		return nil, fmt.Errorf("could not get the files of the documents: %v", err)
+	}
+	if err := rw.c.Select(&versions, "SELECT document_id,version,filename,hash FROM DOCUMENT_VERSIONS"); err != nil {
+		return nil, fmt.Errorf("could not get the files of the versions: %v", err)
+	}
+	return append(refs, versions...), nil
+}
+
+// RenameFile changes the file of the documents and versions which use the given file
+// the documents are not modified otherwise, no version is added
+func (rw *dbRepository) RenameFile(from, to string, a persistence.Atomic) (err error) {
+	var (
+		atomic *persistence.Atomic
+	)
+
+	defer func() {
+		err = persistence.HandleTX(!a.Active, atomic, err)
+	}()
+
+	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
+		return
+	}
+
+	preview := sql.NullString{String: base64.StdEncoding.EncodeToString([]byte(to)), Valid: true}
+	for _, table := range []string{"DOCUMENTS", "DOCUMENT_VERSIONS"} {
+		if _, err = atomic.Exec(atomic.Rebind(fmt.Sprintf("UPDATE %s SET filename = ?, previewlink = ? WHERE filename = ?", table)), to, preview, from); err != nil {
+			err = fmt.Errorf("cannot rename the file '%s' of %s: %v", from, table, err)
+			return
+		}
+	}
+	return
+}
+
 // Search for documents based on the supplied search-object 'DocSearch'
 // the slice of order-bys is used to defined the query sort-order
 func (rw *dbRepository) Search(s DocSearch, order []OrderBy) (d PagedDocuments, err error) {
@@ -233,21 +578,25 @@ func (rw *dbRepository) Search(s DocSearch, order []OrderBy) (d PagedDocuments,
 	qc := "SELECT count(id) FROM DOCUMENTS"
 	where := "\nWHERE 1=1"
 	paging := ""
-	orderby := orderBy(order)
 	arg := make(map[string]interface{})
 
 	// use the supplied search-object to create the query
+	if q := fulltext.ParseQuery(s.Query); !q.Empty() {
+		condition, relevance := fulltext.Match(q, "DOCUMENTS.id", arg)
+		where += "\nAND " + condition
+		order = append([]OrderBy{{Field: relevance, Order: DESC}}, order...)
+	}
 	if s.Title != "" {
-		where += "\nAND ( lower(title) LIKE :search OR lower(taglist) LIKE :search OR lower(senderlist) LIKE :search OR lower(invoicenumber) LIKE :search)"
+		where += "\nAND ( lower(title) LIKE :search OR lower(taglist) LIKE :search OR lower(senderlist) LIKE :search OR lower(invoicenumber) LIKE :search OR lower(content) LIKE :search)"
 		arg["search"] = "%" + strings.ToLower(s.Title) + "%"
 	}
 	if s.Tag != "" {
-		where += "\nAND lower(taglist) LIKE :tag"
-		arg["tag"] = "%" + strings.ToLower(s.Tag) + "%"
+		where += "\nAND " + listFilter(TAGS, ":tag")
+		arg["tag"] = normalize(s.Tag)
 	}
 	if s.Sender != "" {
-		where += "\nAND lower(senderlist) LIKE :sender"
-		arg["sender"] = "%" + strings.ToLower(s.Sender) + "%"
+		where += "\nAND " + listFilter(SENDERS, ":sender")
+		arg["sender"] = normalize(s.Sender)
 	}
 	if !s.From.IsZero() {
 		where += "\nAND created >= :from"
@@ -257,11 +606,12 @@ func (rw *dbRepository) Search(s DocSearch, order []OrderBy) (d PagedDocuments,
 		where += "\nAND created <= :until"
 		arg["until"] = s.Until
 	}
-	if s.Limit > 0 {
-		paging += fmt.Sprintf("\nLIMIT %d", s.Limit)
-	}
-	if s.Skip > 0 {
-		paging += fmt.Sprintf("\nOFFSET %d", s.Skip)
+	// trashed documents are not found
+	where += "\nAND deleted IS NULL"
+	if s.Limit > 0 || s.Skip > 0 {
+		paging = rw.c.Dialect().Paging(s.Limit, s.Skip)
+		arg["limit"] = s.Limit
+		arg["offset"] = s.Skip
 	}
 
 	// get the number of affected documents
@@ -278,7 +628,7 @@ func (rw *dbRepository) Search(s DocSearch, order []OrderBy) (d PagedDocuments,
 	}
 
 	// retrieve the documents
-	query = q + where + orderby + paging
+	query = q + where + orderBy(order) + paging
 	log.Debugf("QUERY: %s", query)
 	query, args, err = prepareQuery(rw.c, query, arg)
 	if err != nil {
@@ -302,55 +652,105 @@ const (
 	SENDERS
 )
 
-// SearchLists collects all tag-entries from all documents and returns those elements which start with
+// listTable defines the table of a list and the join table to the documents
+type listTable struct {
+	table string
+	join  string
+	ref   string
+}
+
+var listTables = map[SearchType]listTable{
+	TAGS:    {table: "TAGS", join: "DOCUMENT_TAGS", ref: "tag_id"},
+	SENDERS: {table: "SENDERS", join: "DOCUMENT_SENDERS", ref: "sender_id"},
+}
+
+// SearchLists returns all tags/senders which are assigned to documents outside of the trash and start with
 // the given search term. The search is performed case insensitive
 func (rw *dbRepository) SearchLists(s string, st SearchType) ([]string, error) {
-	var (
-		t      string
-		result []string
-		lookup map[string]int
-		found  []string
-	)
+	var found []string
 
-	search := make(map[SearchType]string)
-	search[TAGS] = "taglist"
-	search[SENDERS] = "senderlist"
-
-	query := "SELECT distinct(%s) as search FROM DOCUMENTS WHERE lower(%s) LIKE ?"
-	query = fmt.Sprintf(query, search[st], search[st])
+	t := listTables[st]
+	query := fmt.Sprintf("SELECT l.name FROM %s l WHERE l.normalized LIKE ? ESCAPE '!' AND EXISTS (SELECT 1 FROM %s j WHERE j.%s = l.id AND j.document_id IN (SELECT id FROM DOCUMENTS WHERE deleted IS NULL))", t.table, t.join, t.ref)
+	if err := rw.c.Select(&found, rw.c.Rebind(query), escapeLike(normalize(s))+"%"); err != nil {
+		return nil, fmt.Errorf("could not search for %s: %v", t.table, err)
+	}
+	sort.Strings(found)
+	return found, nil
+}
 
-	rows, err := rw.c.Queryx(query, "%"+strings.ToLower(s)+"%")
-	if err != nil {
-		err = fmt.Errorf("could not search for %s: %v", search[st], err)
-		return nil, err
+// saveList replaces the tags/senders of a document with the given semicolon separated entries
+func (rw *dbRepository) saveList(a *persistence.Atomic, docID string, st SearchType, entries string) error {
+	t := listTables[st]
+	if _, err := a.Exec(a.Rebind(fmt.Sprintf("DELETE FROM %s WHERE document_id = ?", t.join)), docID); err != nil {
+		return fmt.Errorf("could not update %s of document: %v", t.table, err)
 	}
-	defer rows.Close()
 
-	lookup = make(map[string]int)
-	for rows.Next() {
-		if err := rows.Scan(&t); err != nil {
-			err = fmt.Errorf("could not get row contents: %v", err)
-			return nil, err
+	linked := make(map[string]bool)
+	for _, name := range strings.Split(entries, ";") {
+		name = strings.TrimSpace(name)
+		n := normalize(name)
+		if n == "" || linked[n] {
+			continue
 		}
-		parts := strings.Split(t, ";")
-		for _, p := range parts {
-			if _, found := lookup[p]; !found && p != "" {
-				lookup[p] = 1
-				result = append(result, p)
-			}
+
+		var id string
+		err := a.Get(&id, a.Rebind(fmt.Sprintf("SELECT id FROM %s WHERE normalized = ?", t.table)), n)
+		if err == sql.ErrNoRows {
+			id = uuid.New().String()
+			_, err = a.Exec(a.Rebind(fmt.Sprintf("INSERT INTO %s (id,name,normalized) VALUES (?,?,?)", t.table)), id, name, n)
+		}
+		if err != nil {
+			return fmt.Errorf("could not get entry '%s' of %s: %v", name, t.table, err)
 		}
-	}
 
-	// now we have collected all search-elements of all documents
-	// search for those which start with the given search term s
-	s = strings.ToLower(s)
-	for i := range result {
-		if strings.HasPrefix(strings.ToLower(result[i]), s) {
-			found = append(found, result[i])
+		if _, err = a.Exec(a.Rebind(fmt.Sprintf("INSERT INTO %s (document_id,%s) VALUES (?,?)", t.join, t.ref)), docID, id); err != nil {
+			return fmt.Errorf("could not assign entry '%s' of %s: %v", name, t.table, err)
 		}
+		linked[n] = true
 	}
-	sort.Strings(found)
-	return found, nil
+	return nil
+}
+
+// the fields of a document within the full-text index
+const (
+	fieldTitle = iota + 1
+	fieldTags
+	fieldSenders
+	fieldInvoiceNumber
+	fieldContent
+)
+
+// indexFields returns the texts of the document for the full-text index
+// matches in the title are more relevant than matches in tags, senders, the invoice number or the content
+func indexFields(doc DocumentEntity) []fulltext.Field {
+	fields := []fulltext.Field{
+		{ID: fieldTitle, Weight: 4, Text: doc.Title},
+		{ID: fieldInvoiceNumber, Weight: 2, Text: doc.InvoiceNumber.String},
+		{ID: fieldContent, Weight: 1, Text: doc.Content.String},
+	}
+	for _, t := range strings.Split(doc.TagList, ";") {
+		fields = append(fields, fulltext.Field{ID: fieldTags, Weight: 3, Text: t})
+	}
+	for _, s := range strings.Split(doc.SenderList, ";") {
+		fields = append(fields, fulltext.Field{ID: fieldSenders, Weight: 3, Text: s})
+	}
+	return fields
+}
+
+// listFilter returns the condition to find documents with the given tag/sender (named parameter)
+func listFilter(st SearchType, param string) string {
+	t := listTables[st]
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s j JOIN %s l ON l.id = j.%s WHERE j.document_id = DOCUMENTS.id AND l.normalized = %s)", t.join, t.table, t.ref, param)
+}
+
+// normalize is used to compare tags/senders regardless of case and surrounding whitespace
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern using the escape character '!'
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
 }
 
 func prepareQuery(c persistence.Connection, q string, args map[string]interface{}) (string, []interface{}, error) {
@@ -0,0 +1,519 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/schema"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteConn returns an in-memory SQLite database with the current schema
+func sqliteConn(t *testing.T) persistence.Connection {
+	c := persistence.NewConn("sqlite3", ":memory:")
+	m, err := persistence.NewMigrator(c, schema.Migrations)
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	return c
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	invoice, err := repo.Save(DocumentEntity{
+		Title:      "Invoice",
+		FileName:   "/2020_01_01/invoice.pdf",
+		Amount:     10.5,
+		TagList:    "Invoice;Internet",
+		SenderList: "Provider",
+		Content:    sql.NullString{String: "Invoice number R-2020-4711, total 10.50 EUR", Valid: true},
+	}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+	_, err = repo.Save(DocumentEntity{
+		Title:      "Contract",
+		FileName:   "/2020_01_02/contract.pdf",
+		TagList:    "Contract",
+		SenderList: "Insurance",
+	}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+
+	// update the existing entry, the content is kept
+	invoice.Title = "Internet Invoice"
+	invoice.Content = sql.NullString{}
+	if _, err = repo.Save(invoice, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not update document: %v", err)
+	}
+
+	d, err := repo.Get(invoice.ID)
+	if err != nil {
+		t.Fatalf("could not get document: %v", err)
+	}
+	assert.Equal(t, "Internet Invoice", d.Title)
+	assert.Equal(t, float32(10.5), d.Amount)
+	assert.True(t, d.Modified.Valid)
+	assert.Equal(t, invoice.Created.Unix(), d.Created.Unix())
+
+	filePath, err := repo.Exists(invoice.ID, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not check document: %v", err)
+	}
+	assert.Equal(t, "/2020_01_01/invoice.pdf", filePath)
+
+	result, err := repo.Search(DocSearch{Title: "internet", Limit: 10}, []OrderBy{{Field: "created", Order: DESC}})
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 1, result.Count)
+	assert.Equal(t, invoice.ID, result.Documents[0].ID)
+
+	result, err = repo.Search(DocSearch{Title: "r-2020-4711", Limit: 10}, nil)
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 1, result.Count)
+
+	result, err = repo.Search(DocSearch{From: time.Now().UTC().Add(-time.Hour), Limit: 10}, []OrderBy{{Field: "title", Order: ASC}})
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 2, result.Count)
+	assert.Equal(t, "Contract", result.Documents[0].Title)
+
+	// tags are matched exactly, regardless of the case
+	result, err = repo.Search(DocSearch{Tag: "inter", Limit: 10}, nil)
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 0, result.Count)
+	result, err = repo.Search(DocSearch{Tag: "INTERNET", Sender: "provider", Limit: 10}, nil)
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 1, result.Count)
+
+	// full-text search
+	fulltext := []struct {
+		query string
+		count int
+	}{
+		{"invoice", 1},
+		{"INTERNET provider", 1},
+		{"internet contract", 0},
+		{"internet OR contract", 2},
+		{`"internet invoice"`, 1},
+		{`"invoice internet"`, 0},
+		{"inter", 0},
+		{`"R-2020-4711"`, 1},
+	}
+	for _, f := range fulltext {
+		result, err = repo.Search(DocSearch{Query: f.query, Limit: 10}, nil)
+		if err != nil {
+			t.Fatalf("could not search documents: %v", err)
+		}
+		assert.Equal(t, f.count, result.Count, f.query)
+		assert.Equal(t, f.count, len(result.Documents), f.query)
+	}
+
+	// the title is more relevant than the tags
+	if _, err = repo.Save(DocumentEntity{
+		Title:      "Insurance",
+		FileName:   "/2020_01_03/insurance.pdf",
+		TagList:    "Contract",
+		SenderList: "Insurance",
+	}, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+	result, err = repo.Search(DocSearch{Query: "contract", Limit: 10}, []OrderBy{{Field: "title", Order: DESC}})
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 2, result.Count)
+	assert.Equal(t, "Contract", result.Documents[0].Title)
+
+	tags, err := repo.SearchLists("in", TAGS)
+	if err != nil {
+		t.Fatalf("could not search tags: %v", err)
+	}
+	assert.Equal(t, []string{"Internet", "Invoice"}, tags)
+
+	if err = repo.Delete(invoice.ID, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not delete document: %v", err)
+	}
+	if _, err = repo.Get(invoice.ID); err == nil {
+		t.Errorf(expectedErr)
+	}
+
+	// tags which are no longer assigned to a document are not found
+	tags, err = repo.SearchLists("in", TAGS)
+	if err != nil {
+		t.Fatalf("could not search tags: %v", err)
+	}
+	assert.Equal(t, 0, len(tags))
+}
+
+func TestSQLiteDuplicates(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	save := func(title, hash string) DocumentEntity {
+		d, err := repo.Save(DocumentEntity{
+			Title:    title,
+			FileName: "/2020_01_01/" + title + ".pdf",
+			Hash:     sql.NullString{String: hash, Valid: hash != ""},
+		}, persistence.Atomic{})
+		if err != nil {
+			t.Fatalf("could not save document: %v", err)
+		}
+		return d
+	}
+	invoice := save("invoice", "a")
+	save("contract", "b")
+	save("letter", "")
+	save("note", "")
+	dup := save("invoice-copy", "a")
+
+	docs, err := repo.FindByHash("a", persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not find documents: %v", err)
+	}
+	if assert.Equal(t, 2, len(docs)) {
+		assert.Equal(t, invoice.ID, docs[0].ID)
+		assert.Equal(t, "a", docs[0].Hash.String)
+	}
+
+	// the hash is kept, if the document is updated without a new file
+	dup.Title = "copy of invoice"
+	dup.Hash = sql.NullString{}
+	if _, err = repo.Save(dup, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not update document: %v", err)
+	}
+
+	// documents without a hash are not duplicates
+	docs, err = repo.Duplicates()
+	if err != nil {
+		t.Fatalf("could not get duplicates: %v", err)
+	}
+	if assert.Equal(t, 2, len(docs)) {
+		assert.Equal(t, invoice.ID, docs[0].ID)
+		assert.Equal(t, "copy of invoice", docs[1].Title)
+	}
+}
+
+func TestSQLiteVersions(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	doc, err := repo.Save(DocumentEntity{
+		Title:      "Invoice",
+		FileName:   "/2020_01_01/invoice.pdf",
+		TagList:    "Invoice",
+		SenderList: "Provider",
+		Content:    sql.NullString{String: "first invoice", Valid: true},
+		Hash:       sql.NullString{String: "a", Valid: true},
+	}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+
+	// a new file without content replaces the content of the previous file
+	doc.Title = "Corrected Invoice"
+	doc.FileName = "/2020_01_02/invoice.pdf"
+	doc.Content = sql.NullString{}
+	doc.Hash = sql.NullString{String: "b", Valid: true}
+	if _, err = repo.Save(doc, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not update document: %v", err)
+	}
+
+	versions, err := repo.Versions(doc.ID, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not get versions: %v", err)
+	}
+	if assert.Equal(t, 2, len(versions)) {
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, "Invoice", versions[0].Title)
+		assert.Equal(t, "/2020_01_01/invoice.pdf", versions[0].FileName)
+		assert.Equal(t, 2, versions[1].Version)
+		assert.Equal(t, "Corrected Invoice", versions[1].Title)
+		assert.False(t, versions[1].Versioned.Before(versions[0].Versioned))
+	}
+
+	// restore the first version
+	v, err := repo.Version(doc.ID, 1)
+	if err != nil {
+		t.Fatalf("could not get version: %v", err)
+	}
+	assert.Equal(t, "first invoice", v.Content.String)
+	if _, err = repo.Save(v.DocumentEntity, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not restore version: %v", err)
+	}
+	d, err := repo.Get(doc.ID)
+	if err != nil {
+		t.Fatalf("could not get document: %v", err)
+	}
+	assert.Equal(t, "Invoice", d.Title)
+	assert.Equal(t, "/2020_01_01/invoice.pdf", d.FileName)
+	result, err := repo.Search(DocSearch{Query: "first", Limit: 10}, nil)
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 1, result.Count)
+	if v, err = repo.Version(doc.ID, 3); err != nil {
+		t.Fatalf("could not get version: %v", err)
+	}
+	assert.Equal(t, "a", v.Hash.String)
+
+	// the versions are deleted with the document
+	if err = repo.Delete(doc.ID, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not delete document: %v", err)
+	}
+	if versions, err = repo.Versions(doc.ID, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not get versions: %v", err)
+	}
+	assert.Equal(t, 0, len(versions))
+	if _, err = repo.Version(doc.ID, 1); err == nil {
+		t.Errorf(expectedErr)
+	}
+}
+
+func TestSQLiteTrash(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	doc, err := repo.Save(DocumentEntity{
+		Title:      "Tax declaration",
+		FileName:   "/2020_01_01/tax.pdf",
+		TagList:    "Tax",
+		SenderList: "Office",
+		Hash:       sql.NullString{String: "a", Valid: true},
+	}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+
+	if err = repo.Trash(doc.ID, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not trash document: %v", err)
+	}
+	if err = repo.Trash(doc.ID, persistence.Atomic{}); err == nil {
+		t.Errorf("a trashed document cannot be trashed again")
+	}
+
+	// trashed documents are hidden
+	if _, err = repo.Get(doc.ID); err == nil {
+		t.Errorf(expectedErr)
+	}
+	if _, err = repo.Exists(doc.ID, persistence.Atomic{}); err == nil {
+		t.Errorf(expectedErr)
+	}
+	result, err := repo.Search(DocSearch{Query: "tax", Limit: 10}, nil)
+	if err != nil {
+		t.Fatalf("could not search documents: %v", err)
+	}
+	assert.Equal(t, 0, result.Count)
+	tags, err := repo.SearchLists("tax", TAGS)
+	if err != nil {
+		t.Fatalf("could not search tags: %v", err)
+	}
+	assert.Equal(t, 0, len(tags))
+	docs, err := repo.FindByHash("a", persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not find documents: %v", err)
+	}
+	assert.Equal(t, 0, len(docs))
+	// a trashed document cannot be changed
+	if _, err = repo.Save(doc, persistence.Atomic{}); err == nil {
+		t.Errorf("a trashed document cannot be saved")
+	}
+
+	// the trash
+	filePath, err := repo.InTrash(doc.ID, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not check trash: %v", err)
+	}
+	assert.Equal(t, "/2020_01_01/tax.pdf", filePath)
+	trashed, err := repo.Trashed(time.Time{})
+	if err != nil {
+		t.Fatalf("could not get trash: %v", err)
+	}
+	if assert.Equal(t, 1, len(trashed)) {
+		assert.True(t, trashed[0].Deleted.Valid)
+	}
+	if trashed, err = repo.Trashed(time.Now().UTC().Add(-time.Hour)); err != nil {
+		t.Fatalf("could not get trash: %v", err)
+	}
+	assert.Equal(t, 0, len(trashed))
+	if trashed, err = repo.Trashed(time.Now().UTC().Add(time.Minute)); err != nil {
+		t.Fatalf("could not get trash: %v", err)
+	}
+	assert.Equal(t, 1, len(trashed))
+
+	// restore the document
+	if err = repo.Untrash(doc.ID, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not restore document: %v", err)
+	}
+	if err = repo.Untrash(doc.ID, persistence.Atomic{}); err == nil {
+		t.Errorf("a document outside of the trash cannot be restored")
+	}
+	if _, err = repo.Get(doc.ID); err != nil {
+		t.Errorf("could not get restored document: %v", err)
+	}
+	if _, err = repo.InTrash(doc.ID, persistence.Atomic{}); err == nil {
+		t.Errorf(expectedErr)
+	}
+}
+
+func TestSQLiteOutbox(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	// the entries are discarded with the transaction
+	atomic, err := repo.CreateAtomic()
+	if err != nil {
+		t.Fatalf("could not start transaction: %v", err)
+	}
+	if _, err = repo.Enqueue([]string{"/2020_01_01/rollback.pdf"}, atomic); err != nil {
+		t.Fatalf("could not enqueue: %v", err)
+	}
+	atomic.Rollback()
+
+	entries, err := repo.Enqueue([]string{"/2020_01_01/invoice.pdf", "/2020_01_01/invoice.pdf.thumb.jpg"}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not enqueue: %v", err)
+	}
+	assert.Equal(t, 2, len(entries))
+
+	if err = repo.DeliveryFailed(entries[0].ID, "unavailable"); err != nil {
+		t.Fatalf("could not record failed delivery: %v", err)
+	}
+	if err = repo.Dequeue(entries[1].ID); err != nil {
+		t.Fatalf("could not dequeue: %v", err)
+	}
+	outbox, err := repo.Outbox()
+	if err != nil {
+		t.Fatalf("could not get outbox: %v", err)
+	}
+	if assert.Equal(t, 1, len(outbox)) {
+		assert.Equal(t, "/2020_01_01/invoice.pdf", outbox[0].Path)
+		assert.Equal(t, 1, outbox[0].Attempts)
+		assert.Equal(t, "unavailable", outbox[0].LastError.String)
+	}
+}
+
+func TestSQLiteFileReferences(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	doc, err := repo.Save(DocumentEntity{Title: "Invoice", FileName: "/2020_01_01/invoice.pdf"}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+	doc.FileName = "/2020_01_02/invoice.pdf"
+	if _, err = repo.Save(doc, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+	if err = repo.Trash(doc.ID, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not trash document: %v", err)
+	}
+
+	refs, err := repo.FileReferences()
+	if err != nil {
+		t.Fatalf("could not get file references: %v", err)
+	}
+	if assert.Equal(t, 3, len(refs)) {
+		assert.Equal(t, doc.ID, refs[0].DocumentID)
+		assert.Equal(t, 0, refs[0].Version)
+		assert.Equal(t, "/2020_01_02/invoice.pdf", refs[0].FileName)
+		assert.True(t, refs[0].Deleted.Valid)
+
+		versions := make(map[int]string)
+		for _, r := range refs[1:] {
+			versions[r.Version] = r.FileName
+		}
+		assert.Equal(t, map[int]string{1: "/2020_01_01/invoice.pdf", 2: "/2020_01_02/invoice.pdf"}, versions)
+	}
+}
+
+func TestSQLiteRenameFile(t *testing.T) {
+	c := sqliteConn(t)
+	defer c.Close()
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+
+	doc, err := repo.Save(DocumentEntity{Title: "Invoice", FileName: "/2020_01_01/invoice.pdf"}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+	other, err := repo.Save(DocumentEntity{Title: "Contract", FileName: "/2020_01_01/contract.pdf"}, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not save document: %v", err)
+	}
+
+	if err = repo.RenameFile("/2020_01_01/invoice.pdf", "/2020/invoice.pdf", persistence.Atomic{}); err != nil {
+		t.Fatalf("could not rename the file: %v", err)
+	}
+	doc, err = repo.Get(doc.ID)
+	if err != nil {
+		t.Fatalf("could not get document: %v", err)
+	}
+	assert.Equal(t, "/2020/invoice.pdf", doc.FileName)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("/2020/invoice.pdf")), doc.PreviewLink.String)
+	versions, err := repo.Versions(doc.ID, persistence.Atomic{})
+	if err != nil {
+		t.Fatalf("could not get the versions: %v", err)
+	}
+	if assert.Equal(t, 1, len(versions)) {
+		assert.Equal(t, "/2020/invoice.pdf", versions[0].FileName)
+	}
+
+	other, err = repo.Get(other.ID)
+	if err != nil {
+		t.Fatalf("could not get document: %v", err)
+	}
+	assert.Equal(t, "/2020_01_01/contract.pdf", other.FileName)
+}
@@ -21,9 +21,26 @@ const expectedErr = "error expected"
 
 const stmtInsertDocs = "INSERT INTO DOCUMENTS"
 const queryDocs = "SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber FROM DOCUMENTS"
+const queryDocsContent = "SELECT id,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,content,hash,deleted FROM DOCUMENTS"
 
 var Err = fmt.Errorf("error")
 
+// expectLists defines the statements to store the tags, senders, the full-text index and the version of a document
+// the tag is already available, the sender is created
+func expectLists(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("DELETE FROM DOCUMENT_TAGS").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id FROM TAGS").WithArgs("taglist").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("tagid"))
+	mock.ExpectExec("INSERT INTO DOCUMENT_TAGS").WithArgs(sqlmock.AnyArg(), "tagid").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_SENDERS").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id FROM SENDERS").WithArgs("senderlist").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec("INSERT INTO SENDERS").WithArgs(sqlmock.AnyArg(), "senderlist", "senderlist").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO DOCUMENT_SENDERS").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM SEARCH_INDEX").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO SEARCH_INDEX").WillReturnResult(sqlmock.NewResult(3, 3))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\),0\\)\\+1 FROM DOCUMENT_VERSIONS").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO DOCUMENT_VERSIONS").WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 func TestAtomic(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -95,6 +112,7 @@ func TestSave(t *testing.T) {
 	// INSERT
 	mock.ExpectBegin()
 	mock.ExpectExec(stmtInsertDocs).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectLists(mock)
 	mock.ExpectCommit()
 
 	var d DocumentEntity
@@ -114,10 +132,11 @@ func TestSave(t *testing.T) {
 	item.ID = uuid.New().String()
 	item.AltID = d.AltID
 
-	rows := sqlmock.NewRows([]string{"id", "title", "filename", "alternativeid", "previewlink", "amount", "taglist", "senderlist", "created", "modified", "invoicenumber"}).
-		AddRow(item.ID, item.Title, item.FileName, item.AltID, item.PreviewLink, item.Amount, item.TagList, item.SenderList, d.Created, nil, item.InvoiceNumber)
-	mock.ExpectQuery(queryDocs).WillReturnRows(rows)
+	rows := sqlmock.NewRows([]string{"id", "title", "filename", "alternativeid", "previewlink", "amount", "taglist", "senderlist", "created", "modified", "invoicenumber", "content"}).
+		AddRow(item.ID, item.Title, item.FileName, item.AltID, item.PreviewLink, item.Amount, item.TagList, item.SenderList, d.Created, nil, item.InvoiceNumber, "content")
+	mock.ExpectQuery(queryDocsContent).WillReturnRows(rows)
 	mock.ExpectExec("UPDATE DOCUMENTS").WillReturnResult(sqlmock.NewResult(1, 1))
+	expectLists(mock)
 	mock.ExpectCommit()
 
 	var up DocumentEntity
@@ -134,14 +153,17 @@ func TestSave(t *testing.T) {
 	assert.Equal(t, d.Created, up.Created)
 	assert.True(t, up.Modified.Time.After(now))
 	assert.Equal(t, item.InvoiceNumber, up.InvoiceNumber)
+	// the existing content is kept
+	assert.Equal(t, "content", up.Content.String)
 
 	// UPDATE with wrong ID
 	mock.ExpectBegin()
 	item.ID = uuid.New().String()
 	item.AltID = d.AltID
 
-	mock.ExpectQuery(queryDocs).WillReturnError(fmt.Errorf("no rows"))
+	mock.ExpectQuery(queryDocsContent).WillReturnError(fmt.Errorf("no rows"))
 	mock.ExpectExec(stmtInsertDocs).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectLists(mock)
 	mock.ExpectCommit()
 
 	if up, err = rw.Save(item, persistence.Atomic{}); err != nil {
@@ -160,6 +182,7 @@ func TestSave(t *testing.T) {
 	item.ID = ""
 	mock.ExpectBegin()
 	mock.ExpectExec(stmtInsertDocs).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectLists(mock)
 	a, _ := c.CreateAtomic()
 	if d, err = rw.Save(item, a); err != nil {
 		t.Errorf(errInsert, err)
@@ -225,6 +248,21 @@ func TestSaveError(t *testing.T) {
 	if _, err = rw.Save(item, persistence.Atomic{}); err == nil {
 		t.Errorf(errInsert)
 	}
+
+	// tags cannot be stored
+	mock.ExpectBegin()
+	mock.ExpectExec(stmtInsertDocs).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_TAGS").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id FROM TAGS").WillReturnError(Err)
+	mock.ExpectRollback()
+
+	if _, err = rw.Save(item, persistence.Atomic{}); err == nil {
+		t.Errorf(errInsert)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
 }
 
 func TestRead(t *testing.T) {
@@ -309,6 +347,10 @@ func TestDelete(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM SEARCH_INDEX").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_TAGS").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_SENDERS").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_VERSIONS").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(stmt).WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -319,6 +361,10 @@ func TestDelete(t *testing.T) {
 
 	// externally supplied tx
 	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM SEARCH_INDEX").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_TAGS").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_SENDERS").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM DOCUMENT_VERSIONS").WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec(stmt).WithArgs(item.ID).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	a, err := c.CreateAtomic()
@@ -520,39 +566,25 @@ func TestSearchLists(t *testing.T) {
 	dbx := sqlx.NewDb(db, "mysql")
 	c := persistence.NewFromDB(dbx)
 	rw := dbRepository{c}
-	q := "SELECT distinct\\(taglist\\) as search FROM DOCUMENTS"
-	columns := []string{"search"}
+	q := "SELECT l.name FROM TAGS l WHERE l.normalized LIKE \\? ESCAPE '!' AND EXISTS \\(SELECT 1 FROM DOCUMENT_TAGS"
+	columns := []string{"name"}
 	searchErr := "error searching: %v"
 
 	// multiple
-	mock.ExpectQuery(q).WillReturnRows(sqlmock.NewRows(columns).AddRow("tag1").AddRow("tag2").AddRow("tag1;tag3"))
-	tags, err := rw.SearchLists("tag", TAGS)
+	mock.ExpectQuery(q).WithArgs("tag%").WillReturnRows(sqlmock.NewRows(columns).AddRow("tag3").AddRow("tag1").AddRow("Tag2"))
+	tags, err := rw.SearchLists("Tag", TAGS)
 	if err != nil {
 		t.Errorf(searchErr, err)
 	}
+	assert.Equal(t, []string{"Tag2", "tag1", "tag3"}, tags)
 
-	if len(tags) != 3 {
-		t.Errorf("3 entries expected, got %d", len(tags))
-	}
-
-	if tags[0] != "tag1" || tags[1] != "tag2" || tags[2] != "tag3" {
-		t.Errorf("wrong tags returned from search")
-	}
-
-	// single
-	mock.ExpectQuery(q).WillReturnRows(sqlmock.NewRows(columns).AddRow("tag1").AddRow("tag2").AddRow("tag1;tag3"))
-	tags, err = rw.SearchLists("tag2", TAGS)
+	// wildcards are escaped
+	mock.ExpectQuery(q).WithArgs("100!%!_!!%").WillReturnRows(sqlmock.NewRows(columns))
+	tags, err = rw.SearchLists("100%_!", TAGS)
 	if err != nil {
 		t.Errorf(searchErr, err)
 	}
-
-	if len(tags) != 1 {
-		t.Errorf("1 entries expected, got %d", len(tags))
-	}
-
-	if tags[0] != "tag2" {
-		t.Errorf("wrong tags returned from search")
-	}
+	assert.Equal(t, 0, len(tags))
 
 	// error1
 	mock.ExpectQuery(q).WillReturnError(Err)
@@ -561,24 +593,59 @@ func TestSearchLists(t *testing.T) {
 		t.Errorf(expectedErr)
 	}
 
-	// multiple
-	mock.ExpectQuery("SELECT distinct\\(senderlist\\) as search FROM DOCUMENTS").WillReturnRows(sqlmock.NewRows(columns).AddRow("sender1").AddRow("sender2").AddRow("sender1;sender3"))
+	// senders
+	mock.ExpectQuery("SELECT l.name FROM SENDERS l .* FROM DOCUMENT_SENDERS j WHERE j.sender_id = l.id").WithArgs("sender%").WillReturnRows(sqlmock.NewRows(columns).AddRow("sender1").AddRow("sender2"))
 	senders, err := rw.SearchLists("sender", SENDERS)
 	if err != nil {
 		t.Errorf(searchErr, err)
 	}
+	assert.Equal(t, []string{"sender1", "sender2"}, senders)
+
+	// we make sure that all expectations were met
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+
+}
+
+func TestSearchPostgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	dbx := sqlx.NewDb(db, "postgres")
+	c := persistence.NewFromDB(dbx)
+	rw := dbRepository{c}
+	columns := []string{"id", "title", "filename", "alternativeid", "previewlink", "amount", "taglist", "senderlist", "created", "modified", "invoicenumber"}
+
+	search := DocSearch{
+		Skip:  10,
+		Limit: 5,
+		Title: "title",
+	}
 
-	if len(senders) != 3 {
-		t.Errorf("3 entries expected, got %d", len(senders))
+	cr := sqlmock.NewRows([]string{"count(id)"}).AddRow(1)
+	mock.ExpectQuery("SELECT count\\(id\\) FROM DOCUMENTS\\s+WHERE 1=1\\s+AND .* LIKE \\$1").WithArgs("%title%", "%title%", "%title%", "%title%", "%title%").WillReturnRows(cr)
+	dr := sqlmock.NewRows(columns).
+		AddRow("id", "title", "filename", "altid", nil, 1.0, "tags", "senders", time.Now().UTC(), nil, nil)
+	mock.ExpectQuery(queryDocs+".*LIMIT \\$6\\s+OFFSET \\$7").WithArgs("%title%", "%title%", "%title%", "%title%", "%title%", 5, 10).WillReturnRows(dr)
+
+	doc, err := rw.Search(search, []OrderBy{{Order: DESC, Field: "created"}})
+	if err != nil {
+		t.Errorf("could not query documents: %v", err)
 	}
+	assert.Equal(t, 1, doc.Count)
+	assert.Equal(t, 1, len(doc.Documents))
 
-	if senders[0] != "sender1" || senders[1] != "sender2" || senders[2] != "sender3" {
-		t.Errorf("wrong senders returned from search")
+	// query parameters are bound using the postgres syntax
+	mock.ExpectQuery(queryDocs + " WHERE id=\\$1").WithArgs("id").WillReturnError(fmt.Errorf("error"))
+	if _, err := rw.Get("id"); err == nil {
+		t.Errorf(expectedErr)
 	}
 
-	// we make sure that all expectations were met
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf(expectations, err)
 	}
-
 }
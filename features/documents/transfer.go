@@ -0,0 +1,287 @@
+package documents
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/persistence"
+	log "github.com/sirupsen/logrus"
+)
+
+// TransferOptions defines how the files are copied to the target filestore
+type TransferOptions struct {
+	// Rewrite returns the path of a file in the target filestore, the path is kept if no function is defined
+	Rewrite func(filePath string) string
+	// Rename updates the documents and versions with the rewritten paths, after all files were copied
+	// the documents must not be changed during the transfer, e.g. the application is stopped
+	Rename bool
+	// Journal is the path of a file which records the copied files with their target path
+	// files recorded by a previous run are skipped, no journal is used if empty
+	Journal string
+	// Progress is called for each processed file
+	Progress func(TransferProgress)
+}
+
+// TransferProgress describes a processed file
+type TransferProgress struct {
+	// Current is the number of the file, starting with 1
+	Current int
+	Total   int
+	// FileName is the path in the source filestore, Target is the path in the target filestore
+	FileName string
+	Target   string
+	Size     int64
+	// Skipped indicates a file copied by a previous run
+	Skipped bool
+	Err     error
+}
+
+// TransferResult summarizes the copied files
+type TransferResult struct {
+	Total   int
+	Copied  int
+	Skipped int
+	// Renamed is the number of files with a rewritten path, which were updated in the documents and versions
+	Renamed int
+	Bytes   int64
+	// Failed are the files which were not copied, the transfer can be started again to copy them
+	Failed []string
+}
+
+// Transfer copies the files of the documents from one filestore to another
+type Transfer struct {
+	h       *Handler
+	target  filestore.FileService
+	options TransferOptions
+}
+
+// NewTransfer returns a transfer of the files of the documents from the source to the target filestore
+func NewTransfer(repos Repositories, source, target filestore.FileService, options TransferOptions) *Transfer {
+	return &Transfer{h: NewHandler(repos, source, upload.Config{}), target: target, options: options}
+}
+
+// Run copies the files of all documents and versions, including the previews
+// a file is verified by the SHA-256 of the copy, which needs to match the source file and the hash of the document
+// nothing is copied if the rewritten paths collide with each other or with the paths of other files
+func (t *Transfer) Run() (TransferResult, error) {
+	var result TransferResult
+	refs, err := t.h.docRepo.FileReferences()
+	if err != nil {
+		return result, err
+	}
+	hashes := make(map[string]string)
+	for _, ref := range refs {
+		if _, ok := hashes[ref.FileName]; !ok || hashes[ref.FileName] == "" {
+			hashes[ref.FileName] = ref.Hash.String
+		}
+	}
+	files := make([]string, 0, len(hashes))
+	for f := range hashes {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	done, err := readJournal(t.options.Journal)
+	if err != nil {
+		return result, err
+	}
+	// files of the documents renamed by a previous run were copied with their source path
+	renamed := make(map[string]bool)
+	for source, target := range done {
+		if _, ok := hashes[source]; !ok && target != source {
+			renamed[target] = true
+		}
+	}
+	targets := make(map[string]string, len(files))
+	for _, f := range files {
+		if target, ok := done[f]; ok {
+			targets[f] = target
+		} else if renamed[f] {
+			targets[f] = f
+		} else {
+			targets[f] = t.targetPath(f)
+		}
+	}
+	if err = collisions(files, targets); err != nil {
+		return result, err
+	}
+
+	var journal *os.File
+	if t.options.Journal != "" {
+		if journal, err = os.OpenFile(t.options.Journal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640); err != nil {
+			return result, fmt.Errorf("could not open the journal '%s': %v", t.options.Journal, err)
+		}
+		defer journal.Close()
+	}
+
+	result.Total = len(files)
+	for i, f := range files {
+		p := TransferProgress{Current: i + 1, Total: len(files), FileName: f, Target: targets[f]}
+		if _, ok := done[f]; ok || renamed[f] {
+			p.Skipped = true
+			result.Skipped++
+		} else if p.Size, p.Err = t.copy(f, p.Target, hashes[f]); p.Err != nil {
+			log.Errorf("could not copy the file '%s': %v", f, p.Err)
+			result.Failed = append(result.Failed, f)
+		} else {
+			result.Copied++
+			result.Bytes += p.Size
+			if journal != nil {
+				if _, err = fmt.Fprintf(journal, "%s\t%s\n", f, p.Target); err != nil {
+					return result, fmt.Errorf("could not write the journal '%s': %v", t.options.Journal, err)
+				}
+			}
+		}
+		if t.options.Progress != nil {
+			t.options.Progress(p)
+		}
+	}
+
+	// the paths are only changed if all files are available in the target filestore
+	if !t.options.Rename || len(result.Failed) > 0 {
+		return result, nil
+	}
+	for _, f := range files {
+		if targets[f] == f || renamed[f] {
+			continue
+		}
+		if err = t.h.docRepo.RenameFile(f, targets[f], persistence.Atomic{}); err != nil {
+			log.Errorf("could not rename the file '%s' of the documents: %v", f, err)
+			result.Failed = append(result.Failed, f)
+			continue
+		}
+		result.Renamed++
+	}
+	return result, nil
+}
+
+// collisions checks that each file has its own target path, which is not the path of another file
+func collisions(files []string, targets map[string]string) error {
+	sources := make(map[string]string, len(files))
+	for _, f := range files {
+		target := targets[f]
+		if other, ok := sources[target]; ok {
+			return fmt.Errorf("the files '%s' and '%s' have the same target path '%s'", other, f, target)
+		}
+		sources[target] = f
+	}
+	for _, f := range files {
+		target := targets[f]
+		if _, ok := targets[target]; ok && target != f {
+			return fmt.Errorf("the target path '%s' of the file '%s' is the path of another file", target, f)
+		}
+	}
+	return nil
+}
+
+// copy saves the file in the target filestore and verifies the copy
+func (t *Transfer) copy(fileName, target, hash string) (int64, error) {
+	folder, name := path.Split(target)
+	folder = strings.Trim(folder, "/")
+	if folder == "" || name == "" || strings.Contains(folder, "/") {
+		return 0, fmt.Errorf("invalid target path '%s', the form /FolderName/FileName is needed", target)
+	}
+
+	stream, err := t.h.fs.OpenFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+	sum := sha256.New()
+	payload, err := ioutil.ReadAll(io.TeeReader(stream, sum))
+	if err != nil {
+		return 0, fmt.Errorf("could not read the file: %v", err)
+	}
+	checksum := hex.EncodeToString(sum.Sum(nil))
+	if hash != "" && hash != checksum {
+		return 0, fmt.Errorf("the file differs from the hash of the document: %s, expected %s", checksum, hash)
+	}
+
+	err = t.target.SaveFile(filestore.FileItem{FileName: name, FolderName: folder, MimeType: stream.MimeType, Payload: payload})
+	if err != nil {
+		return 0, err
+	}
+	copied, err := fileChecksum(t.target, target)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the copy: %v", err)
+	}
+	if copied != checksum {
+		return 0, fmt.Errorf("the copy differs from the file: %s, expected %s", copied, checksum)
+	}
+
+	// the preview is created on demand, a missing preview is not an error
+	if thumbnail, err := t.h.fs.GetFile(thumbnailPath(fileName)); err == nil {
+		err = t.target.SaveFile(filestore.FileItem{FileName: name + thumbnailSuffix, FolderName: folder, MimeType: thumbnailType, Payload: thumbnail.Payload})
+		if err != nil {
+			log.Warnf("could not copy the preview of '%s': %v", fileName, err)
+		}
+	}
+	return int64(len(payload)), nil
+}
+
+// targetPath returns the path of the file in the target filestore
+func (t *Transfer) targetPath(fileName string) string {
+	if t.options.Rewrite == nil {
+		return fileName
+	}
+	return t.options.Rewrite(fileName)
+}
+
+// PathRewrite returns a function which replaces the matches of the regular expression in a path
+// the replacement can reference the groups of the expression, e.g. "$1"
+func PathRewrite(expr, replacement string) (func(string) string, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression to rewrite the paths '%s': %v", expr, err)
+	}
+	return func(filePath string) string {
+		return re.ReplaceAllString(filePath, replacement)
+	}, nil
+}
+
+// readJournal returns the files recorded in the journal with their target path, a missing journal is empty
+// each line of the journal has the form "FileName<TAB>Target"
+func readJournal(journal string) (map[string]string, error) {
+	done := make(map[string]string)
+	if journal == "" {
+		return done, nil
+	}
+	f, err := os.Open(journal)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the journal '%s': %v", journal, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "\t")
+		switch len(fields) {
+		case 1:
+			if fields[0] != "" {
+				done[fields[0]] = fields[0]
+			}
+		case 2:
+			done[fields[0]] = fields[1]
+		default:
+			return nil, fmt.Errorf("invalid entry in the journal '%s': %s", journal, scanner.Text())
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read the journal '%s': %v", journal, err)
+	}
+	return done, nil
+}
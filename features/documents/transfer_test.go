@@ -0,0 +1,210 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransfer(t *testing.T) {
+	sum := sha256.Sum256([]byte(pdfPayload))
+	hash := sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true}
+
+	mdr := newDocRepo(persistence.Connection{})
+	mdr.references = []FileReference{
+		{DocumentID: "invoice", FileName: "/2020_01_01/invoice.pdf", Hash: hash},
+		{DocumentID: "invoice", Version: 1, FileName: "/2020_01_01/invoice.pdf", Hash: hash},
+		{DocumentID: "contract", FileName: "/2020_01_01/contract.pdf"},
+	}
+	source, target := newFileService(), newFileService()
+	repos := Repositories{DocRepo: mdr}
+
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatalf("could not create a temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, "transfer.journal")
+
+	// the files are copied once, including the previews
+	var progress []TransferProgress
+	options := TransferOptions{Journal: journal, Progress: func(p TransferProgress) { progress = append(progress, p) }}
+	result, err := NewTransfer(repos, source, target, options).Run()
+	if err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 2, result.Total)
+	assert.Equal(t, 2, result.Copied)
+	assert.Equal(t, 0, len(result.Failed))
+	assert.Equal(t, int64(2*len(pdfPayload)), result.Bytes)
+	assert.Equal(t, 4, source.callCount)
+	assert.Equal(t, 6, target.callCount)
+	if assert.Equal(t, 2, len(progress)) {
+		assert.Equal(t, "/2020_01_01/contract.pdf", progress[0].FileName)
+		assert.Equal(t, 2, progress[1].Current)
+		assert.Equal(t, 2, progress[1].Total)
+	}
+
+	// the files of the journal are skipped
+	source.callCount, target.callCount = 0, 0
+	if result, err = NewTransfer(repos, source, target, options).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 0, result.Copied)
+	assert.Equal(t, 0, source.callCount)
+	assert.Equal(t, 0, target.callCount)
+
+	// the file differs from the hash of the document
+	mdr.references[0].Hash = sql.NullString{String: "0815", Valid: true}
+	if result, err = NewTransfer(repos, source, target, TransferOptions{}).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, []string{"/2020_01_01/invoice.pdf"}, result.Failed)
+	assert.Equal(t, 1, result.Copied)
+
+	// error saving the copy
+	mdr.references[0].Hash = hash
+	source.callCount, target.callCount = 0, 0
+	target.errMap[1] = errRaise
+	if result, err = NewTransfer(repos, source, target, TransferOptions{}).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, []string{"/2020_01_01/contract.pdf"}, result.Failed)
+	delete(target.errMap, 1)
+
+	// invalid target path
+	options = TransferOptions{Rewrite: func(f string) string { return strings.TrimPrefix(f, "/2020_01_01") }}
+	if result, err = NewTransfer(repos, source, target, options).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 2, len(result.Failed))
+
+	// nothing is copied if the target paths collide
+	source.callCount, target.callCount = 0, 0
+	options = TransferOptions{Rewrite: func(string) string { return "/2020/invoice.pdf" }}
+	if _, err = NewTransfer(repos, source, target, options).Run(); err == nil {
+		t.Errorf(errExp)
+	}
+	swap := map[string]string{"/2020_01_01/invoice.pdf": "/2020_01_01/contract.pdf", "/2020_01_01/contract.pdf": "/2020_01_01/invoice.pdf"}
+	options = TransferOptions{Rewrite: func(f string) string { return swap[f] }}
+	if _, err = NewTransfer(repos, source, target, options).Run(); err == nil {
+		t.Errorf(errExp)
+	}
+	assert.Equal(t, 0, source.callCount)
+	assert.Equal(t, 0, target.callCount)
+
+	// error reading the references
+	mdr.fail = true
+	if _, err = NewTransfer(repos, source, target, TransferOptions{}).Run(); err == nil {
+		t.Errorf(errExp)
+	}
+}
+
+func TestTransferRewrite(t *testing.T) {
+	mdr := newDocRepo(persistence.Connection{})
+	mdr.references = []FileReference{
+		{DocumentID: "invoice", FileName: "/2020_01_01/invoice.pdf"},
+		{DocumentID: "contract", FileName: "/2020_02_01/contract.pdf"},
+	}
+	source, target := newFileService(), newFileService()
+	repos := Repositories{DocRepo: mdr}
+
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatalf("could not create a temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, "transfer.journal")
+
+	if _, err = PathRewrite("(", ""); err == nil {
+		t.Errorf(errExp)
+	}
+	rewrite, err := PathRewrite(`^/(\d{4})_\d{2}_\d{2}/`, "/$1/")
+	if err != nil {
+		t.Fatalf("could not create the rewrite: %v", err)
+	}
+
+	// the documents are not renamed if a file could not be copied
+	target.errMap[1] = errRaise
+	options := TransferOptions{Rewrite: rewrite, Rename: true}
+	result, err := NewTransfer(repos, source, target, options).Run()
+	if err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 1, len(result.Failed))
+	assert.Equal(t, 0, result.Renamed)
+	assert.Equal(t, 0, len(mdr.renamed))
+	delete(target.errMap, 1)
+
+	// the files are copied without renaming the documents
+	options = TransferOptions{Rewrite: rewrite, Journal: journal}
+	if result, err = NewTransfer(repos, source, target, options).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 2, result.Copied)
+	assert.Equal(t, 0, result.Renamed)
+	assert.Equal(t, 0, len(mdr.renamed))
+
+	// the documents of the first file cannot be renamed
+	mdr.errMap[1] = errRaise
+	options.Rename = true
+	source.callCount, target.callCount = 0, 0
+	if result, err = NewTransfer(repos, source, target, options).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 1, result.Renamed)
+	assert.Equal(t, []string{"/2020_01_01/invoice.pdf"}, result.Failed)
+	assert.Equal(t, map[string]string{"/2020_02_01/contract.pdf": "/2020/contract.pdf"}, mdr.renamed)
+	assert.Equal(t, 0, source.callCount)
+	assert.Equal(t, 0, target.callCount)
+
+	// the renamed file is skipped, the documents of the other file are renamed
+	delete(mdr.errMap, 1)
+	mdr.callCount = 0
+	mdr.references[1].FileName = "/2020/contract.pdf"
+	if result, err = NewTransfer(repos, source, target, options).Run(); err != nil {
+		t.Fatalf("could not transfer the files: %v", err)
+	}
+	assert.Equal(t, 2, result.Skipped)
+	assert.Equal(t, 1, result.Renamed)
+	assert.Equal(t, 0, len(result.Failed))
+	assert.Equal(t, "/2020/invoice.pdf", mdr.renamed["/2020_01_01/invoice.pdf"])
+	assert.Equal(t, 0, source.callCount)
+}
+
+func TestReadJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatalf("could not create a temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, "transfer.journal")
+
+	// a missing journal is empty
+	done, err := readJournal(journal)
+	if err != nil {
+		t.Fatalf("could not read the journal: %v", err)
+	}
+	assert.Equal(t, 0, len(done))
+
+	ioutil.WriteFile(journal, []byte("/A/a.pdf\n/B/b.pdf\t/C/b.pdf\n\n"), 0640)
+	if done, err = readJournal(journal); err != nil {
+		t.Fatalf("could not read the journal: %v", err)
+	}
+	assert.Equal(t, map[string]string{"/A/a.pdf": "/A/a.pdf", "/B/b.pdf": "/C/b.pdf"}, done)
+
+	ioutil.WriteFile(journal, []byte("/A/a.pdf\t/B/a.pdf\t/C/a.pdf\n"), 0640)
+	if _, err = readJournal(journal); err == nil {
+		t.Errorf(errExp)
+	}
+}
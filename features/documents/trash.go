@@ -0,0 +1,229 @@
+package documents
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// TrashConfig defines how long deleted documents are kept in the trash
+type TrashConfig struct {
+	// Retention defines how long a document is kept in the trash before it is purged
+	// documents are only purged manually if no retention is defined
+	Retention time.Duration
+	// Interval defines how often expired documents are purged
+	Interval time.Duration
+}
+
+// GetTrash godoc
+// @Summary get the trashed documents
+// @Description lists the deleted documents, which are not purged yet. the most recently deleted documents are returned first
+// @Tags documents
+// @Produce  json
+// @Success 200 {object} documents.PagedDcoument
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/documents/trash [get]
+func (h *Handler) GetTrash(c echo.Context) error {
+	docs, err := h.docRepo.Trashed(time.Time{})
+	if err != nil {
+		log.Warnf("could not get the trashed documents, %v", err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+	return c.JSON(http.StatusOK, PagedDcoument{
+		TotalEntries: len(docs),
+		Documents:    convertList(h.policy, docs),
+	})
+}
+
+// RestoreDocument godoc
+// @Summary restore a trashed document
+// @Description moves the deleted document out of the trash
+// @Tags documents
+// @Param id path string true "document ID"
+// @Success 200 {object} documents.Result
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/documents/trash/{id}/restore [post]
+func (h *Handler) RestoreDocument(c echo.Context) (err error) {
+	id := c.Param("id")
+
+	atomic, err := h.startAtomic(c)
+	if err != nil {
+		return
+	}
+
+	// complete the atomic method
+	defer func() {
+		err = persistence.HandleTX(true, &atomic, err)
+	}()
+
+	if _, err = h.docRepo.InTrash(id, atomic); err != nil {
+		log.Warnf("the document '%s' is not available in the trash, %v", id, err)
+		err = fmt.Errorf("document '%s' not available in the trash", id)
+		return errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+	if err = h.docRepo.Untrash(id, atomic); err != nil {
+		log.Warnf("could not restore document '%s', %v", id, err)
+		err = fmt.Errorf("could not restore '%s', %v", id, err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+
+	return c.JSON(http.StatusOK, Result{
+		Message: fmt.Sprintf("Document with id '%s' was restored.", id),
+		Result:  Updated,
+	})
+}
+
+// PurgeDocument godoc
+// @Summary purge a trashed document
+// @Description permanently deletes the document, its versions and the files of the document
+// @Description the files are deleted after the document, a failed delete is retried later on
+// @Tags documents
+// @Param id path string true "document ID"
+// @Success 200 {object} documents.Result
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/documents/trash/{id} [delete]
+func (h *Handler) PurgeDocument(c echo.Context) (err error) {
+	id := c.Param("id")
+
+	atomic, err := h.startAtomic(c)
+	if err != nil {
+		return
+	}
+
+	// complete the atomic method, the files are deleted after the commit
+	var pending []OutboxEntity
+	defer func() {
+		if err = persistence.HandleTX(true, &atomic, err); err == nil {
+			h.deliver(pending)
+		}
+	}()
+
+	fileName, err := h.docRepo.InTrash(id, atomic)
+	if err != nil {
+		log.Warnf("the document '%s' is not available in the trash, %v", id, err)
+		err = fmt.Errorf("document '%s' not available in the trash", id)
+		return errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+	if pending, err = h.purge(id, fileName, atomic); err != nil {
+		err = fmt.Errorf("could not purge '%s', %v", id, err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+
+	return c.JSON(http.StatusOK, Result{
+		Message: fmt.Sprintf("Document with id '%s' was deleted.", id),
+		Result:  Deleted,
+	})
+}
+
+// purge deletes the document with its versions, the deletes of the stored files are added to the outbox
+// the returned entries are delivered after the transaction was committed
+func (h *Handler) purge(id, fileName string, atomic persistence.Atomic) ([]OutboxEntity, error) {
+	versions, err := h.docRepo.Versions(id, atomic)
+	if err != nil {
+		log.Warnf("could not get the versions of '%s', %v", id, err)
+		return nil, err
+	}
+
+	if err = h.docRepo.Delete(id, atomic); err != nil {
+		log.Warnf("error during delete operation of '%s', %v", id, err)
+		return nil, err
+	}
+
+	pending, err := h.docRepo.Enqueue(documentFiles(fileName, versions), atomic)
+	if err != nil {
+		log.Errorf("could not add the files of '%s' to the outbox, %v", id, err)
+		return nil, err
+	}
+	return pending, nil
+}
+
+// --------------------------------------------------------------------------
+// automatic purge
+// --------------------------------------------------------------------------
+
+// Purger permanently deletes documents which are kept in the trash longer than the retention
+type Purger struct {
+	h      *Handler
+	config TrashConfig
+}
+
+// NewPurger returns a purger for the trashed documents of the repository
+func NewPurger(repos Repositories, fs filestore.FileService, config TrashConfig) *Purger {
+	return &Purger{h: NewHandler(repos, fs, upload.Config{}), config: config}
+}
+
+// Start periodically purges the expired documents until the context is done, wg is done when the worker returned
+// nothing is done if no retention is defined
+func (p *Purger) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if p.config.Retention <= 0 {
+		log.Info("no retention defined, trashed documents are not purged")
+		return
+	}
+	interval := p.config.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := p.Purge(); err != nil {
+				log.Errorf("could not purge trashed documents: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Purge deletes the documents moved to the trash before the retention and returns their ids
+// a document which cannot be purged is skipped and purged again the next time
+func (p *Purger) Purge() ([]string, error) {
+	if p.config.Retention <= 0 {
+		return nil, fmt.Errorf("no retention defined")
+	}
+	docs, err := p.h.docRepo.Trashed(time.Now().UTC().Add(-p.config.Retention))
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	for _, d := range docs {
+		var pending []OutboxEntity
+		atomic, err := p.h.docRepo.CreateAtomic()
+		if err == nil {
+			pending, err = p.h.purge(d.ID, d.FileName, atomic)
+			err = persistence.HandleTX(true, &atomic, err)
+		}
+		if err != nil {
+			log.Errorf("could not purge document '%s': %v", d.ID, err)
+			continue
+		}
+		p.h.deliver(pending)
+		log.Infof("purged document '%s' deleted at %s", d.ID, d.Deleted.Time.Format(time.RFC3339))
+		purged = append(purged, d.ID)
+	}
+	return purged, nil
+}
@@ -0,0 +1,232 @@
+package documents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func trashedDocument(id string, deleted time.Time) DocumentEntity {
+	return DocumentEntity{
+		ID:       id,
+		Title:    id,
+		FileName: "/2020_01_01/" + id + ".pdf",
+		Created:  deleted.Add(-time.Hour),
+		Deleted:  sql.NullTime{Time: deleted, Valid: true},
+	}
+}
+
+func TestGetTrash(t *testing.T) {
+	e := echo.New()
+	mdr := &mockRepository{trashed: []DocumentEntity{
+		trashedDocument("invoice", time.Now().UTC()),
+		trashedDocument("contract", time.Now().UTC().Add(-time.Hour)),
+	}}
+	h := NewHandler(Repositories{DocRepo: mdr}, newFileService(), uploadConfig)
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+	if err := h.GetTrash(c); err != nil {
+		t.Errorf("cannot get trash: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result PagedDcoument
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, 2, result.TotalEntries)
+	assert.Equal(t, "invoice", result.Documents[0].Title)
+	assert.NotEqual(t, "", result.Documents[0].Deleted)
+
+	// error result
+	mdr.fail = true
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Error(t, h.GetTrash(c))
+}
+
+func TestRestoreDocument(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	e := echo.New()
+	newReq := func(id string) (*httptest.ResponseRecorder, echo.Context) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return rec, c
+	}
+	mdr := newDocRepo(persistence.NewFromDB(sqlx.NewDb(db, "mysql")))
+	h := NewHandler(Repositories{DocRepo: mdr}, newFileService(), uploadConfig)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	rec, c := newReq(ID)
+	if err := h.RestoreDocument(c); err != nil {
+		t.Errorf("cannot restore document: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// not in the trash
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	_, c = newReq(notExists)
+	err = h.RestoreDocument(c)
+	_, ok := err.(errors.NotFoundError)
+	assert.True(t, ok, "not found expected")
+
+	// error restore
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mdr.callCount = 0
+	mdr.errMap[3] = errRaise
+	_, c = newReq(ID)
+	assert.Error(t, h.RestoreDocument(c))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
+
+func TestPurgeDocument(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	e := echo.New()
+	newReq := func(id string) (*httptest.ResponseRecorder, echo.Context) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return rec, c
+	}
+	mdr := newDocRepo(persistence.NewFromDB(sqlx.NewDb(db, "mysql")))
+	mdr.versions = testVersions()
+	svc := newFileService()
+	h := NewHandler(Repositories{DocRepo: mdr}, svc, uploadConfig)
+
+	// the file, the preview and the files of the versions are deleted
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	rec, c := newReq(ID)
+	if err := h.PurgeDocument(c); err != nil {
+		t.Errorf("cannot purge document: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 6, svc.callCount)
+
+	// not in the trash
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	_, c = newReq(notExists)
+	err = h.PurgeDocument(c)
+	_, ok := err.(errors.NotFoundError)
+	assert.True(t, ok, "not found expected")
+
+	// error delete
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	_, c = newReq(noDelete)
+	assert.Error(t, h.PurgeDocument(c))
+
+	assert.Equal(t, 0, len(mdr.outbox))
+
+	// error file delete - the document is purged, the delete is retried
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	svc.callCount = 0
+	svc.errMap[1] = errRaise
+	_, c = newReq(noFileDelete)
+	assert.NoError(t, h.PurgeDocument(c))
+	if assert.Equal(t, 1, len(mdr.outbox)) {
+		assert.Equal(t, noFileDelete, mdr.outbox[0].Path)
+		assert.Equal(t, 1, mdr.outbox[0].Attempts)
+	}
+
+	// error outbox
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mdr.callCount = 0
+	mdr.errMap[5] = errRaise
+	_, c = newReq(ID)
+	assert.Error(t, h.PurgeDocument(c))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
+
+func TestPurger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	mdr := newDocRepo(persistence.NewFromDB(sqlx.NewDb(db, "mysql")))
+	mdr.trashed = []DocumentEntity{
+		trashedDocument("recent", now.Add(-time.Hour)),
+		trashedDocument("expired", now.Add(-48*time.Hour)),
+		trashedDocument("failed", now.Add(-72*time.Hour)),
+	}
+	svc := newFileService()
+	repos := Repositories{DocRepo: mdr}
+
+	if _, err := NewPurger(repos, svc, TrashConfig{}).Purge(); err == nil {
+		t.Errorf("error without retention expected")
+	}
+
+	// the file of the second expired document cannot be deleted, the delete is retried
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	svc.errMap[3] = errRaise
+	purged, err := NewPurger(repos, svc, TrashConfig{Retention: 24 * time.Hour}).Purge()
+	if err != nil {
+		t.Fatalf("could not purge documents: %v", err)
+	}
+	assert.Equal(t, []string{"expired", "failed"}, purged)
+	if assert.Equal(t, 1, len(mdr.outbox)) {
+		assert.Equal(t, "/2020_01_01/failed.pdf", mdr.outbox[0].Path)
+	}
+
+	// the document is kept if the outbox fails
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mdr.trashed = mdr.trashed[2:]
+	mdr.callCount = 0
+	mdr.errMap[4] = errRaise
+	purged, err = NewPurger(repos, svc, TrashConfig{Retention: 24 * time.Hour}).Purge()
+	if err != nil {
+		t.Fatalf("could not purge documents: %v", err)
+	}
+	assert.Equal(t, 0, len(purged))
+
+	// error reading the trash
+	mdr.fail = true
+	if _, err := NewPurger(repos, svc, TrashConfig{Retention: 24 * time.Hour}).Purge(); err == nil {
+		t.Errorf(errExp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
@@ -0,0 +1,178 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// VerifyReport is the result of the verification of the stored files
+type VerifyReport struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Checksums indicates that the SHA-256 of the files was compared with the hash of the documents
+	Checksums bool `json:"checksums"`
+	// References is the number of files of the documents and versions, including the trashed documents
+	References int `json:"references"`
+	// Files is the number of stored files
+	Files int `json:"files"`
+	// Unverified is the number of files without a hash, only their existence is checked
+	Unverified int `json:"unverified"`
+	// Missing are the files of documents which are not available
+	Missing []VerifyEntry `json:"missing"`
+	// Changed are the files of documents which are empty, cannot be read or differ from the hash
+	Changed []VerifyEntry `json:"changed"`
+	// Orphans are the stored files without a document
+	Orphans []VerifyEntry `json:"orphans"`
+	// Valid is true if no problem was found
+	Valid bool `json:"valid"`
+}
+
+// VerifyEntry is a file with a problem found by the verification
+type VerifyEntry struct {
+	DocumentID string `json:"documentId,omitempty"`
+	// Version is 0 for the current file of the document
+	Version  int    `json:"version,omitempty"`
+	FileName string `json:"fileName"`
+	Size     int64  `json:"size,omitempty"`
+	// Expected is the hash of the document, Actual is the SHA-256 of the stored file
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Verifier checks that the files of the documents are available and unchanged
+type Verifier struct {
+	h *Handler
+}
+
+// NewVerifier returns a verifier for the documents of the repository and the filestore
+func NewVerifier(repos Repositories, fs filestore.FileService) *Verifier {
+	return &Verifier{h: NewHandler(repos, fs, upload.Config{})}
+}
+
+// Verify compares the files of the documents with the stored files
+// the SHA-256 of the files is compared with the hash of the documents if checksums are requested,
+// otherwise the existence and the size of the files is checked
+func (v *Verifier) Verify(checksums bool) (VerifyReport, error) {
+	return v.h.verify(checksums)
+}
+
+// VerifyFiles godoc
+// @Summary verify the stored files
+// @Description checks that the files of all documents and versions exist and are unchanged, and lists the stored files without a document
+// @Description the SHA-256 of the files is compared with the hash of the documents if checksums are requested
+// @Tags admin
+// @Produce  json
+// @Param checksums query bool false "compare the checksums of the files"
+// @Success 200 {object} documents.VerifyReport
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/admin/verify [get]
+func (h *Handler) VerifyFiles(c echo.Context) error {
+	report, err := h.verify(c.QueryParam("checksums") == "true")
+	if err != nil {
+		log.Errorf("could not verify the stored files, %v", err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *Handler) verify(checksums bool) (VerifyReport, error) {
+	report := VerifyReport{
+		Started:   time.Now().UTC(),
+		Checksums: checksums,
+		Missing:   make([]VerifyEntry, 0),
+		Changed:   make([]VerifyEntry, 0),
+		Orphans:   make([]VerifyEntry, 0),
+	}
+	refs, err := h.docRepo.FileReferences()
+	if err != nil {
+		return report, err
+	}
+	files, err := h.fs.ListFiles()
+	if err != nil {
+		return report, err
+	}
+	report.References = len(refs)
+	report.Files = len(files)
+
+	stored := make(map[string]filestore.FileEntry)
+	for _, f := range files {
+		stored[f.Path] = f
+	}
+	// a file is only read once, it is used by all versions of a document which did not change the file
+	sums := make(map[string]string)
+	for _, ref := range refs {
+		entry := VerifyEntry{DocumentID: ref.DocumentID, Version: ref.Version, FileName: ref.FileName}
+		f, ok := stored[storePath(ref.FileName)]
+		if !ok {
+			report.Missing = append(report.Missing, entry)
+			continue
+		}
+		entry.Size = f.Size
+		if f.Size == 0 {
+			entry.Error = "the file is empty"
+			report.Changed = append(report.Changed, entry)
+			continue
+		}
+		if !ref.Hash.Valid || ref.Hash.String == "" {
+			report.Unverified++
+			continue
+		}
+		if !checksums {
+			continue
+		}
+
+		sum, ok := sums[f.Path]
+		if !ok {
+			if sum, err = fileChecksum(h.fs, f.Path); err != nil {
+				entry.Error = err.Error()
+				report.Changed = append(report.Changed, entry)
+				continue
+			}
+			sums[f.Path] = sum
+		}
+		if sum != ref.Hash.String {
+			entry.Expected, entry.Actual = ref.Hash.String, sum
+			report.Changed = append(report.Changed, entry)
+		}
+	}
+
+	referenced := referencedFiles(refs)
+	for _, f := range files {
+		if !referenced[f.Path] {
+			report.Orphans = append(report.Orphans, VerifyEntry{FileName: f.Path, Size: f.Size})
+		}
+	}
+
+	report.Valid = len(report.Missing) == 0 && len(report.Changed) == 0 && len(report.Orphans) == 0
+	report.Finished = time.Now().UTC()
+	log.Infof("verified %d files of documents: %d missing, %d changed, %d orphaned files", report.References, len(report.Missing), len(report.Changed), len(report.Orphans))
+	return report, nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the stored file
+func fileChecksum(fs filestore.FileService, filePath string) (string, error) {
+	stream, err := fs.OpenFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, stream); err != nil {
+		return "", fmt.Errorf("could not read the file '%s': %v", filePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
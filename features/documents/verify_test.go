@@ -0,0 +1,133 @@
+package documents
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func verifyFixture() (*mockRepository, *mockFileService) {
+	sum := sha256.Sum256([]byte(pdfPayload))
+	hash := sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true}
+
+	mdr := newDocRepo(persistence.Connection{})
+	mdr.references = []FileReference{
+		{DocumentID: "invoice", FileName: "/2020_01_01/invoice.pdf", Hash: hash},
+		{DocumentID: "invoice", Version: 1, FileName: "/2020_01_01/invoice.pdf", Hash: hash},
+		{DocumentID: "contract", FileName: "/2020_01_01/contract.pdf", Hash: hash},
+		{DocumentID: "changed", FileName: "/2020_01_01/changed.pdf", Hash: sql.NullString{String: "0815", Valid: true}},
+		{DocumentID: "legacy", FileName: "2020_01_01/legacy.pdf"},
+		{DocumentID: "empty", FileName: "/2020_01_01/empty.pdf", Hash: hash},
+	}
+	svc := newFileService()
+	svc.files = []filestore.FileEntry{
+		{Path: "/2020_01_01/invoice.pdf", Size: 10},
+		{Path: "/2020_01_01/invoice.pdf.thumb.jpg", Size: 5},
+		{Path: "/2020_01_01/changed.pdf", Size: 10},
+		{Path: "/2020_01_01/legacy.pdf", Size: 10},
+		{Path: "/2020_01_01/empty.pdf"},
+		{Path: "/2020_01_01/orphan.pdf", Size: 10},
+	}
+	return mdr, svc
+}
+
+func TestVerify(t *testing.T) {
+	mdr, svc := verifyFixture()
+	v := NewVerifier(Repositories{DocRepo: mdr}, svc)
+
+	// existence and size
+	report, err := v.Verify(false)
+	if err != nil {
+		t.Fatalf("could not verify: %v", err)
+	}
+	assert.False(t, report.Valid)
+	assert.Equal(t, 6, report.References)
+	assert.Equal(t, 6, report.Files)
+	assert.Equal(t, 1, report.Unverified)
+	if assert.Equal(t, 1, len(report.Missing)) {
+		assert.Equal(t, "contract", report.Missing[0].DocumentID)
+	}
+	if assert.Equal(t, 1, len(report.Changed)) {
+		assert.Equal(t, "empty", report.Changed[0].DocumentID)
+	}
+	if assert.Equal(t, 1, len(report.Orphans)) {
+		assert.Equal(t, "/2020_01_01/orphan.pdf", report.Orphans[0].FileName)
+	}
+	// only the listing of the files
+	assert.Equal(t, 1, svc.callCount)
+
+	// checksums
+	svc.callCount = 0
+	if report, err = v.Verify(true); err != nil {
+		t.Fatalf("could not verify: %v", err)
+	}
+	if assert.Equal(t, 2, len(report.Changed)) {
+		assert.Equal(t, "changed", report.Changed[0].DocumentID)
+		assert.Equal(t, "0815", report.Changed[0].Expected)
+		assert.Equal(t, mdr.references[0].Hash.String, report.Changed[0].Actual)
+	}
+	// the file of the invoice is only read once
+	assert.Equal(t, 3, svc.callCount)
+
+	// error reading a file
+	svc.callCount = 0
+	svc.errMap[2] = errRaise
+	if report, err = v.Verify(true); err != nil {
+		t.Fatalf("could not verify: %v", err)
+	}
+	if assert.Equal(t, 3, len(report.Changed)) {
+		assert.Equal(t, "invoice", report.Changed[0].DocumentID)
+		assert.NotEmpty(t, report.Changed[0].Error)
+	}
+
+	// a valid store
+	mdr.references = mdr.references[:2]
+	svc.files = svc.files[:2]
+	svc.callCount = 0
+	delete(svc.errMap, 2)
+	if report, err = v.Verify(true); err != nil {
+		t.Fatalf("could not verify: %v", err)
+	}
+	assert.True(t, report.Valid)
+
+	// error listing the files
+	svc.callCount = 0
+	svc.errMap[1] = errRaise
+	if _, err = v.Verify(false); err == nil {
+		t.Errorf(errExp)
+	}
+}
+
+func TestVerifyFiles(t *testing.T) {
+	e := echo.New()
+	mdr, svc := verifyFixture()
+	h := NewHandler(Repositories{DocRepo: mdr}, svc, uploadConfig)
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/?checksums=true", nil), rec)
+	if err := h.VerifyFiles(c); err != nil {
+		t.Errorf("cannot verify files: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report VerifyReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.True(t, report.Checksums)
+	assert.False(t, report.Valid)
+	assert.Equal(t, 2, len(report.Changed))
+
+	// error result
+	mdr.fail = true
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Error(t, h.VerifyFiles(c))
+}
@@ -0,0 +1,147 @@
+package documents
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/labstack/echo/v4"
+	"github.com/microcosm-cc/bluemonday"
+	log "github.com/sirupsen/logrus"
+)
+
+// DocumentVersion is the json representation of a saved state of a document
+type DocumentVersion struct {
+	Version   int      `json:"version"`
+	Versioned string   `json:"versioned"`
+	Document  Document `json:"document"`
+}
+
+// DocumentVersions lists the history of a document, the last version is the current state
+type DocumentVersions struct {
+	Versions     []DocumentVersion `json:"versions"`
+	TotalEntries int               `json:"totalEntries"`
+}
+
+// GetVersions godoc
+// @Summary get the versions of a document
+// @Description lists the history of the document, each save of the document creates a version
+// @Tags documents
+// @Produce  json
+// @Param id path string true "document ID"
+// @Success 200 {object} documents.DocumentVersions
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/documents/{id}/versions [get]
+func (h *Handler) GetVersions(c echo.Context) error {
+	id := c.Param("id")
+	versions, err := h.docRepo.Versions(id, persistence.Atomic{})
+	if err != nil {
+		log.Warnf("could not get the versions of document '%s', %v", id, err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+	if len(versions) == 0 {
+		return errors.NotFoundError{Err: fmt.Errorf("no versions of document '%s' available", id), Request: c.Request()}
+	}
+
+	result := DocumentVersions{TotalEntries: len(versions)}
+	for _, v := range versions {
+		result.Versions = append(result.Versions, convertVersion(h.policy, v))
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetVersion godoc
+// @Summary get a version of a document
+// @Description returns the saved state of the document, the file of the version is available by the preview link
+// @Tags documents
+// @Produce  json
+// @Param id path string true "document ID"
+// @Param version path int true "version"
+// @Success 200 {object} documents.DocumentVersion
+// @Failure 400 {object} errors.ProblemDetail
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Router /api/v1/documents/{id}/versions/{version} [get]
+func (h *Handler) GetVersion(c echo.Context) error {
+	v, err := h.version(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, convertVersion(h.policy, v))
+}
+
+// RestoreVersion godoc
+// @Summary restore a version of a document
+// @Description the saved state of the version becomes the current state of the document, which creates a new version
+// @Tags documents
+// @Produce  json
+// @Param id path string true "document ID"
+// @Param version path int true "version"
+// @Success 200 {object} documents.Result
+// @Failure 400 {object} errors.ProblemDetail
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/documents/{id}/versions/{version}/restore [post]
+func (h *Handler) RestoreVersion(c echo.Context) (err error) {
+	// the version is read before the transaction is started, a SQLite database only provides a single connection
+	v, err := h.version(c)
+	if err != nil {
+		return err
+	}
+	// the versions of a trashed document are kept, the document is restored from the trash first
+	if _, err = h.docRepo.Exists(v.ID, persistence.Atomic{}); err != nil {
+		return errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+
+	atomic, err := h.startAtomic(c)
+	if err != nil {
+		return
+	}
+
+	// complete the atomic method
+	defer func() {
+		err = persistence.HandleTX(true, &atomic, err)
+	}()
+
+	doc, err := h.docRepo.Save(v.DocumentEntity, atomic)
+	if err != nil {
+		log.Errorf("could not restore version %d of document '%s': %v", v.Version, v.ID, err)
+		err = fmt.Errorf("error while restoring document: %v", err)
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+
+	return c.JSON(http.StatusOK, Result{
+		Message: fmt.Sprintf("Restored version %d of document '%s' (%s)", v.Version, doc.Title, doc.ID),
+		Result:  Updated,
+	})
+}
+
+// version returns the version of the document identified by the request parameters
+func (h *Handler) version(c echo.Context) (DocumentVersionEntity, error) {
+	id := c.Param("id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return DocumentVersionEntity{}, errors.BadRequestError{Err: fmt.Errorf("invalid version '%s'", c.Param("version")), Request: c.Request()}
+	}
+	v, err := h.docRepo.Version(id, version)
+	if err != nil {
+		return DocumentVersionEntity{}, errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+	return v, nil
+}
+
+func convertVersion(policy *bluemonday.Policy, v DocumentVersionEntity) DocumentVersion {
+	return DocumentVersion{
+		Version:   v.Version,
+		Versioned: v.Versioned.Format(jsonTimeLayout),
+		Document:  convert(policy, v.DocumentEntity),
+	}
+}
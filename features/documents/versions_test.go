@@ -0,0 +1,142 @@
+package documents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func testVersions() []DocumentVersionEntity {
+	return []DocumentVersionEntity{
+		{DocumentEntity: DocumentEntity{ID: ID, Title: "Invoice", FileName: "/2020_01_01/invoice.pdf"}, Version: 1, Versioned: time.Now().UTC()},
+		{DocumentEntity: DocumentEntity{ID: ID, Title: "Invoice", FileName: "/2020_01_02/invoice.pdf"}, Version: 2, Versioned: time.Now().UTC()},
+		{DocumentEntity: DocumentEntity{ID: ID, Title: "Internet Invoice", FileName: "/2020_01_02/invoice.pdf"}, Version: 3, Versioned: time.Now().UTC()},
+	}
+}
+
+func TestGetVersions(t *testing.T) {
+	e := echo.New()
+	newReq := func(params ...string) (*httptest.ResponseRecorder, echo.Context) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.SetParamNames("id", "version")
+		c.SetParamValues(params...)
+		return rec, c
+	}
+
+	mdr := newDocRepo(persistence.Connection{})
+	mdr.versions = testVersions()
+	h := NewHandler(Repositories{DocRepo: mdr}, newFileService(), uploadConfig)
+
+	rec, c := newReq(ID, "")
+	if err := h.GetVersions(c); err != nil {
+		t.Errorf("cannot get versions: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var versions DocumentVersions
+	if err := json.Unmarshal(rec.Body.Bytes(), &versions); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, 3, versions.TotalEntries)
+	assert.Equal(t, 1, versions.Versions[0].Version)
+	assert.Equal(t, "/2020_01_01/invoice.pdf", versions.Versions[0].Document.FileName)
+	assert.Equal(t, "Internet Invoice", versions.Versions[2].Document.Title)
+
+	rec, c = newReq(ID, "2")
+	if err := h.GetVersion(c); err != nil {
+		t.Errorf("cannot get version: %v", err)
+	}
+	var version DocumentVersion
+	if err := json.Unmarshal(rec.Body.Bytes(), &version); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, 2, version.Version)
+	assert.Equal(t, "/2020_01_02/invoice.pdf", version.Document.FileName)
+
+	// invalid or unknown version
+	_, c = newReq(ID, "two")
+	assert.Error(t, h.GetVersion(c))
+	_, c = newReq(ID, "4")
+	assert.Error(t, h.GetVersion(c))
+
+	// unknown document
+	mdr.versions = nil
+	_, c = newReq(ID, "")
+	assert.Error(t, h.GetVersions(c))
+
+	// error result
+	mdr.callCount = 0
+	mdr.errMap[1] = errRaise
+	_, c = newReq(ID, "")
+	assert.Error(t, h.GetVersions(c))
+}
+
+func TestRestoreVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	e := echo.New()
+	newReq := func(version string) (*httptest.ResponseRecorder, echo.Context) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		c.SetParamNames("id", "version")
+		c.SetParamValues(ID, version)
+		return rec, c
+	}
+
+	mdr := newDocRepo(persistence.NewFromDB(sqlx.NewDb(db, "mysql")))
+	mdr.versions = testVersions()
+	h := NewHandler(Repositories{DocRepo: mdr}, newFileService(), uploadConfig)
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	rec, c := newReq("1")
+	if err := h.RestoreVersion(c); err != nil {
+		t.Errorf("cannot restore version: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Errorf(errorUnmarshal, err)
+	}
+	assert.Equal(t, Updated, result.Result)
+
+	// unknown version
+	_, c = newReq("5")
+	assert.Error(t, h.RestoreVersion(c))
+
+	// error save document
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mdr.callCount = 0
+	mdr.errMap[4] = errRaise
+	_, c = newReq("1")
+	assert.Error(t, h.RestoreVersion(c))
+
+	// the version of a trashed document is not restored
+	mdr.versions = append(mdr.versions, DocumentVersionEntity{DocumentEntity: DocumentEntity{ID: notExists, Title: "Trashed"}, Version: 1})
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	c.SetParamNames("id", "version")
+	c.SetParamValues(notExists, "1")
+	err = h.RestoreVersion(c)
+	if _, ok := err.(errors.NotFoundError); !ok {
+		t.Errorf("expected a not found error for a trashed document, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bihe/mydms/internal/errors"
 	"github.com/labstack/echo/v4"
@@ -22,13 +25,17 @@ func NewHandler(fs FileService) *Handler {
 // GetFile godoc
 // @Summary get a file from the backend store
 // @Description use a base64 encoded path to fetch the binary payload of a file from the store
+// @Description single byte-ranges (Range) and conditional requests (If-None-Match, If-Modified-Since) are supported
 // @Tags filestore
 // @Param path query string true "Path"
 // @Success 200 {array} byte
+// @Success 206 {array} byte
+// @Success 304 {string} string "not modified"
 // @Failure 401 {object} errors.ProblemDetail
 // @Failure 403 {object} errors.ProblemDetail
 // @Failure 400 {object} errors.ProblemDetail
 // @Failure 404 {object} errors.ProblemDetail
+// @Failure 416 {string} string "range not satisfiable"
 // @Failure 500 {object} errors.ProblemDetail
 // @Router /api/v1/file [get]
 func (h *Handler) GetFile(c echo.Context) error {
@@ -40,7 +47,7 @@ func (h *Handler) GetFile(c echo.Context) error {
 			Request: c.Request()}
 	}
 
-	file, err := h.fs.GetFile(string(decodedPath))
+	info, err := h.fs.StatFile(string(decodedPath))
 	if err != nil {
 		return errors.NotFoundError{
 			Err:     fmt.Errorf("file not found '%s'. %v", decodedPath, err),
@@ -48,5 +55,147 @@ func (h *Handler) GetFile(c echo.Context) error {
 		}
 	}
 
-	return c.Blob(http.StatusOK, file.MimeType, file.Payload)
+	header := c.Response().Header()
+	header.Set("Accept-Ranges", "bytes")
+	if info.ETag != "" {
+		header.Set("ETag", info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request(), info) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	var (
+		file   FileStream
+		status = http.StatusOK
+	)
+	offset, length, err := requestedRange(c.Request(), info)
+	switch {
+	case err == errRangeNotSatisfiable:
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		return c.NoContent(http.StatusRequestedRangeNotSatisfiable)
+	case err == nil && length > 0:
+		file, err = h.fs.OpenFileRange(string(decodedPath), offset, length)
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, info.Size))
+		status = http.StatusPartialContent
+	default:
+		// no range, or a range which is not supported - deliver the whole file
+		file, err = h.fs.OpenFile(string(decodedPath))
+	}
+	if err != nil {
+		return errors.NotFoundError{
+			Err:     fmt.Errorf("file not found '%s'. %v", decodedPath, err),
+			Request: c.Request(),
+		}
+	}
+	defer file.Close()
+
+	// the payload is piped to the client without buffering it in memory
+	if file.Size > 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(file.Size, 10))
+	}
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = info.MimeType
+	}
+	return c.Stream(status, mimeType, file)
+}
+
+// --------------------------------------------------------------------------
+// helpers and internal functions
+// --------------------------------------------------------------------------
+
+var errRangeNotSatisfiable = fmt.Errorf("the requested range cannot be satisfied")
+
+// notModified evaluates the conditional headers of the request against the metadata of the file
+// If-None-Match takes precedence over If-Modified-Since (https://tools.ietf.org/html/rfc7232#section-6)
+func notModified(r *http.Request, info FileInfo) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if info.ETag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || weakETag(tag) == weakETag(info.ETag) {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !info.LastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// the HTTP date format has a resolution of seconds
+		return !info.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// weakETag strips the weak indicator of an entity-tag, used for the weak comparison
+func weakETag(tag string) string {
+	return strings.TrimPrefix(tag, "W/")
+}
+
+// requestedRange returns the offset and the length of a single byte-range requested by the client
+// a length of 0 indicates that the whole file should be delivered. This is the case for requests without
+// a Range header, invalid or multiple ranges and an If-Range condition which does not match the file
+func requestedRange(r *http.Request, info FileInfo) (offset, length int64, err error) {
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || !strings.HasPrefix(rangeHeader, "bytes=") {
+		return 0, 0, nil
+	}
+	if ir := r.Header.Get("If-Range"); ir != "" {
+		// only a strong entity-tag can be used to validate the range
+		if strings.HasPrefix(ir, "W/") || ir != info.ETag {
+			return 0, 0, nil
+		}
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(rangeHeader, "bytes="))
+	if strings.Contains(spec, ",") {
+		// multipart ranges are not supported
+		return 0, 0, nil
+	}
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return 0, 0, nil
+	}
+	start, end := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	if start == "" {
+		// suffix range: the last N bytes
+		n, perr := strconv.ParseInt(end, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, 0, nil
+		}
+		if n == 0 || info.Size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		if n > info.Size {
+			n = info.Size
+		}
+		return info.Size - n, n, nil
+	}
+
+	offset, perr := strconv.ParseInt(start, 10, 64)
+	if perr != nil || offset < 0 {
+		return 0, 0, nil
+	}
+	if offset >= info.Size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+	last := info.Size - 1
+	if end != "" {
+		e, perr := strconv.ParseInt(end, 10, 64)
+		if perr != nil || e < offset {
+			return 0, 0, nil
+		}
+		if e < last {
+			last = e
+		}
+	}
+	return offset, last - offset + 1, nil
 }
@@ -2,23 +2,61 @@ package filestore
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
 )
 
 // PATH/file.pdf
 const validPath = "UEFUSC9maWxlLnBkZg=="
 const invalidPath = "UEFUSC9ub25lLnBkZg=="
 
+const etag = `"0815"`
+
 // SaveFile(file FileItem) error
 // GetFile(filePath string) (FileItem, error)
+// OpenFile(filePath string) (FileStream, error)
+// OpenFileRange(filePath string, offset, length int64) (FileStream, error)
+// StatFile(filePath string) (FileInfo, error)
 type mockService struct {
 	s3service
 }
 
+func (m *mockService) StatFile(filePath string) (FileInfo, error) {
+	if filePath == "PATH/file.pdf" {
+		return FileInfo{
+			Size:         int64(len(pdfPayload)),
+			MimeType:     mimeType,
+			LastModified: lastModified,
+			ETag:         etag,
+		}, nil
+	}
+	return FileInfo{}, fmt.Errorf("could not get file")
+}
+
+func (m *mockService) OpenFile(filePath string) (FileStream, error) {
+	return m.OpenFileRange(filePath, 0, int64(len(pdfPayload)))
+}
+
+func (m *mockService) OpenFileRange(filePath string, offset, length int64) (FileStream, error) {
+	info, err := m.StatFile(filePath)
+	if err != nil {
+		return FileStream{}, err
+	}
+	info.Size = length
+	return FileStream{
+		FileInfo:   info,
+		ReadCloser: ioutil.NopCloser(strings.NewReader(pdfPayload[offset : offset+length])),
+	}, nil
+}
+
 func (m *mockService) GetFile(filePath string) (FileItem, error) {
 	if filePath == "PATH/file.pdf" {
 		return FileItem{
@@ -88,7 +126,143 @@ func TestGetFiles(t *testing.T) {
 			if len(payload) != tc.Size {
 				t.Errorf("the returend payload does not match!")
 			}
+			if !tc.Err {
+				assert.Equal(t, mimeType, rec.Header().Get(echo.HeaderContentType))
+				assert.Equal(t, strconv.Itoa(tc.Size), rec.Header().Get(echo.HeaderContentLength))
+			}
 		})
 	}
 
 }
+
+func TestGetFileConditional(t *testing.T) {
+	size := len(pdfPayload)
+	cases := []struct {
+		Name         string
+		Header       map[string]string
+		Status       int
+		Body         string
+		ContentRange string
+	}{
+		{
+			Name:   "no conditions",
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+		{
+			Name:   "etag matches",
+			Header: map[string]string{"If-None-Match": etag},
+			Status: http.StatusNotModified,
+		},
+		{
+			Name:   "weak etag in list matches",
+			Header: map[string]string{"If-None-Match": `"other", W/"0815"`},
+			Status: http.StatusNotModified,
+		},
+		{
+			Name:   "etag does not match",
+			Header: map[string]string{"If-None-Match": `"other"`},
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+		{
+			Name:   "etag has precedence over date",
+			Header: map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+		{
+			Name:   "not modified since",
+			Header: map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			Status: http.StatusNotModified,
+		},
+		{
+			Name:   "modified since",
+			Header: map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+		{
+			Name:         "range",
+			Header:       map[string]string{"Range": "bytes=0-7"},
+			Status:       http.StatusPartialContent,
+			Body:         pdfPayload[0:8],
+			ContentRange: fmt.Sprintf("bytes 0-7/%d", size),
+		},
+		{
+			Name:         "open range",
+			Header:       map[string]string{"Range": "bytes=10-"},
+			Status:       http.StatusPartialContent,
+			Body:         pdfPayload[10:],
+			ContentRange: fmt.Sprintf("bytes 10-%d/%d", size-1, size),
+		},
+		{
+			Name:         "suffix range",
+			Header:       map[string]string{"Range": "bytes=-6"},
+			Status:       http.StatusPartialContent,
+			Body:         pdfPayload[size-6:],
+			ContentRange: fmt.Sprintf("bytes %d-%d/%d", size-6, size-1, size),
+		},
+		{
+			Name:         "range end exceeds size",
+			Header:       map[string]string{"Range": fmt.Sprintf("bytes=5-%d", size+100)},
+			Status:       http.StatusPartialContent,
+			Body:         pdfPayload[5:],
+			ContentRange: fmt.Sprintf("bytes 5-%d/%d", size-1, size),
+		},
+		{
+			Name:         "range not satisfiable",
+			Header:       map[string]string{"Range": fmt.Sprintf("bytes=%d-", size)},
+			Status:       http.StatusRequestedRangeNotSatisfiable,
+			ContentRange: fmt.Sprintf("bytes */%d", size),
+		},
+		{
+			Name:   "multiple ranges are ignored",
+			Header: map[string]string{"Range": "bytes=0-1,4-5"},
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+		{
+			Name:   "invalid range is ignored",
+			Header: map[string]string{"Range": "bytes=a-b"},
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+		{
+			Name:         "if-range matches",
+			Header:       map[string]string{"Range": "bytes=0-7", "If-Range": etag},
+			Status:       http.StatusPartialContent,
+			Body:         pdfPayload[0:8],
+			ContentRange: fmt.Sprintf("bytes 0-7/%d", size),
+		},
+		{
+			Name:   "if-range does not match",
+			Header: map[string]string{"Range": "bytes=0-7", "If-Range": `"other"`},
+			Status: http.StatusOK,
+			Body:   pdfPayload,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/?path="+validPath, nil)
+			for k, v := range tc.Header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := &Handler{fs: new(mockService)}
+			if err := h.GetFile(c); err != nil {
+				t.Fatalf("no error expected: %v", err)
+			}
+			assert.Equal(t, tc.Status, rec.Code)
+			assert.Equal(t, tc.Body, rec.Body.String())
+			assert.Equal(t, tc.ContentRange, rec.Header().Get("Content-Range"))
+			assert.Equal(t, etag, rec.Header().Get("ETag"))
+			assert.Equal(t, lastModified.Format(http.TimeFormat), rec.Header().Get(echo.HeaderLastModified))
+			assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		})
+	}
+}
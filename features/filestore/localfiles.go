@@ -0,0 +1,235 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalConfig defines the parameters to store files in the local filesystem
+type LocalConfig struct {
+	// RootPath is the base directory of the stored files
+	RootPath string
+}
+
+// NewLocalService returns a new instance of the fileservice using the local filesystem
+func NewLocalService(config LocalConfig) FileService {
+	return &localService{config: config}
+}
+
+// localService stores files using the same layout as the S3 backend: RootPath/FolderName/FileName
+type localService struct {
+	config LocalConfig
+}
+
+// GetFile retrieves a file defined by a given path from the local filesystem
+func (l *localService) GetFile(filePath string) (FileItem, error) {
+	folder, fileName, err := splitPath(filePath)
+	if err != nil {
+		return FileItem{}, err
+	}
+	storagePath, err := l.resolve(folder, fileName)
+	if err != nil {
+		return FileItem{}, err
+	}
+
+	payload, err := ioutil.ReadFile(storagePath)
+	if err != nil {
+		return FileItem{}, fmt.Errorf("could not read file '%s'. %v", storagePath, err)
+	}
+
+	return FileItem{
+		FileName:   fileName,
+		FolderName: folder,
+		MimeType:   mimeTypeOf(fileName),
+		Payload:    payload,
+	}, nil
+}
+
+// OpenFile returns a stream of the file defined by the given path
+func (l *localService) OpenFile(filePath string) (FileStream, error) {
+	f, info, err := l.open(filePath)
+	if err != nil {
+		return FileStream{}, err
+	}
+	return FileStream{FileInfo: info, ReadCloser: f}, nil
+}
+
+// OpenFileRange returns a stream of length bytes of the file starting at the given offset
+func (l *localService) OpenFileRange(filePath string, offset, length int64) (FileStream, error) {
+	if offset < 0 || length <= 0 {
+		return FileStream{}, fmt.Errorf("invalid range %d/%d supplied for %s", offset, length, filePath)
+	}
+	f, info, err := l.open(filePath)
+	if err != nil {
+		return FileStream{}, err
+	}
+	if offset+length > info.Size {
+		f.Close()
+		return FileStream{}, fmt.Errorf("range %d/%d exceeds the size of %s", offset, length, filePath)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return FileStream{}, fmt.Errorf("could not seek in file '%s'. %v", filePath, err)
+	}
+
+	info.Size = length
+	return FileStream{
+		FileInfo: info,
+		ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(f, length), f},
+	}, nil
+}
+
+// StatFile returns the metadata of the file defined by the given path
+func (l *localService) StatFile(filePath string) (FileInfo, error) {
+	f, info, err := l.open(filePath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	f.Close()
+	return info, nil
+}
+
+// open returns the file handle and the metadata of the given path
+func (l *localService) open(filePath string) (*os.File, FileInfo, error) {
+	folder, fileName, err := splitPath(filePath)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+	storagePath, err := l.resolve(folder, fileName)
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+
+	f, err := os.Open(storagePath)
+	if err != nil {
+		return nil, FileInfo{}, fmt.Errorf("could not open file '%s'. %v", storagePath, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, FileInfo{}, fmt.Errorf("could not get file information '%s'. %v", storagePath, err)
+	}
+
+	return f, FileInfo{
+		Size:         stat.Size(),
+		MimeType:     mimeTypeOf(fileName),
+		LastModified: stat.ModTime().UTC(),
+		ETag:         etagOf(stat),
+	}, nil
+}
+
+// SaveFile stores a file item in the folder below the configured root path
+func (l *localService) SaveFile(file FileItem) error {
+	storagePath, err := l.resolve(file.FolderName, file.FileName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(storagePath), 0750); err != nil {
+		return fmt.Errorf("could not create folder for file item '%s'. %v", storagePath, err)
+	}
+
+	// write to a temporary file first and rename it afterwards
+	// readers never see a partially written file
+	tmp, err := ioutil.TempFile(filepath.Dir(storagePath), "."+file.FileName+".*")
+	if err != nil {
+		return fmt.Errorf("could not create file item '%s'. %v", storagePath, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(file.Payload); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write file item '%s'. %v", storagePath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write file item '%s'. %v", storagePath, err)
+	}
+	if err := os.Rename(tmp.Name(), storagePath); err != nil {
+		return fmt.Errorf("could not store file item '%s'. %v", storagePath, err)
+	}
+	return nil
+}
+
+// DeleteFile removes the item using the specified path
+// like the S3 backend it is not an error to delete a file which is not available
+func (l *localService) DeleteFile(filePath string) error {
+	folder, fileName, err := splitPath(filePath)
+	if err != nil {
+		return err
+	}
+	storagePath, err := l.resolve(folder, fileName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(storagePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete the file item '%s'. %v", filePath, err)
+	}
+	return nil
+}
+
+// ListFiles returns all files below the root path
+// temporary files of SaveFile are not listed
+func (l *localService) ListFiles() ([]FileEntry, error) {
+	if l.config.RootPath == "" {
+		return nil, fmt.Errorf("no root path defined for the local file store")
+	}
+
+	var files []FileEntry
+	err := filepath.Walk(l.config.RootPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.config.RootPath, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileEntry{
+			Path:         "/" + filepath.ToSlash(rel),
+			Size:         info.Size(),
+			LastModified: info.ModTime().UTC(),
+			ETag:         etagOf(info),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list the files of '%s'. %v", l.config.RootPath, err)
+	}
+	return files, nil
+}
+
+// resolve returns the path in the local filesystem for the given folder and file
+// the elements must not navigate outside of the root path
+func (l *localService) resolve(folder, fileName string) (string, error) {
+	if l.config.RootPath == "" {
+		return "", fmt.Errorf("no root path defined for the local file store")
+	}
+	for _, p := range []string{folder, fileName} {
+		if p == "" || p == "." || p == ".." || filepath.Base(p) != p {
+			return "", fmt.Errorf("invalid path supplied: %s/%s", folder, fileName)
+		}
+	}
+	return filepath.Join(l.config.RootPath, folder, fileName), nil
+}
+
+// etagOf derives the entity-tag of a file from its modification time and size
+func etagOf(stat os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", stat.ModTime().UnixNano(), stat.Size())
+}
+
+// mimeTypeOf determines the mime-type of a file by its extension
+func mimeTypeOf(fileName string) string {
+	if t := mime.TypeByExtension(filepath.Ext(fileName)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,151 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func localStore(t *testing.T) (FileService, string) {
+	root, err := ioutil.TempDir("", "mydms-filestore")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	return NewLocalService(LocalConfig{RootPath: root}), root
+}
+
+func TestLocalSaveGetDelete(t *testing.T) {
+	svc, root := localStore(t)
+	defer os.RemoveAll(root)
+
+	err := svc.SaveFile(FileItem{
+		FileName:   "20090806-invoice.pdf",
+		FolderName: "2009_08_06",
+		MimeType:   mimeType,
+		Payload:    []byte(pdfPayload),
+	})
+	if err != nil {
+		t.Fatalf("could not save file to local store: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "2009_08_06", "20090806-invoice.pdf")); err != nil {
+		t.Errorf("file was not saved using the folder layout: %v", err)
+	}
+
+	for _, p := range []string{"2009_08_06/20090806-invoice.pdf", "/2009_08_06/20090806-invoice.pdf"} {
+		item, err := svc.GetFile(p)
+		if err != nil {
+			t.Fatalf("could not get file from local store: %v", err)
+		}
+		assert.Equal(t, "2009_08_06", item.FolderName)
+		assert.Equal(t, "20090806-invoice.pdf", item.FileName)
+		assert.Equal(t, mimeType, item.MimeType)
+		assert.Equal(t, len(pdfPayload), len(item.Payload))
+	}
+
+	stream, err := svc.OpenFile("/2009_08_06/20090806-invoice.pdf")
+	if err != nil {
+		t.Fatalf("could not open file from local store: %v", err)
+	}
+	assert.Equal(t, int64(len(pdfPayload)), stream.Size)
+	assert.Equal(t, mimeType, stream.MimeType)
+	assert.False(t, stream.LastModified.IsZero())
+	payload, err := ioutil.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, pdfPayload, string(payload))
+	stream.Close()
+
+	info, err := svc.StatFile("/2009_08_06/20090806-invoice.pdf")
+	if err != nil {
+		t.Fatalf("could not get file metadata from local store: %v", err)
+	}
+	assert.Equal(t, int64(len(pdfPayload)), info.Size)
+	assert.NotEmpty(t, info.ETag)
+
+	stream, err = svc.OpenFileRange("/2009_08_06/20090806-invoice.pdf", 1, 3)
+	if err != nil {
+		t.Fatalf("could not open file range from local store: %v", err)
+	}
+	payload, err = ioutil.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, pdfPayload[1:4], string(payload))
+	assert.Equal(t, int64(3), stream.Size)
+	stream.Close()
+
+	if _, err = svc.OpenFileRange("/2009_08_06/20090806-invoice.pdf", 1, int64(len(pdfPayload))); err == nil {
+		t.Errorf("error for range exceeding the file expected")
+	}
+
+	if err := svc.DeleteFile("/2009_08_06/20090806-invoice.pdf"); err != nil {
+		t.Errorf("could not delete file from local store: %v", err)
+	}
+	if _, err := svc.GetFile("/2009_08_06/20090806-invoice.pdf"); err == nil {
+		t.Errorf("expected error for deleted file")
+	}
+	// deleting a missing file is not an error
+	if err := svc.DeleteFile("/2009_08_06/20090806-invoice.pdf"); err != nil {
+		t.Errorf("no error expected for missing file: %v", err)
+	}
+}
+
+func TestLocalListFiles(t *testing.T) {
+	svc, root := localStore(t)
+	defer os.RemoveAll(root)
+
+	for _, f := range []FileItem{
+		{FileName: "invoice.pdf", FolderName: "2009_08_06", Payload: []byte(pdfPayload)},
+		{FileName: "contract.pdf", FolderName: "2009_08_07", Payload: []byte(pdfPayload)},
+	} {
+		if err := svc.SaveFile(f); err != nil {
+			t.Fatalf("could not save file to local store: %v", err)
+		}
+	}
+	// left-over temporary file of SaveFile
+	ioutil.WriteFile(filepath.Join(root, "2009_08_06", ".invoice.pdf.123"), []byte(pdfPayload), 0640)
+
+	files, err := svc.ListFiles()
+	if err != nil {
+		t.Fatalf("could not list files of local store: %v", err)
+	}
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, "/2009_08_06/invoice.pdf", files[0].Path)
+	assert.Equal(t, "/2009_08_07/contract.pdf", files[1].Path)
+	assert.Equal(t, int64(len(pdfPayload)), files[0].Size)
+	assert.NotEmpty(t, files[0].ETag)
+
+	if _, err := NewLocalService(LocalConfig{}).ListFiles(); err == nil {
+		t.Errorf("expected error without root path")
+	}
+}
+
+func TestLocalInvalidPath(t *testing.T) {
+	svc, root := localStore(t)
+	defer os.RemoveAll(root)
+
+	cases := []string{"", "null", "../../etc/passwd", "../passwd", "a/b/c"}
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if _, err := svc.GetFile(c); err == nil {
+				t.Errorf("error for invalid path expected!")
+			}
+			if _, err := svc.OpenFile(c); err == nil {
+				t.Errorf("error for invalid path expected!")
+			}
+			if err := svc.DeleteFile(c); err == nil {
+				t.Errorf("error for invalid path expected!")
+			}
+		})
+	}
+
+	err := svc.SaveFile(FileItem{FileName: "passwd", FolderName: "..", Payload: []byte(pdfPayload)})
+	if err == nil {
+		t.Errorf("error for invalid path expected!")
+	}
+
+	svc = NewLocalService(LocalConfig{})
+	if err := svc.SaveFile(FileItem{FileName: "test.pdf", FolderName: "__TEST", Payload: []byte(pdfPayload)}); err == nil {
+		t.Errorf("error for missing root path expected!")
+	}
+}
@@ -2,8 +2,13 @@ package filestore
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -24,13 +29,49 @@ type FileItem struct {
 	Payload    []byte
 }
 
+// FileInfo holds the metadata of a stored file
+type FileInfo struct {
+	Size         int64
+	MimeType     string
+	LastModified time.Time
+	// ETag is a quoted entity-tag identifying the current file payload
+	ETag string
+}
+
+// FileStream provides the payload of a stored file as a stream
+// the caller is responsible to close the stream
+type FileStream struct {
+	FileInfo
+	io.ReadCloser
+}
+
+// FileEntry is a stored file returned by the listing of the backend store
+type FileEntry struct {
+	// Path has the form "/FolderName/FileName" like the file names of the documents
+	Path         string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+}
+
 // FileService defines an interface for backend file services
 type FileService interface {
 	SaveFile(file FileItem) error
 	GetFile(filePath string) (FileItem, error)
+	OpenFile(filePath string) (FileStream, error)
+	OpenFileRange(filePath string, offset, length int64) (FileStream, error)
+	StatFile(filePath string) (FileInfo, error)
 	DeleteFile(filePath string) error
+	ListFiles() ([]FileEntry, error)
 }
 
+const (
+	// S3Backend stores the files in an AWS S3 bucket
+	S3Backend = "s3"
+	// LocalBackend stores the files in a directory of the local filesystem
+	LocalBackend = "local"
+)
+
 // --------------------------------------------------------------------------
 // interface implementation
 // --------------------------------------------------------------------------
@@ -41,8 +82,18 @@ type S3Config struct {
 	Bucket string
 	Key    string
 	Secret string
+	// Endpoint of a S3 compatible service like MinIO or Ceph, empty for AWS
+	Endpoint string
+	// PathStyle uses path-style addressing (endpoint/bucket/key) which most
+	// self-hosted services require
+	PathStyle bool
+	// InsecureSkipVerify accepts any TLS certificate presented by the endpoint
+	InsecureSkipVerify bool
 }
 
+// defaultRegion is used for S3 compatible services if no region is configured
+const defaultRegion = "us-east-1"
+
 // NewService returns a new instance of the fileservice
 func NewService(config S3Config) FileService {
 	return &s3service{config: config}
@@ -57,11 +108,7 @@ type s3service struct {
 // if it is not initilized it creates a new client using the supplied config
 func (s *s3service) InitClient() error {
 	if s.client == nil {
-		sess, err := session.NewSession(&aws.Config{
-			Region:      aws.String(s.config.Region),
-			Credentials: credentials.NewStaticCredentials(s.config.Key, s.config.Secret, ""),
-		},
-		)
+		sess, err := session.NewSession(s.awsConfig())
 		if err != nil {
 			return fmt.Errorf("could not start a new S3 session. %v", err)
 		}
@@ -70,43 +117,134 @@ func (s *s3service) InitClient() error {
 	return nil
 }
 
+// awsConfig creates the client configuration, an endpoint can be supplied to use S3 compatible services
+func (s *s3service) awsConfig() *aws.Config {
+	cfg := &aws.Config{
+		Region:      aws.String(s.config.Region),
+		Credentials: credentials.NewStaticCredentials(s.config.Key, s.config.Secret, ""),
+	}
+	if s.config.Endpoint != "" {
+		cfg.Endpoint = aws.String(s.config.Endpoint)
+		if s.config.Region == "" {
+			cfg.Region = aws.String(defaultRegion)
+		}
+	}
+	if s.config.PathStyle {
+		cfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	if s.config.InsecureSkipVerify {
+		cfg.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+	return cfg
+}
+
 // GetFile retrieves a file defined by a given path from the backend store
 func (s *s3service) GetFile(filePath string) (FileItem, error) {
-	err := s.InitClient()
+	path, fileName, err := splitPath(filePath)
+	if err != nil {
+		return FileItem{}, err
+	}
+	stream, err := s.OpenFile(filePath)
 	if err != nil {
 		return FileItem{}, err
 	}
+	defer stream.Close()
 
-	fileURLPath := filePath
-	if strings.Index(fileURLPath, "/") == 0 {
-		fileURLPath = fileURLPath[1:len(fileURLPath)]
+	payload, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return FileItem{}, fmt.Errorf("could not read object %s/%s/%s. %v", s.config.Bucket, path, fileName, err)
 	}
-	parts := strings.Split(fileURLPath, "/")
-	if len(parts) != 2 {
-		return FileItem{}, fmt.Errorf("invalid path supplied: %s", fileURLPath)
+
+	return FileItem{
+		FileName:   fileName,
+		FolderName: path,
+		MimeType:   stream.MimeType,
+		Payload:    payload,
+	}, nil
+}
+
+// OpenFile returns a stream of the file defined by the given path
+// the payload is not buffered, the stream reads directly from the backend store
+func (s *s3service) OpenFile(filePath string) (FileStream, error) {
+	return s.getObject(filePath, "")
+}
+
+// OpenFileRange returns a stream of length bytes of the file starting at the given offset
+func (s *s3service) OpenFileRange(filePath string, offset, length int64) (FileStream, error) {
+	if offset < 0 || length <= 0 {
+		return FileStream{}, fmt.Errorf("invalid range %d/%d supplied for %s", offset, length, filePath)
+	}
+	return s.getObject(filePath, fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+}
+
+// StatFile returns the metadata of the file defined by the given path
+func (s *s3service) StatFile(filePath string) (FileInfo, error) {
+	err := s.InitClient()
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	path, fileName, err := splitPath(filePath)
+	if err != nil {
+		return FileInfo{}, err
 	}
-	path := parts[0]
-	fileName := parts[1]
+	fileURLPath := path + "/" + fileName
 
-	s3obj, err := s.client.GetObject(
-		&s3.GetObjectInput{
+	head, err := s.client.HeadObject(
+		&s3.HeadObjectInput{
 			Bucket: aws.String(s.config.Bucket),
 			Key:    aws.String(fileURLPath),
 		})
 	if err != nil {
-		return FileItem{}, fmt.Errorf("could not get object %s/%s. %v", s.config.Bucket, fileURLPath, err)
+		return FileInfo{}, fmt.Errorf("could not get object metadata %s/%s. %v", s.config.Bucket, fileURLPath, err)
 	}
-	ctype := s3obj.ContentType
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(s3obj.Body)
-	payload := buf.Bytes()
-	s3obj.Body.Close()
 
-	return FileItem{
-		FileName:   fileName,
-		FolderName: path,
-		MimeType:   *ctype,
-		Payload:    payload,
+	return FileInfo{
+		Size:         aws.Int64Value(head.ContentLength),
+		MimeType:     aws.StringValue(head.ContentType),
+		LastModified: aws.TimeValue(head.LastModified),
+		ETag:         aws.StringValue(head.ETag),
+	}, nil
+}
+
+// getObject fetches the object from the backend store, optionally limited by a HTTP byte-range
+func (s *s3service) getObject(filePath, byteRange string) (FileStream, error) {
+	err := s.InitClient()
+	if err != nil {
+		return FileStream{}, err
+	}
+
+	path, fileName, err := splitPath(filePath)
+	if err != nil {
+		return FileStream{}, err
+	}
+	fileURLPath := path + "/" + fileName
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(fileURLPath),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+	s3obj, err := s.client.GetObject(input)
+	if err != nil {
+		return FileStream{}, fmt.Errorf("could not get object %s/%s. %v", s.config.Bucket, fileURLPath, err)
+	}
+
+	return FileStream{
+		FileInfo: FileInfo{
+			Size:         aws.Int64Value(s3obj.ContentLength),
+			MimeType:     aws.StringValue(s3obj.ContentType),
+			LastModified: aws.TimeValue(s3obj.LastModified),
+			ETag:         aws.StringValue(s3obj.ETag),
+		},
+		ReadCloser: s3obj.Body,
 	}, nil
 }
 
@@ -148,3 +286,48 @@ func (s *s3service) DeleteFile(filePath string) error {
 	}
 	return nil
 }
+
+// ListFiles returns all objects of the bucket
+func (s *s3service) ListFiles() ([]FileEntry, error) {
+	err := s.InitClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileEntry
+	err = s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.Bucket),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			files = append(files, FileEntry{
+				Path:         "/" + strings.TrimPrefix(aws.StringValue(o.Key), "/"),
+				Size:         aws.Int64Value(o.Size),
+				LastModified: aws.TimeValue(o.LastModified),
+				ETag:         aws.StringValue(o.ETag),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list the objects of %s. %v", s.config.Bucket, err)
+	}
+	return files, nil
+}
+
+// --------------------------------------------------------------------------
+// helpers and internal functions
+// --------------------------------------------------------------------------
+
+// splitPath validates the given file path and returns the folder and the file name
+// a file path has the form "[/]FolderName/FileName"
+func splitPath(filePath string) (folder, fileName string, err error) {
+	fileURLPath := filePath
+	if strings.Index(fileURLPath, "/") == 0 {
+		fileURLPath = fileURLPath[1:]
+	}
+	parts := strings.Split(fileURLPath, "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid path supplied: %s", fileURLPath)
+	}
+	return parts[0], parts[1], nil
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -29,6 +31,8 @@ startxref
 `
 const mimeType = "application/pdf"
 
+var lastModified = time.Date(2019, 8, 6, 12, 0, 0, 0, time.UTC)
+
 // Define a mock struct to be used in your unit tests of myFunc.
 // https://github.com/aws/aws-sdk-go/blob/master/service/s3/s3iface/interface.go
 type mockS3Client struct {
@@ -39,9 +43,33 @@ func (m *mockS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput,
 	if *input.Key == "" || *input.Key == "null/null" {
 		return nil, fmt.Errorf("could not get object with Key %s", *input.Key)
 	}
+	if input.Range != nil {
+		var start, end int
+		fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end)
+		return &s3.GetObjectOutput{
+			ContentType:   aws.String(mimeType),
+			ContentLength: aws.Int64(int64(end - start + 1)),
+			LastModified:  aws.Time(lastModified),
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(pdfPayload[start : end+1]))),
+		}, nil
+	}
 	return &s3.GetObjectOutput{
-		ContentType: aws.String(mimeType),
-		Body:        ioutil.NopCloser(bytes.NewReader([]byte(pdfPayload))),
+		ContentType:   aws.String(mimeType),
+		ContentLength: aws.Int64(int64(len(pdfPayload))),
+		LastModified:  aws.Time(lastModified),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(pdfPayload))),
+	}, nil
+}
+
+func (m *mockS3Client) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if *input.Key == "" || *input.Key == "null/null" {
+		return nil, fmt.Errorf("could not get object with Key %s", *input.Key)
+	}
+	return &s3.HeadObjectOutput{
+		ContentType:   aws.String(mimeType),
+		ContentLength: aws.Int64(int64(len(pdfPayload))),
+		LastModified:  aws.Time(lastModified),
+		ETag:          aws.String(`"0815"`),
 	}, nil
 }
 
@@ -59,6 +87,22 @@ func (m *mockS3Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObje
 	return &s3.DeleteObjectOutput{}, nil
 }
 
+func (m *mockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	if *input.Bucket == "" {
+		return fmt.Errorf("no bucket supplied")
+	}
+	pages := []*s3.ListObjectsV2Output{
+		{Contents: []*s3.Object{{Key: aws.String("2019_08_06/invoice.pdf"), Size: aws.Int64(10), LastModified: aws.Time(lastModified), ETag: aws.String(`"0815"`)}}},
+		{Contents: []*s3.Object{{Key: aws.String("2019_08_06/invoice.pdf.thumb.jpg"), Size: aws.Int64(5), LastModified: aws.Time(lastModified)}}},
+	}
+	for i, p := range pages {
+		if !fn(p, i == len(pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
 func TestInitClient(t *testing.T) {
 	service := s3service{
 		config: S3Config{},
@@ -69,6 +113,39 @@ func TestInitClient(t *testing.T) {
 	}
 }
 
+func TestS3CompatibleConfig(t *testing.T) {
+	service := s3service{
+		config: S3Config{
+			Key:                "key",
+			Secret:             "secret",
+			Endpoint:           "https://localhost:9000",
+			PathStyle:          true,
+			InsecureSkipVerify: true,
+		},
+	}
+	cfg := service.awsConfig()
+	assert.Equal(t, "https://localhost:9000", aws.StringValue(cfg.Endpoint))
+	assert.Equal(t, defaultRegion, aws.StringValue(cfg.Region))
+	assert.True(t, aws.BoolValue(cfg.S3ForcePathStyle))
+	if assert.NotNil(t, cfg.HTTPClient) {
+		transport := cfg.HTTPClient.Transport.(*http.Transport)
+		assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	}
+	if err := service.InitClient(); err != nil {
+		t.Errorf("error initializing client")
+	}
+
+	// plain AWS configuration
+	service = s3service{
+		config: S3Config{Region: "eu-central-1"},
+	}
+	cfg = service.awsConfig()
+	assert.Nil(t, cfg.Endpoint)
+	assert.Nil(t, cfg.S3ForcePathStyle)
+	assert.Nil(t, cfg.HTTPClient)
+	assert.Equal(t, "eu-central-1", aws.StringValue(cfg.Region))
+}
+
 func TestGetS3Entry(t *testing.T) {
 	service := s3service{
 		config: S3Config{},
@@ -127,6 +204,66 @@ func TestGetS3Entry(t *testing.T) {
 
 }
 
+func TestOpenS3Entry(t *testing.T) {
+	service := s3service{
+		config: S3Config{},
+		client: &mockS3Client{},
+	}
+
+	stream, err := service.OpenFile("/2009_08_06/20090806-invoice.pdf")
+	if err != nil {
+		t.Fatalf("could not open file from s3 backend: %v", err)
+	}
+	defer stream.Close()
+	assert.Equal(t, int64(len(pdfPayload)), stream.Size)
+	assert.Equal(t, mimeType, stream.MimeType)
+	assert.Equal(t, lastModified, stream.LastModified)
+	payload, err := ioutil.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, pdfPayload, string(payload))
+
+	if _, err = service.OpenFile("null/null"); err == nil {
+		t.Errorf("error for invalid file expected!")
+	}
+	if _, err = service.OpenFile(""); err == nil {
+		t.Errorf("error for invalid path expected!")
+	}
+}
+
+func TestStatAndRangeS3Entry(t *testing.T) {
+	service := s3service{
+		config: S3Config{},
+		client: &mockS3Client{},
+	}
+
+	info, err := service.StatFile("/2009_08_06/20090806-invoice.pdf")
+	if err != nil {
+		t.Fatalf("could not get file metadata from s3 backend: %v", err)
+	}
+	assert.Equal(t, int64(len(pdfPayload)), info.Size)
+	assert.Equal(t, mimeType, info.MimeType)
+	assert.Equal(t, lastModified, info.LastModified)
+	assert.Equal(t, `"0815"`, info.ETag)
+
+	if _, err = service.StatFile("null/null"); err == nil {
+		t.Errorf("error for invalid file expected!")
+	}
+
+	stream, err := service.OpenFileRange("/2009_08_06/20090806-invoice.pdf", 1, 3)
+	if err != nil {
+		t.Fatalf("could not open file range from s3 backend: %v", err)
+	}
+	defer stream.Close()
+	payload, err := ioutil.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, pdfPayload[1:4], string(payload))
+	assert.Equal(t, int64(3), stream.Size)
+
+	if _, err = service.OpenFileRange("/2009_08_06/20090806-invoice.pdf", 0, 0); err == nil {
+		t.Errorf("error for invalid range expected!")
+	}
+}
+
 func TestSaveS3Entry(t *testing.T) {
 	service := s3service{
 		config: S3Config{},
@@ -168,3 +305,25 @@ func TestDeleteS3Entry(t *testing.T) {
 		t.Errorf("expected error invalid path")
 	}
 }
+
+func TestListS3Entries(t *testing.T) {
+	service := s3service{
+		config: S3Config{Bucket: "bucket"},
+		client: &mockS3Client{},
+	}
+	files, err := service.ListFiles()
+	if err != nil {
+		t.Fatalf("could not list files of s3 backend: %v", err)
+	}
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, "/2019_08_06/invoice.pdf", files[0].Path)
+	assert.Equal(t, int64(10), files[0].Size)
+	assert.Equal(t, lastModified, files[0].LastModified)
+	assert.Equal(t, `"0815"`, files[0].ETag)
+	assert.Equal(t, "/2019_08_06/invoice.pdf.thumb.jpg", files[1].Path)
+
+	service.config.Bucket = ""
+	if _, err = service.ListFiles(); err == nil {
+		t.Errorf("expected error listing files")
+	}
+}
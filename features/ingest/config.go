@@ -0,0 +1,49 @@
+package ingest
+
+import "time"
+
+const (
+	// DocumentMode creates documents for the files of the watched folder
+	DocumentMode = "document"
+	// UploadMode creates uploads for the files of the watched folder
+	UploadMode = "upload"
+)
+
+// Config defines the watched folder and how the files are imported
+type Config struct {
+	// Path is the watched folder, the names of subfolders are used as tags of the documents
+	Path string
+	// ArchivePath receives the imported files
+	ArchivePath string
+	// ErrorPath receives the files which could not be imported
+	ErrorPath string
+	// Mode is either DocumentMode (default) or UploadMode
+	Mode string
+	// Owner is used for the created uploads
+	Owner string
+	// Interval defines how often the folder is checked
+	Interval time.Duration
+	// SettleTime defines how long a file needs to be unchanged before it is imported
+	// files which are still written by a scanner are not picked up
+	SettleTime time.Duration
+}
+
+// MailConfig defines the IMAP mailbox which is checked for mails with attachments
+type MailConfig struct {
+	// Address of the IMAP server, e.g. "imap.example.com:993"
+	Address string
+	// TLS connects to the server using an implicit TLS connection
+	TLS bool
+	// InsecureSkipVerify does not verify the certificate of the server
+	InsecureSkipVerify bool
+	User               string
+	Password           string
+	// Mailbox is checked for unread mails, default is "INBOX"
+	Mailbox string
+	// ProcessedMailbox receives the imported mails, if empty the mails are only marked as read
+	ProcessedMailbox string
+	// ErrorMailbox receives the mails which could not be imported, if empty the mails are only marked as read and flagged
+	ErrorMailbox string
+	// Interval defines how often the mailbox is checked
+	Interval time.Duration
+}
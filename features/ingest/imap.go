@@ -0,0 +1,311 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bihe/mydms/features/documents"
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-message/mail"
+	log "github.com/sirupsen/logrus"
+
+	// decode subjects and file names which are not encoded as UTF-8
+	_ "github.com/emersion/go-message/charset"
+)
+
+// MailPoller imports the attachments of unread mails as documents
+// the subject of the mail is used as the title, the address of the sender as the sender of the document
+type MailPoller struct {
+	config     MailConfig
+	uploadRepo upload.Repository
+	importer   *documents.Importer
+	uc         upload.Config
+}
+
+// mailMessage is a fetched mail identified by its UID
+type mailMessage struct {
+	uid uint32
+	raw []byte
+}
+
+// NewMailPoller creates a poller for the configured mailbox
+// the file-types and sizes of the upload configuration apply to the attachments
+func NewMailPoller(config MailConfig, repos Repositories, fs filestore.FileService, uc upload.Config) (*MailPoller, error) {
+	if config.Address == "" || config.User == "" {
+		return nil, fmt.Errorf("the address of the IMAP server and the user need to be defined")
+	}
+	if config.Mailbox == "" {
+		config.Mailbox = "INBOX"
+	}
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+	return &MailPoller{
+		config:     config,
+		uploadRepo: repos.UploadRepo,
+		importer:   documents.NewImporter(documents.Repositories{DocRepo: repos.DocRepo, UploadRepo: repos.UploadRepo}, fs, uc),
+		uc:         uc,
+	}, nil
+}
+
+// Start periodically imports the mails of the mailbox until the context is done, wg is done when the worker returned
+func (m *MailPoller) Start(ctx context.Context, wg *sync.WaitGroup) {
+	log.Infof("checking mailbox '%s' of '%s' to import attachments", m.config.Mailbox, m.config.Address)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(m.config.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := m.Poll(); err != nil {
+				log.Errorf("could not import mails of mailbox '%s': %v", m.config.Mailbox, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Poll imports the attachments of the unread mails. A processed mail is marked as read and
+// moved to the ProcessedMailbox. If an attachment could not be imported, or a mail has no
+// attachment which can be imported, the mail is marked as read, flagged and moved to the ErrorMailbox
+func (m *MailPoller) Poll() ([]Result, error) {
+	c, err := m.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if _, err = c.Select(m.config.Mailbox, false); err != nil {
+		return nil, fmt.Errorf("could not select mailbox '%s': %v", m.config.Mailbox, err)
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("could not search for unread mails: %v", err)
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	messages, err := fetch(c, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results   []Result
+		processed = new(imap.SeqSet)
+		failed    = new(imap.SeqSet)
+	)
+	for _, msg := range messages {
+		r, err := m.importMail(msg.raw)
+		if err == nil && len(r) == 0 {
+			err = fmt.Errorf("the mail has no attachment which can be imported")
+		}
+		var failedAttachments int
+		for _, ar := range r {
+			if ar.Err != nil {
+				log.Errorf("could not import attachment '%s' of mail '%d': %v", ar.File, msg.uid, ar.Err)
+				failedAttachments++
+			}
+		}
+		if err == nil && failedAttachments > 0 {
+			err = fmt.Errorf("%d of %d attachments could not be imported", failedAttachments, len(r))
+		}
+		results = append(results, r...)
+		if err != nil {
+			log.Errorf("could not import mail '%d': %v", msg.uid, err)
+			failed.AddNum(msg.uid)
+			continue
+		}
+		processed.AddNum(msg.uid)
+	}
+
+	// the mails are marked as read before they are moved, they are not imported again if a move fails
+	if !processed.Empty() {
+		if err = addFlags(c, processed, imap.SeenFlag); err != nil {
+			return results, err
+		}
+	}
+	if !failed.Empty() {
+		if err = addFlags(c, failed, imap.SeenFlag, imap.FlaggedFlag); err != nil {
+			return results, err
+		}
+	}
+	for _, target := range []struct {
+		mails   *imap.SeqSet
+		mailbox string
+	}{{processed, m.config.ProcessedMailbox}, {failed, m.config.ErrorMailbox}} {
+		if target.mails.Empty() || target.mailbox == "" {
+			continue
+		}
+		if err = move(c, target.mails, target.mailbox); err != nil {
+			return results, fmt.Errorf("could not move mails to '%s': %v", target.mailbox, err)
+		}
+	}
+	return results, nil
+}
+
+// connect establishes an authenticated connection to the IMAP server
+func (m *MailPoller) connect() (*client.Client, error) {
+	var (
+		c   *client.Client
+		err error
+	)
+	if m.config.TLS {
+		c, err = client.DialTLS(m.config.Address, &tls.Config{InsecureSkipVerify: m.config.InsecureSkipVerify})
+	} else {
+		c, err = client.Dial(m.config.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to '%s': %v", m.config.Address, err)
+	}
+	if err = c.Login(m.config.User, m.config.Password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("could not login as '%s': %v", m.config.User, err)
+	}
+	return c, nil
+}
+
+// importMail creates a document for each attachment of the mail with an allowed file-type
+// attachments of other types, e.g. signatures or logos, are ignored
+func (m *MailPoller) importMail(raw []byte) ([]Result, error) {
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("could not read mail: %v", err)
+	}
+	subject, err := mr.Header.Subject()
+	if err != nil {
+		log.Warnf("could not decode the subject of the mail: %v", err)
+	}
+	var senders []string
+	if from, err := mr.Header.AddressList("From"); err == nil && len(from) > 0 {
+		senders = []string{from[0].Address}
+	}
+
+	var results []Result
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, fmt.Errorf("could not read part of mail: %v", err)
+		}
+		h, ok := p.Header.(*mail.AttachmentHeader)
+		if !ok {
+			continue
+		}
+		name, err := h.Filename()
+		if err != nil || name == "" {
+			continue
+		}
+		name = filepath.Base(name)
+		if _, err = upload.AllowedType(m.uc.AllowedFileTypes, name); err != nil {
+			log.Debugf("ignore attachment '%s': %v", name, err)
+			continue
+		}
+
+		r := Result{File: name}
+		var body io.Reader = p.Body
+		if m.uc.MaxUploadSize > 0 {
+			body = io.LimitReader(p.Body, m.uc.MaxUploadSize+1)
+		}
+		payload, err := ioutil.ReadAll(body)
+		if err != nil {
+			r.Err = fmt.Errorf("could not read attachment: %v", err)
+		} else {
+			title := strings.TrimSpace(subject)
+			if title == "" {
+				title = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			r.ID, r.Err = importDocument(m.uploadRepo, m.importer, m.uc, documents.Document{
+				Title:    title,
+				FileName: name,
+				Senders:  senders,
+			}, payload, "")
+		}
+		if r.Err == nil {
+			log.Infof("imported attachment '%s' as document '%s'", name, r.ID)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// fetch retrieves the mails without marking them as read
+func fetch(c *client.Client, uids []uint32) ([]mailMessage, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+
+	ch := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, ch)
+	}()
+
+	var messages []mailMessage
+	for msg := range ch {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		raw, err := ioutil.ReadAll(body)
+		if err != nil {
+			log.Warnf("could not read mail '%d': %v", msg.Uid, err)
+			continue
+		}
+		messages = append(messages, mailMessage{uid: msg.Uid, raw: raw})
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("could not fetch mails: %v", err)
+	}
+	return messages, nil
+}
+
+// addFlags sets the given flags for the mails
+func addFlags(c *client.Client, seqset *imap.SeqSet, flags ...string) error {
+	values := make([]interface{}, len(flags))
+	for i, f := range flags {
+		values[i] = f
+	}
+	if err := c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), values, nil); err != nil {
+		return fmt.Errorf("could not set flags %v: %v", flags, err)
+	}
+	return nil
+}
+
+// move transfers the mails to the mailbox, if the server does not provide the MOVE extension
+// the mails are copied and the original mails are expunged
+func move(c *client.Client, seqset *imap.SeqSet, mailbox string) error {
+	if ok, _ := c.Support("MOVE"); ok {
+		err := c.UidMove(seqset, mailbox)
+		if err == nil {
+			return nil
+		}
+		log.Debugf("could not move mails, use copy instead: %v", err)
+	}
+	if err := c.UidCopy(seqset, mailbox); err != nil {
+		return err
+	}
+	if err := addFlags(c, seqset, imap.DeletedFlag); err != nil {
+		return err
+	}
+	return c.Expunge(nil)
+}
@@ -0,0 +1,209 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMail creates a multipart mail with the given attachments
+func newMail(subject string, attachments map[string]string) string {
+	var b strings.Builder
+	b.WriteString("From: Billing <billing@example.com>\r\n")
+	b.WriteString("To: invoices@example.com\r\n")
+	b.WriteString("Subject: " + subject + "\r\n")
+	b.WriteString("Date: Wed, 11 May 2016 14:31:59 +0000\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=\"frontier\"\r\n\r\n")
+	b.WriteString("--frontier\r\nContent-Type: text/plain\r\n\r\nPlease find the attached invoice.\r\n")
+	for name, payload := range attachments {
+		b.WriteString("--frontier\r\n")
+		b.WriteString("Content-Type: application/octet-stream\r\n")
+		b.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", name))
+		b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(payload)) + "\r\n")
+	}
+	b.WriteString("--frontier--\r\n")
+	return b.String()
+}
+
+// startIMAP runs a local IMAP server, the mailboxes Processed and Failed and the given mails are created
+func startIMAP(t *testing.T, mails ...string) (string, func()) {
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go s.Serve(l)
+
+	c := login(t, l.Addr().String())
+	defer c.Logout()
+	for _, mailbox := range []string{"Processed", "Failed"} {
+		if err := c.Create(mailbox); err != nil {
+			t.Fatalf("could not create mailbox: %v", err)
+		}
+	}
+	for _, m := range mails {
+		if err := c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(m)); err != nil {
+			t.Fatalf("could not append mail: %v", err)
+		}
+	}
+	return l.Addr().String(), func() { s.Close() }
+}
+
+func login(t *testing.T, addr string) *client.Client {
+	c, err := client.Dial(addr)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+	return c
+}
+
+// flags returns the flags of the mails in the mailbox
+func flags(t *testing.T, addr, mailbox string) [][]string {
+	c := login(t, addr)
+	defer c.Logout()
+	status, err := c.Select(mailbox, true)
+	if err != nil {
+		t.Fatalf("could not select mailbox: %v", err)
+	}
+	var result [][]string
+	if status.Messages == 0 {
+		return result
+	}
+	seqset := new(imap.SeqSet)
+	seqset.AddRange(1, status.Messages)
+	ch := make(chan *imap.Message, 10)
+	if err := c.Fetch(seqset, []imap.FetchItem{imap.FetchFlags}, ch); err != nil {
+		t.Fatalf("could not fetch mails: %v", err)
+	}
+	for msg := range ch {
+		result = append(result, msg.Flags)
+	}
+	return result
+}
+
+func TestNewMailPoller(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	if _, err := NewMailPoller(MailConfig{}, f.repos, f.fs, f.uc); err == nil {
+		t.Errorf("expected error for missing address and user")
+	}
+}
+
+func TestPollMails(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	addr, stop := startIMAP(t,
+		newMail("Invoice 2019-42", map[string]string{"invoice.pdf": pdfPayload, "terms.txt": "text"}),
+		newMail("Just text", map[string]string{"notes.txt": "text"}),
+	)
+	defer stop()
+
+	p, err := NewMailPoller(MailConfig{
+		Address:          addr,
+		User:             "username",
+		Password:         "password",
+		ProcessedMailbox: "Processed",
+	}, f.repos, f.fs, f.uc)
+	if err != nil {
+		t.Fatalf("could not create poller: %v", err)
+	}
+
+	results, err := p.Poll()
+	if err != nil {
+		t.Fatalf("could not poll mails: %v", err)
+	}
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "invoice.pdf", results[0].File)
+	assert.NoError(t, results[0].Err)
+
+	doc, err := f.repos.DocRepo.Get(results[0].ID)
+	if err != nil {
+		t.Fatalf("could not get imported document: %v", err)
+	}
+	assert.Equal(t, "Invoice 2019-42", doc.Title)
+	assert.Equal(t, "billing@example.com", doc.SenderList)
+	if _, err := f.fs.GetFile(doc.FileName); err != nil {
+		t.Errorf("the file of the document was not stored: %v", err)
+	}
+	uploads, _ := f.repos.UploadRepo.List()
+	assert.Equal(t, 0, len(uploads))
+
+	// the imported mail is moved, the mail without a PDF is flagged
+	assert.Equal(t, 1, len(flags(t, addr, "Processed")))
+	inbox := flags(t, addr, "INBOX")
+	assert.Equal(t, 2, len(inbox))
+	assert.Contains(t, inbox[1], imap.FlaggedFlag)
+	assert.Contains(t, inbox[1], imap.SeenFlag)
+
+	// all mails are read, nothing is imported again
+	results, err = p.Poll()
+	if err != nil {
+		t.Fatalf("could not poll mails: %v", err)
+	}
+	assert.Equal(t, 0, len(results))
+
+	// wrong credentials
+	p, _ = NewMailPoller(MailConfig{Address: addr, User: "username", Password: "wrong"}, f.repos, f.fs, f.uc)
+	if _, err := p.Poll(); err == nil {
+		t.Errorf("expected error for wrong credentials")
+	}
+}
+
+func TestPollMailsFailed(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	addr, stop := startIMAP(t,
+		newMail("Invoice 2019-43", map[string]string{"invoice.pdf": pdfPayload, "wrong.png": pdfPayload}),
+	)
+	defer stop()
+
+	p, err := NewMailPoller(MailConfig{
+		Address:          addr,
+		User:             "username",
+		Password:         "password",
+		ProcessedMailbox: "Processed",
+		ErrorMailbox:     "Failed",
+	}, f.repos, f.fs, f.uc)
+	if err != nil {
+		t.Fatalf("could not create poller: %v", err)
+	}
+
+	results, err := p.Poll()
+	if err != nil {
+		t.Fatalf("could not poll mails: %v", err)
+	}
+	assert.Equal(t, 2, len(results))
+	var failed int
+	for _, r := range results {
+		if r.Err != nil {
+			assert.Equal(t, "wrong.png", r.File)
+			failed++
+		}
+	}
+	assert.Equal(t, 1, failed)
+
+	// the mail with an attachment which could not be imported is moved to the error mailbox
+	assert.Equal(t, 0, len(flags(t, addr, "Processed")))
+	mails := flags(t, addr, "Failed")
+	assert.Equal(t, 1, len(mails))
+	assert.Contains(t, mails[0], imap.FlaggedFlag)
+}
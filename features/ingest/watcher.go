@@ -0,0 +1,257 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bihe/mydms/features/documents"
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/persistence"
+	log "github.com/sirupsen/logrus"
+)
+
+// Repositories combines the repositories used to import files
+type Repositories struct {
+	DocRepo    documents.Repository
+	UploadRepo upload.Repository
+}
+
+// Result describes the outcome of an imported file
+type Result struct {
+	// File is the path relative to the watched folder or the name of the mail attachment
+	File string
+	// ID is the id of the created document or the token of the created upload
+	ID string
+	// Err is the reason why the file could not be imported
+	Err error
+}
+
+// processingFolder is the hidden folder of the watched folder, which keeps the files during the import
+const processingFolder = ".processing"
+
+// Watcher imports the files placed in a folder and moves them to the archive or error folder
+type Watcher struct {
+	config     Config
+	uploadRepo upload.Repository
+	importer   *documents.Importer
+	uc         upload.Config
+}
+
+// NewWatcher creates a watcher for the configured folder
+// the file-types and sizes of the upload configuration apply to the imported files
+func NewWatcher(config Config, repos Repositories, fs filestore.FileService, uc upload.Config) (*Watcher, error) {
+	if config.Path == "" || config.ArchivePath == "" || config.ErrorPath == "" {
+		return nil, fmt.Errorf("the watched folder, the archive and the error folder need to be defined")
+	}
+	switch config.Mode {
+	case "":
+		config.Mode = DocumentMode
+	case DocumentMode, UploadMode:
+	default:
+		return nil, fmt.Errorf("unknown ingestion mode '%s'", config.Mode)
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.SettleTime <= 0 {
+		config.SettleTime = 30 * time.Second
+	}
+	for _, p := range []string{config.ArchivePath, config.ErrorPath} {
+		if err := os.MkdirAll(p, 0750); err != nil {
+			return nil, fmt.Errorf("could not create folder '%s': %v", p, err)
+		}
+	}
+	return &Watcher{
+		config:     config,
+		uploadRepo: repos.UploadRepo,
+		importer:   documents.NewImporter(documents.Repositories{DocRepo: repos.DocRepo, UploadRepo: repos.UploadRepo}, fs, uc),
+		uc:         uc,
+	}, nil
+}
+
+// Start periodically imports the files of the watched folder until the context is done, wg is done when the worker returned
+func (w *Watcher) Start(ctx context.Context, wg *sync.WaitGroup) {
+	log.Infof("watching folder '%s' to import files as %s", w.config.Path, w.config.Mode)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(w.config.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := w.Scan(); err != nil {
+				log.Errorf("could not import files of folder '%s': %v", w.config.Path, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scan imports the files of the watched folder, which were not modified within the SettleTime
+// hidden files and folders are ignored
+func (w *Watcher) Scan() ([]Result, error) {
+	root := filepath.Clean(w.config.Path)
+	skip := map[string]bool{
+		filepath.Clean(w.config.ArchivePath): true,
+		filepath.Clean(w.config.ErrorPath):   true,
+	}
+	settled := time.Now().Add(-w.config.SettleTime)
+
+	var files []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != root && (skip[p] || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), ".") && info.ModTime().Before(settled) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the watched folder: %v", err)
+	}
+
+	results := make([]Result, 0, len(files))
+	for _, p := range files {
+		rel, _ := filepath.Rel(root, p)
+		r := Result{File: rel}
+		// the file is claimed before the import, it is not imported again if it cannot be moved afterwards
+		claimed := filepath.Join(root, processingFolder, rel)
+		if err := claimFile(p, claimed); err != nil {
+			log.Errorf("could not claim file '%s' to import it: %v", rel, err)
+			continue
+		}
+		p = claimed
+		target := w.config.ArchivePath
+		if r.ID, r.Err = w.importFile(p, rel); r.Err != nil {
+			log.Errorf("could not import file '%s': %v", rel, r.Err)
+			target = w.config.ErrorPath
+		} else {
+			log.Infof("imported file '%s' as %s '%s'", rel, w.config.Mode, r.ID)
+		}
+		if err := moveFile(p, filepath.Join(target, rel)); err != nil {
+			log.Errorf("could not move file '%s' to '%s', the file is kept in '%s': %v", rel, target, processingFolder, err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// importFile creates either a document or an upload for the file
+func (w *Watcher) importFile(p, rel string) (string, error) {
+	payload, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", fmt.Errorf("could not read file: %v", err)
+	}
+	name := filepath.Base(rel)
+	if w.config.Mode == UploadMode {
+		u, err := upload.Store(w.uploadRepo, w.uc, name, payload, w.config.Owner)
+		return u.ID, err
+	}
+	// the title is the name of the file, the subfolders are used as tags
+	return importDocument(w.uploadRepo, w.importer, w.uc, documents.Document{
+		Title:    strings.TrimSuffix(name, filepath.Ext(name)),
+		FileName: name,
+		Tags:     tags(rel),
+	}, payload, w.config.Owner)
+}
+
+// importDocument stores the payload as an upload which is then used to create the document
+func importDocument(r upload.Repository, i *documents.Importer, uc upload.Config, d documents.Document, payload []byte, owner string) (string, error) {
+	u, err := upload.Store(r, uc, d.FileName, payload, owner)
+	if err != nil {
+		return "", err
+	}
+	d.UploadToken = u.ID
+	id, err := i.Import(d)
+	if err != nil {
+		removeUpload(r, uc, u)
+		return "", err
+	}
+	return id, nil
+}
+
+// removeUpload discards an upload which could not be turned into a document
+func removeUpload(r upload.Repository, uc upload.Config, u upload.Upload) {
+	uploadPath := filepath.Join(uc.UploadPath, u.ID+filepath.Ext(u.FileName))
+	if err := os.Remove(uploadPath); err != nil && !os.IsNotExist(err) {
+		log.Warnf("could not delete upload file '%s': %v", uploadPath, err)
+	}
+	if err := r.Delete(u.ID, persistence.Atomic{}); err != nil {
+		log.Warnf("could not delete upload item '%s': %v", u.ID, err)
+	}
+}
+
+// tags returns the names of the subfolders of the given relative path
+func tags(rel string) []string {
+	dir := filepath.Dir(rel)
+	if dir == "." {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(dir), "/")
+}
+
+// claimFile renames the file to the destination, which needs to be on the same device
+// an existing file is not replaced
+func claimFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("the file '%s' already exists", dst)
+	}
+	return os.Rename(src, dst)
+}
+
+// moveFile moves the file to the destination, an existing file is not replaced
+// if the file cannot be renamed, e.g. the destination is on another device, it is copied
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		ext := filepath.Ext(dst)
+		dst = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(dst, ext), time.Now().UnixNano(), ext)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -0,0 +1,255 @@
+package ingest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bihe/mydms/features/documents"
+	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/upload"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/schema"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// rather small PDF payload
+const pdfPayload = `%PDF-1.0
+1 0 obj<</Type/Catalog/Pages 2 0 R>>endobj 2 0 obj<</Type/Pages/Kids[3 0 R]/Count 1>>endobj 3 0 obj<</Type/Page/MediaBox[0 0 3 3]>>endobj
+xref
+0 4
+0000000000 65535 f
+0000000010 00000 n
+0000000053 00000 n
+0000000102 00000 n
+trailer<</Size 4/Root 1 0 R>>
+startxref
+149
+%EOF
+`
+
+type fixture struct {
+	dir     string
+	watched string
+	c       persistence.Connection
+	repos   Repositories
+	fs      filestore.FileService
+	uc      upload.Config
+}
+
+func setup(t *testing.T) fixture {
+	dir, err := ioutil.TempDir("", "mydms-ingest")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	c := persistence.NewConn("sqlite3", ":memory:")
+	m, err := persistence.NewMigrator(c, schema.Migrations)
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	dr, _ := documents.NewRepository(c)
+	ur, _ := upload.NewRepository(c)
+
+	f := fixture{
+		dir:     dir,
+		watched: filepath.Join(dir, "scans"),
+		c:       c,
+		repos:   Repositories{DocRepo: dr, UploadRepo: ur},
+		fs:      filestore.NewLocalService(filestore.LocalConfig{RootPath: filepath.Join(dir, "store")}),
+		uc: upload.Config{
+			AllowedFileTypes: []string{"pdf", "png"},
+			MaxUploadSize:    10000,
+			UploadPath:       filepath.Join(dir, "uploads"),
+		},
+	}
+	os.MkdirAll(f.uc.UploadPath, 0750)
+	return f
+}
+
+func (f fixture) close() {
+	f.c.Close()
+	os.RemoveAll(f.dir)
+}
+
+// place writes a file to the watched folder, the file is settled unless recent is set
+func (f fixture) place(t *testing.T, rel, payload string, recent bool) {
+	p := filepath.Join(f.watched, rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		t.Fatalf("could not create folder: %v", err)
+	}
+	if err := ioutil.WriteFile(p, []byte(payload), 0640); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+	if !recent {
+		old := time.Now().Add(-time.Hour)
+		os.Chtimes(p, old, old)
+	}
+}
+
+func (f fixture) exists(rel ...string) bool {
+	_, err := os.Stat(filepath.Join(append([]string{f.dir}, rel...)...))
+	return err == nil
+}
+
+func TestNewWatcher(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	if _, err := NewWatcher(Config{Path: f.watched}, f.repos, f.fs, f.uc); err == nil {
+		t.Errorf("expected error for missing archive and error folder")
+	}
+	_, err := NewWatcher(Config{Path: f.watched, ArchivePath: filepath.Join(f.dir, "archive"), ErrorPath: filepath.Join(f.dir, "error"), Mode: "unknown"}, f.repos, f.fs, f.uc)
+	if err == nil {
+		t.Errorf("expected error for unknown mode")
+	}
+}
+
+func TestScanDocuments(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	w, err := NewWatcher(Config{
+		Path:        f.watched,
+		ArchivePath: filepath.Join(f.watched, "archive"),
+		ErrorPath:   filepath.Join(f.dir, "error"),
+	}, f.repos, f.fs, f.uc)
+	if err != nil {
+		t.Fatalf("could not create watcher: %v", err)
+	}
+
+	f.place(t, "invoice.pdf", pdfPayload, false)
+	f.place(t, "Insurance/Car/policy.pdf", pdfPayload, false)
+	f.place(t, "scanning.pdf", pdfPayload, true)
+	f.place(t, ".hidden.pdf", pdfPayload, false)
+	f.place(t, "wrong.png", pdfPayload, false)
+	f.place(t, "notes.txt", "text", false)
+
+	results, err := w.Scan()
+	if err != nil {
+		t.Fatalf("could not scan folder: %v", err)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].File < results[j].File })
+	assert.Equal(t, 4, len(results))
+	assert.Equal(t, filepath.Join("Insurance", "Car", "policy.pdf"), results[0].File)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "invoice.pdf", results[1].File)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, "notes.txt", results[2].File)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, "wrong.png", results[3].File)
+	assert.Error(t, results[3].Err)
+
+	doc, err := f.repos.DocRepo.Get(results[0].ID)
+	if err != nil {
+		t.Fatalf("could not get imported document: %v", err)
+	}
+	assert.Equal(t, "policy", doc.Title)
+	assert.Equal(t, "Insurance;Car", doc.TagList)
+	if _, err := f.fs.GetFile(doc.FileName); err != nil {
+		t.Errorf("the file of the document was not stored: %v", err)
+	}
+
+	assert.True(t, f.exists("scans", "archive", "invoice.pdf"))
+	assert.True(t, f.exists("scans", "archive", "Insurance", "Car", "policy.pdf"))
+	assert.True(t, f.exists("error", "notes.txt"))
+	assert.True(t, f.exists("error", "wrong.png"))
+	assert.True(t, f.exists("scans", "scanning.pdf"))
+	assert.True(t, f.exists("scans", ".hidden.pdf"))
+	assert.False(t, f.exists("scans", "invoice.pdf"))
+
+	// the archived files are not imported again, an existing archive file is kept
+	f.place(t, "invoice.pdf", pdfPayload, false)
+	results, err = w.Scan()
+	if err != nil {
+		t.Fatalf("could not scan folder: %v", err)
+	}
+	assert.Equal(t, 1, len(results))
+	files, _ := filepath.Glob(filepath.Join(f.watched, "archive", "invoice*.pdf"))
+	assert.Equal(t, 2, len(files))
+}
+
+func TestScanMoveFail(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	archive := filepath.Join(f.dir, "archive")
+	w, err := NewWatcher(Config{
+		Path:        f.watched,
+		ArchivePath: archive,
+		ErrorPath:   filepath.Join(f.dir, "error"),
+	}, f.repos, f.fs, f.uc)
+	if err != nil {
+		t.Fatalf("could not create watcher: %v", err)
+	}
+	// the imported file cannot be moved to the archive
+	os.RemoveAll(archive)
+	ioutil.WriteFile(archive, []byte("file"), 0640)
+	f.place(t, "invoice.pdf", pdfPayload, false)
+
+	results, err := w.Scan()
+	if err != nil {
+		t.Fatalf("could not scan folder: %v", err)
+	}
+	assert.Equal(t, 1, len(results))
+	assert.NoError(t, results[0].Err)
+	assert.True(t, f.exists("scans", processingFolder, "invoice.pdf"))
+	assert.False(t, f.exists("scans", "invoice.pdf"))
+
+	// the claimed file is not imported again
+	results, err = w.Scan()
+	if err != nil {
+		t.Fatalf("could not scan folder: %v", err)
+	}
+	assert.Equal(t, 0, len(results))
+
+	// a file of the same name is not imported while the claimed file is kept
+	f.place(t, "invoice.pdf", pdfPayload, false)
+	results, err = w.Scan()
+	if err != nil {
+		t.Fatalf("could not scan folder: %v", err)
+	}
+	assert.Equal(t, 0, len(results))
+	assert.True(t, f.exists("scans", "invoice.pdf"))
+}
+
+func TestScanUploads(t *testing.T) {
+	f := setup(t)
+	defer f.close()
+
+	w, err := NewWatcher(Config{
+		Path:        f.watched,
+		ArchivePath: filepath.Join(f.dir, "archive"),
+		ErrorPath:   filepath.Join(f.dir, "error"),
+		Mode:        UploadMode,
+		Owner:       "scanner",
+	}, f.repos, f.fs, f.uc)
+	if err != nil {
+		t.Fatalf("could not create watcher: %v", err)
+	}
+	f.place(t, "Invoices/invoice.pdf", pdfPayload, false)
+
+	results, err := w.Scan()
+	if err != nil {
+		t.Fatalf("could not scan folder: %v", err)
+	}
+	assert.Equal(t, 1, len(results))
+	assert.NoError(t, results[0].Err)
+
+	u, err := f.repos.UploadRepo.Read(results[0].ID)
+	if err != nil {
+		t.Fatalf("could not get the upload: %v", err)
+	}
+	assert.Equal(t, "invoice.pdf", u.FileName)
+	assert.Equal(t, "application/pdf", u.MimeType)
+	assert.Equal(t, "scanner", u.Owner)
+	assert.True(t, f.exists("uploads", u.ID+".pdf"))
+	assert.True(t, f.exists("archive", "Invoices", "invoice.pdf"))
+}
@@ -1,17 +1,20 @@
 package upload
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/bihe/mydms/internal/errors"
 	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/security"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
@@ -23,20 +26,46 @@ type Result struct {
 	Message string `json:"message"`
 }
 
+// FileResult is the outcome of a single file of a multi-file upload
+type FileResult struct {
+	FileName string `json:"fileName"`
+	Token    string `json:"token,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MultiResult lists the outcome of each file of a multi-file upload
+type MultiResult struct {
+	Uploaded int          `json:"uploaded"`
+	Results  []FileResult `json:"results"`
+}
+
+// PendingUpload describes an upload, which was not used to save a document yet
+type PendingUpload struct {
+	Token    string    `json:"token"`
+	FileName string    `json:"fileName"`
+	MimeType string    `json:"mimeType"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+}
+
 // Handler defines the upload API
 type Handler struct {
 	r      Repository
 	config Config
+
+	// active holds the ids of resumable uploads which are processed by a request
+	mutex  sync.Mutex
+	active map[string]bool
 }
 
 // NewHandler returns a pointer to a new handler instance
 func NewHandler(r Repository, config Config) *Handler {
-	return &Handler{r: r, config: config}
+	return &Handler{r: r, config: config, active: make(map[string]bool)}
 }
 
 // UploadFile godoc
 // @Summary upload a document
-// @Description temporarily stores a file and creates a item in the repository
+// @Description temporarily stores a file and creates a item in the repository, the content of the file needs to match the file-type
 // @Tags upload
 // @Consumes multipart/form-data
 // @Produce  json
@@ -52,65 +81,285 @@ func (h *Handler) UploadFile(c echo.Context) error {
 	if err != nil {
 		return errors.BadRequestError{Err: fmt.Errorf("no file provided: %v", err), Request: c.Request()}
 	}
+	u, err := h.storeFile(c, file)
+	if err != nil {
+		return err
+	}
+	c.JSON(http.StatusCreated, Result{Token: u.ID, Message: fmt.Sprintf("File '%s' was uploaded successfully!", file.Filename)})
 
-	if file.Size > h.config.MaxUploadSize {
-		return errors.BadRequestError{
-			Err:     fmt.Errorf("the upload exceeds the maximum size of %d - filesize is: %d", h.config.MaxUploadSize, file.Size),
-			Request: c.Request()}
+	return nil
+}
+
+// UploadFiles godoc
+// @Summary upload multiple documents
+// @Description temporarily stores the files and creates items in the repository, each file is validated on its own
+// @Description the result lists the token or the error of each file in the order of the request
+// @Tags upload
+// @Consumes multipart/form-data
+// @Produce  json
+// @Param files formData file true "files to upload"
+// @Success 200 {object} upload.MultiResult
+// @Failure 400 {object} errors.ProblemDetail
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Router /api/v1/upload/files [post]
+func (h *Handler) UploadFiles(c echo.Context) error {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return errors.BadRequestError{Err: fmt.Errorf("no files provided: %v", err), Request: c.Request()}
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		return errors.BadRequestError{Err: fmt.Errorf("no files provided"), Request: c.Request()}
 	}
 
-	ext := filepath.Ext(file.Filename)
-	ext = strings.Replace(ext, ".", "", 1)
-	var typeAllowed = false
-	for _, t := range h.config.AllowedFileTypes {
-		if t == ext {
-			typeAllowed = true
-			break
+	result := MultiResult{Results: make([]FileResult, 0, len(files))}
+	for _, file := range files {
+		r := FileResult{FileName: file.Filename}
+		u, err := h.storeFile(c, file)
+		if err != nil {
+			log.Warnf("could not upload file '%s': %v", file.Filename, err)
+			r.Error = errorDetail(err)
+		} else {
+			r.Token = u.ID
+			result.Uploaded++
 		}
+		result.Results = append(result.Results, r)
 	}
-	if !typeAllowed {
-		return errors.BadRequestError{
-			Err:     fmt.Errorf("the uploaded file-type '%s' is not allowed, only use: '%s'", ext, strings.Join(h.config.AllowedFileTypes, ",")),
+	return c.JSON(http.StatusOK, result)
+}
+
+// storeFile validates the given file and stores it in the UploadPath with an upload item
+// the returned error is an API error
+func (h *Handler) storeFile(c echo.Context, file *multipart.FileHeader) (Upload, error) {
+	if file.Size > h.config.MaxUploadSize {
+		return Upload{}, errors.BadRequestError{
+			Err:     fmt.Errorf("the upload exceeds the maximum size of %d - filesize is: %d", h.config.MaxUploadSize, file.Size),
 			Request: c.Request()}
 	}
-	mimeType := file.Header.Get("Content-Type")
+
+	ext, err := h.fileType(file.Filename)
+	if err != nil {
+		return Upload{}, errors.BadRequestError{Err: err, Request: c.Request()}
+	}
 
 	src, err := file.Open()
 	if err != nil {
-		return errors.BadRequestError{Err: fmt.Errorf("could not open upload file: %v", err), Request: c.Request()}
+		return Upload{}, errors.BadRequestError{Err: fmt.Errorf("could not open upload file: %v", err), Request: c.Request()}
 	}
 	defer src.Close()
 
+	// the type of the file is determined by its content, the client supplied Content-Type is not trusted
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Upload{}, errors.BadRequestError{Err: fmt.Errorf("could not read upload file: %v", err), Request: c.Request()}
+	}
+	header = header[:n]
+	mimeType, err := DetectMimeType(header, ext)
+	if err != nil {
+		return Upload{}, errors.BadRequestError{Err: err, Request: c.Request()}
+	}
+
 	// Destination
 	id := uuid.New().String()
 	var tempFileName = id + "." + ext
 	uploadPath := path.Join(h.config.UploadPath, tempFileName)
 	dst, err := os.Create(uploadPath)
 	if err != nil {
-		return errors.ServerError{Err: fmt.Errorf("could not create file: %v", err), Request: c.Request()}
+		return Upload{}, errors.ServerError{Err: fmt.Errorf("could not create file: %v", err), Request: c.Request()}
 	}
 	defer dst.Close()
 
 	// Copy
-	if _, err = io.Copy(dst, src); err != nil {
-		return errors.ServerError{Err: fmt.Errorf("could not copy file: %v", err), Request: c.Request()}
+	if _, err = io.Copy(dst, io.MultiReader(bytes.NewReader(header), src)); err != nil {
+		return Upload{}, errors.ServerError{Err: fmt.Errorf("could not copy file: %v", err), Request: c.Request()}
 	}
+	dst.Close()
 
 	u := Upload{
 		ID:       id,
 		FileName: file.Filename,
 		MimeType: mimeType,
 		Created:  time.Now().UTC(),
+		Owner:    owner(c),
 	}
+	if err = convertImage(h.config, &u); err != nil {
+		os.Remove(uploadPath)
+		return Upload{}, errors.BadRequestError{Err: err, Request: c.Request()}
+	}
+	uploadPath = h.uploadPath(u)
 	err = h.r.Write(u, persistence.Atomic{})
 	if err != nil {
 		ioerr := os.Remove(uploadPath)
 		if ioerr != nil {
 			log.Warnf("Clean-Up file-upload. Could not delete temp file: '%s': %v", uploadPath, ioerr)
 		}
-		return errors.ServerError{Err: fmt.Errorf("could not save upload item in store: %v", err), Request: c.Request()}
+		return Upload{}, errors.ServerError{Err: fmt.Errorf("could not save upload item in store: %v", err), Request: c.Request()}
+	}
+	return u, nil
+}
+
+// errorDetail returns the cause of an API error
+func errorDetail(err error) string {
+	switch e := err.(type) {
+	case errors.BadRequestError:
+		return e.Err.Error()
+	case errors.ServerError:
+		return e.Err.Error()
+	}
+	return err.Error()
+}
+
+// ListUploads godoc
+// @Summary list pending uploads
+// @Description returns the uploads of the current user, which were not used to save a document yet
+// @Tags upload
+// @Produce  json
+// @Success 200 {array} upload.PendingUpload
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/upload [get]
+func (h *Handler) ListUploads(c echo.Context) error {
+	uploads, err := h.r.ListByOwner(owner(c))
+	if err != nil {
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+	pending := make([]PendingUpload, 0, len(uploads))
+	for _, u := range uploads {
+		pending = append(pending, h.pendingUpload(u))
 	}
-	c.JSON(http.StatusCreated, Result{Token: id, Message: fmt.Sprintf("File '%s' was uploaded successfully!", file.Filename)})
+	return c.JSON(http.StatusOK, pending)
+}
 
+// GetUpload godoc
+// @Summary get a pending upload
+// @Description returns the metadata of the upload identified by the token
+// @Tags upload
+// @Produce  json
+// @Param id path string true "upload token"
+// @Success 200 {object} upload.PendingUpload
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Router /api/v1/upload/{id} [get]
+func (h *Handler) GetUpload(c echo.Context) error {
+	u, err := h.readUpload(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, h.pendingUpload(u))
+}
+
+// PreviewUpload godoc
+// @Summary preview a pending upload
+// @Description returns the uploaded file identified by the token
+// @Tags upload
+// @Produce  application/pdf
+// @Param id path string true "upload token"
+// @Success 200 {file} binary
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Router /api/v1/upload/{id}/preview [get]
+func (h *Handler) PreviewUpload(c echo.Context) error {
+	u, err := h.readUpload(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(h.uploadPath(u))
+	if err != nil {
+		return errors.NotFoundError{Err: fmt.Errorf("the file of upload '%s' is not available: %v", u.ID, err), Request: c.Request()}
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return errors.ServerError{Err: fmt.Errorf("could not get file information of upload '%s': %v", u.ID, err), Request: c.Request()}
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, u.MimeType)
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", u.FileName))
+	http.ServeContent(c.Response(), c.Request(), u.FileName, stat.ModTime(), f)
 	return nil
 }
+
+// DeleteUpload godoc
+// @Summary discard a pending upload
+// @Description removes the upload identified by the token together with the uploaded file
+// @Tags upload
+// @Param id path string true "upload token"
+// @Success 204
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/upload/{id} [delete]
+func (h *Handler) DeleteUpload(c echo.Context) error {
+	u, err := h.readUpload(c)
+	if err != nil {
+		return err
+	}
+	if err = h.r.Delete(u.ID, persistence.Atomic{}); err != nil {
+		return errors.ServerError{Err: err, Request: c.Request()}
+	}
+	h.removeFiles(u.ID)
+	log.Infof("discarded upload '%s' of file '%s'", u.ID, u.FileName)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// removeFiles deletes the upload file and the state of a resumable upload
+func (h *Handler) removeFiles(id string) {
+	files, _ := filepath.Glob(path.Join(h.config.UploadPath, id+".*"))
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			log.Warnf("could not delete upload file '%s': %v", f, err)
+		}
+	}
+}
+
+// readUpload returns the upload identified by the id parameter, if it belongs to the current user
+func (h *Handler) readUpload(c echo.Context) (Upload, error) {
+	id := c.Param("id")
+	u, err := h.r.Read(id)
+	if err != nil {
+		return Upload{}, errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+	if u.Owner != owner(c) {
+		return Upload{}, errors.NotFoundError{Err: fmt.Errorf("the upload '%s' is not available", id), Request: c.Request()}
+	}
+	return u, nil
+}
+
+// pendingUpload converts the upload item, the size is determined by the uploaded file
+func (h *Handler) pendingUpload(u Upload) PendingUpload {
+	p := PendingUpload{
+		Token:    u.ID,
+		FileName: u.FileName,
+		MimeType: u.MimeType,
+		Created:  u.Created,
+	}
+	if stat, err := os.Stat(h.uploadPath(u)); err == nil {
+		p.Size = stat.Size()
+	}
+	return p
+}
+
+// uploadPath returns the path of the uploaded file
+func (h *Handler) uploadPath(u Upload) string {
+	return path.Join(h.config.UploadPath, u.ID+filepath.Ext(u.FileName))
+}
+
+// owner returns the name of the authenticated user
+func owner(c echo.Context) string {
+	if sc, ok := c.(*security.ServerContext); ok {
+		return sc.Identity.Username
+	}
+	return ""
+}
+
+// fileType returns the extension of the given file name if the type is allowed to be uploaded
+func (h *Handler) fileType(fileName string) (string, error) {
+	return AllowedType(h.config.AllowedFileTypes, fileName)
+}
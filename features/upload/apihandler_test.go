@@ -5,15 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/security"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+
+	sec "golang.binggl.net/commons/security"
 )
 
 // rather small PDF payload
@@ -38,6 +44,8 @@ const contentType = "Content-Type"
 
 // Write(item Upload, a persistence.Atomic) (err error)
 // Read(id string) (Upload, error)
+// List() ([]Upload, error)
+// ListByOwner(owner string) ([]Upload, error)
 // Delete(id string, a persistence.Atomic) (err error)
 type mockRepository struct{}
 
@@ -52,6 +60,14 @@ func (m mockRepository) Read(id string) (Upload, error) {
 	return Upload{}, nil
 }
 
+func (m mockRepository) List() ([]Upload, error) {
+	return nil, nil
+}
+
+func (m mockRepository) ListByOwner(owner string) ([]Upload, error) {
+	return nil, nil
+}
+
 func (m mockRepository) Delete(id string, a persistence.Atomic) (err error) {
 	return nil
 }
@@ -61,13 +77,17 @@ func (m mockRepository) CreateAtomic() (persistence.Atomic, error) {
 }
 
 func setup(t *testing.T, config Config, formfield, file string) (echo.Context, *Handler, *httptest.ResponseRecorder) {
+	return setupPayload(t, config, formfield, file, []byte(pdfPayload))
+}
+
+func setupPayload(t *testing.T, config Config, formfield, file string, payload []byte) (echo.Context, *Handler, *httptest.ResponseRecorder) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	part, err := writer.CreateFormFile(formfield, file)
 	if err != nil {
 		t.Fatalf(multipartErr, err)
 	}
-	io.Copy(part, bytes.NewBuffer([]byte(pdfPayload)))
+	io.Copy(part, bytes.NewBuffer(payload))
 	writer.Close()
 
 	e := echo.New()
@@ -178,3 +198,156 @@ func TestUploadFileTypeFail(t *testing.T) {
 		t.Errorf("expected error upload file type!")
 	}
 }
+
+func TestUploadContentMismatch(t *testing.T) {
+	config := Config{
+		AllowedFileTypes: []string{"png", "pdf"},
+		MaxUploadSize:    10000,
+	}
+
+	// an executable renamed to pdf
+	c, h, _ := setupPayload(t, config, "file", fileName, []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00"))
+	if err := h.UploadFile(c); err == nil {
+		t.Errorf("expected error for content not matching the file-type!")
+	}
+
+	// a pdf renamed to png
+	c, h, _ = setupPayload(t, config, "file", "test.png", []byte(pdfPayload))
+	if err := h.UploadFile(c); err == nil {
+		t.Errorf("expected error for content not matching the file-type!")
+	}
+}
+
+func TestPendingUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydms-pending")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const (
+		own   = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0001"
+		other = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0002"
+	)
+	repo := &memRepository{items: map[string]Upload{
+		own:   {ID: own, FileName: fileName, MimeType: "application/pdf", Created: time.Now().UTC(), Owner: "user"},
+		other: {ID: other, FileName: fileName, MimeType: "application/pdf", Created: time.Now().UTC(), Owner: "other"},
+	}}
+	for _, id := range []string{own, other} {
+		if err := ioutil.WriteFile(filepath.Join(dir, id+".pdf"), []byte(pdfPayload), 0640); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+	}
+	h := NewHandler(repo, Config{UploadPath: dir})
+	request := func(method, id string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		return &security.ServerContext{Context: c, Identity: sec.User{Username: "user"}}, rec
+	}
+
+	c, rec := request(http.MethodGet, "")
+	if assert.NoError(t, h.ListUploads(c)) {
+		var pending []PendingUpload
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+		assert.Equal(t, 1, len(pending))
+		assert.Equal(t, own, pending[0].Token)
+		assert.Equal(t, int64(len(pdfPayload)), pending[0].Size)
+	}
+
+	c, rec = request(http.MethodGet, own)
+	if assert.NoError(t, h.GetUpload(c)) {
+		var pending PendingUpload
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+		assert.Equal(t, fileName, pending.FileName)
+		assert.Equal(t, "application/pdf", pending.MimeType)
+	}
+
+	c, rec = request(http.MethodGet, own)
+	if assert.NoError(t, h.PreviewUpload(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/pdf", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, pdfPayload, rec.Body.String())
+	}
+
+	// uploads of other users are not available
+	c, _ = request(http.MethodGet, other)
+	assert.Error(t, h.GetUpload(c))
+	c, _ = request(http.MethodGet, other)
+	assert.Error(t, h.PreviewUpload(c))
+	c, _ = request(http.MethodDelete, other)
+	assert.Error(t, h.DeleteUpload(c))
+
+	c, rec = request(http.MethodDelete, own)
+	if assert.NoError(t, h.DeleteUpload(c)) {
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, own+".pdf")); !os.IsNotExist(err) {
+		t.Errorf("the upload file should be removed")
+	}
+	c, _ = request(http.MethodGet, own)
+	assert.Error(t, h.GetUpload(c))
+	_, ok := repo.items[other]
+	assert.True(t, ok)
+}
+
+func TestUploadFiles(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	files := []struct {
+		name    string
+		payload string
+	}{
+		{fileName, pdfPayload},
+		{"test.png", pdfPayload},
+		{"test.txt", "text"},
+		{"large.pdf", pdfPayload + pdfPayload},
+		{"error.pdf", pdfPayload},
+	}
+	for _, f := range files {
+		part, err := writer.CreateFormFile("files", f.name)
+		if err != nil {
+			t.Fatalf(multipartErr, err)
+		}
+		io.Copy(part, bytes.NewBufferString(f.payload))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Add(contentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	h := NewHandler(mockRepository{}, Config{
+		AllowedFileTypes: []string{"png", "pdf"},
+		MaxUploadSize:    int64(len(pdfPayload)),
+		UploadPath:       os.TempDir(),
+	})
+
+	if assert.NoError(t, h.UploadFiles(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var r MultiResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+			t.Fatalf("could not get valid json: %v", err)
+		}
+		assert.Equal(t, 1, r.Uploaded)
+		assert.Equal(t, len(files), len(r.Results))
+		for i, f := range files {
+			assert.Equal(t, f.name, r.Results[i].FileName)
+		}
+		assert.NotEmpty(t, r.Results[0].Token)
+		os.Remove(filepath.Join(os.TempDir(), r.Results[0].Token+".pdf"))
+		for _, res := range r.Results[1:] {
+			assert.Empty(t, res.Token)
+			assert.NotEmpty(t, res.Error)
+		}
+	}
+
+	// the files need to be supplied
+	c, h, _ = setup(t, Config{
+		AllowedFileTypes: []string{"pdf"},
+		MaxUploadSize:    10000,
+	}, "file", fileName)
+	assert.Error(t, h.UploadFiles(c))
+}
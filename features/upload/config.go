@@ -1,5 +1,7 @@
 package upload
 
+import "time"
+
 // Config defines relevant values for the upload logic
 type Config struct {
 	// AllowedFileTypes is a list of mime-types allowed to be uploaded
@@ -8,4 +10,13 @@ type Config struct {
 	MaxUploadSize int64
 	// UploadPath defines a directory where uploaded files are stored
 	UploadPath string
+	// TokenTTL defines how long an upload is kept, expired uploads are removed by the janitor
+	TokenTTL time.Duration
+	// CleanupInterval defines how often the janitor removes expired uploads
+	CleanupInterval time.Duration
+	// ConvertImages wraps uploaded images in a PDF document
+	ConvertImages bool
+	// RejectDuplicates refuses to save a document, if the uploaded file is already stored by another document
+	// otherwise the existing documents are only reported
+	RejectDuplicates bool
 }
@@ -0,0 +1,56 @@
+package upload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bihe/mydms/internal/pdf"
+	log "github.com/sirupsen/logrus"
+)
+
+const pdfMimeType = "application/pdf"
+
+// convertImage replaces an uploaded image by a PDF document if ConvertImages is set
+// the upload receives the name and the mime-type of the PDF document
+func convertImage(config Config, u *Upload) error {
+	imagePath := filepath.Join(config.UploadPath, u.ID+filepath.Ext(u.FileName))
+	converted, err := convertFile(config, u, imagePath)
+	if err != nil || !converted {
+		return err
+	}
+	if err = os.Remove(imagePath); err != nil {
+		log.Warnf("could not delete the converted image '%s': %v", imagePath, err)
+	}
+	return nil
+}
+
+// convertFile creates the PDF document of the upload from the image at the given path, the image is kept
+// the result indicates if the upload was converted
+func convertFile(config Config, u *Upload, imagePath string) (bool, error) {
+	if !config.ConvertImages || !pdf.IsImage(u.MimeType) {
+		return false, nil
+	}
+	payload, err := ioutil.ReadFile(imagePath)
+	if err != nil {
+		return false, fmt.Errorf("could not read uploaded image: %v", err)
+	}
+	converted, err := pdf.FromImages(payload)
+	if err != nil {
+		return false, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(config.UploadPath, u.ID+".pdf"), converted, 0640); err != nil {
+		return false, fmt.Errorf("could not create file: %v", err)
+	}
+	log.Debugf("converted uploaded image '%s' to a PDF document", u.FileName)
+	u.FileName = pdfName(u.FileName)
+	u.MimeType = pdfMimeType
+	return true, nil
+}
+
+// pdfName replaces the extension of the file name by .pdf
+func pdfName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".pdf"
+}
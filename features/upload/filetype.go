@@ -0,0 +1,62 @@
+package upload
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLen is the number of bytes used to detect the type of a file
+// it is the same amount http.DetectContentType considers
+const sniffLen = 512
+
+const octetStream = "application/octet-stream"
+
+// knownTypes maps the file extensions to the mime-type their content needs to have
+var knownTypes = map[string]string{
+	"pdf":  "application/pdf",
+	"png":  "image/png",
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"tif":  "image/tiff",
+	"tiff": "image/tiff",
+}
+
+// DetectMimeType determines the mime-type of a file by the magic bytes of its content
+// the detected type needs to match the type defined by the file extension, a mismatch
+// results in an error. For extensions without a known type the detected type is returned
+func DetectMimeType(header []byte, ext string) (string, error) {
+	detected := sniff(header)
+	ext = strings.ToLower(ext)
+
+	expected, ok := knownTypes[ext]
+	if !ok {
+		if detected == octetStream {
+			if t := mime.TypeByExtension("." + ext); t != "" {
+				return t, nil
+			}
+		}
+		return detected, nil
+	}
+	if detected != expected {
+		return "", fmt.Errorf("the content of the file (%s) does not match the file-type '%s'", detected, ext)
+	}
+	return detected, nil
+}
+
+// sniff returns the media-type of the given content without any parameters
+func sniff(header []byte) string {
+	// TIFF is not covered by http.DetectContentType
+	if bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")) {
+		return "image/tiff"
+	}
+	t, _, err := mime.ParseMediaType(http.DetectContentType(header))
+	if err != nil {
+		return octetStream
+	}
+	return t
+}
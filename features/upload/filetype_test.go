@@ -0,0 +1,44 @@
+package upload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	png := []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")
+	jpeg := []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00")
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	exe := []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00")
+
+	cases := []struct {
+		name     string
+		header   []byte
+		ext      string
+		mimeType string
+		fail     bool
+	}{
+		{"pdf", []byte(pdfPayload), "pdf", "application/pdf", false},
+		{"png", png, "png", "image/png", false},
+		{"jpeg", jpeg, "jpg", "image/jpeg", false},
+		{"uppercase extension", jpeg, "JPEG", "image/jpeg", false},
+		{"tiff", tiff, "tif", "image/tiff", false},
+		{"text", []byte("some text"), "txt", "text/plain", false},
+		{"executable as pdf", exe, "pdf", "", true},
+		{"pdf as png", []byte(pdfPayload), "png", "", true},
+		{"png as jpg", png, "jpg", "", true},
+		{"empty pdf", []byte{}, "pdf", "", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mimeType, err := DetectMimeType(c.header, c.ext)
+			if c.fail {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.mimeType, mimeType)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Janitor removes uploads which were not used to save a document within the TokenTTL
+type Janitor struct {
+	r      Repository
+	config Config
+}
+
+// CleanupResult lists the items removed by the janitor
+type CleanupResult struct {
+	// Tokens are the expired upload items
+	Tokens []string
+	// Files are the removed files of the upload path, including files without an upload item
+	Files []string
+}
+
+// NewJanitor returns a janitor for the uploads of the repository and the UploadPath
+func NewJanitor(r Repository, config Config) *Janitor {
+	return &Janitor{r: r, config: config}
+}
+
+// Start periodically removes the expired uploads until the context is done, wg is done when the worker returned
+// nothing is done if no TokenTTL is defined
+func (j *Janitor) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if j.config.TokenTTL <= 0 {
+		log.Info("no TokenTTL defined, expired uploads are not removed")
+		return
+	}
+	interval := j.config.CleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := j.Cleanup(); err != nil {
+				log.Errorf("could not remove expired uploads: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Cleanup removes the upload items created before the TokenTTL together with their files
+// files of the upload path without an upload item are removed, if they were not modified within the TokenTTL
+func (j *Janitor) Cleanup() (CleanupResult, error) {
+	var result CleanupResult
+	if j.config.TokenTTL <= 0 {
+		return result, fmt.Errorf("no TokenTTL defined")
+	}
+	expiry := time.Now().UTC().Add(-j.config.TokenTTL)
+
+	uploads, err := j.r.List()
+	if err != nil {
+		return result, err
+	}
+	valid := make(map[string]bool)
+	for _, u := range uploads {
+		if u.Created.After(expiry) {
+			valid[u.ID] = true
+			continue
+		}
+		if err := j.r.Delete(u.ID, persistence.Atomic{}); err != nil {
+			log.Errorf("could not delete the expired upload item '%s': %v", u.ID, err)
+			valid[u.ID] = true
+			continue
+		}
+		log.Infof("removed expired upload '%s' of file '%s' created at %s", u.ID, u.FileName, u.Created.Format(time.RFC3339))
+		result.Tokens = append(result.Tokens, u.ID)
+	}
+
+	files, err := ioutil.ReadDir(j.config.UploadPath)
+	if err != nil {
+		return result, fmt.Errorf("could not read the upload path '%s': %v", j.config.UploadPath, err)
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// the files of an upload are named by the token and one or more extensions
+		// other files of the upload path are left untouched
+		id := strings.SplitN(f.Name(), ".", 2)[0]
+		if _, err := uuid.Parse(id); err != nil || valid[id] || f.ModTime().After(expiry) {
+			continue
+		}
+		p := filepath.Join(j.config.UploadPath, f.Name())
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.Warnf("could not delete the upload file '%s': %v", p, err)
+			continue
+		}
+		log.Infof("removed upload file '%s'", p)
+		result.Files = append(result.Files, f.Name())
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+// memRepository keeps the upload items in memory
+type memRepository struct {
+	mockRepository
+	items map[string]Upload
+}
+
+func (m *memRepository) List() ([]Upload, error) {
+	var uploads []Upload
+	for _, u := range m.items {
+		uploads = append(uploads, u)
+	}
+	return uploads, nil
+}
+
+func (m *memRepository) Read(id string) (Upload, error) {
+	u, ok := m.items[id]
+	if !ok {
+		return Upload{}, fmt.Errorf("no item '%s'", id)
+	}
+	return u, nil
+}
+
+func (m *memRepository) ListByOwner(owner string) ([]Upload, error) {
+	var uploads []Upload
+	for _, u := range m.items {
+		if u.Owner == owner {
+			uploads = append(uploads, u)
+		}
+	}
+	return uploads, nil
+}
+
+func (m *memRepository) Write(item Upload, a persistence.Atomic) error {
+	m.items[item.ID] = item
+	return nil
+}
+
+func (m *memRepository) Delete(id string, a persistence.Atomic) error {
+	delete(m.items, id)
+	return nil
+}
+
+func TestJanitorCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydms-janitor")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour)
+	const (
+		expired = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0001"
+		valid   = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0002"
+		stray   = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0003"
+		recent  = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0004"
+	)
+	repo := &memRepository{items: map[string]Upload{
+		expired: {ID: expired, FileName: "expired.pdf", Created: old},
+		valid:   {ID: valid, FileName: "valid.pdf", Created: now.Add(-time.Hour)},
+	}}
+	files := []string{expired + ".pdf", valid + ".pdf", stray + ".part", stray + ".info", recent + ".part", "other.txt"}
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		if err := ioutil.WriteFile(p, []byte(pdfPayload), 0640); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+		if f != recent+".part" {
+			os.Chtimes(p, old, old)
+		}
+	}
+
+	j := NewJanitor(repo, Config{UploadPath: dir, TokenTTL: 24 * time.Hour})
+	result, err := j.Cleanup()
+	if err != nil {
+		t.Fatalf("could not cleanup uploads: %v", err)
+	}
+	sort.Strings(result.Files)
+	assert.Equal(t, []string{expired}, result.Tokens)
+	assert.Equal(t, []string{expired + ".pdf", stray + ".info", stray + ".part"}, result.Files)
+
+	_, ok := repo.items[valid]
+	assert.True(t, ok)
+	for _, f := range []string{valid + ".pdf", recent + ".part", "other.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("the file '%s' should be kept: %v", f, err)
+		}
+	}
+
+	// no cleanup without a TTL
+	if _, err := NewJanitor(repo, Config{UploadPath: dir}).Cleanup(); err == nil {
+		t.Errorf("expected error for missing TokenTTL")
+	}
+	// the upload path needs to be available
+	if _, err := NewJanitor(repo, Config{UploadPath: "/NOTAVAIL/", TokenTTL: time.Hour}).Cleanup(); err == nil {
+		t.Errorf("expected error for missing upload path")
+	}
+}
+
+func TestJanitorStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydms-janitor")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the worker returns when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	NewJanitor(&memRepository{}, Config{UploadPath: dir, TokenTTL: time.Hour, CleanupInterval: time.Millisecond}).Start(ctx, &wg)
+	cancel()
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Errorf("the janitor was not stopped")
+	}
+}
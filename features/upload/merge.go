@@ -0,0 +1,125 @@
+package upload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/pdf"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// MergeRequest lists the uploads which are combined in a single PDF document
+type MergeRequest struct {
+	Tokens []string `json:"tokens"`
+	// FileName of the merged document, the name of the first upload is used if empty
+	FileName string `json:"fileName,omitempty"`
+}
+
+// MergeUploads godoc
+// @Summary merge pending uploads
+// @Description combines the pages of PDF documents and images of the uploads in the given order to a single PDF document
+// @Description the merged document replaces the uploads and is available by a new token
+// @Tags upload
+// @Accept  json
+// @Produce  json
+// @Param request body upload.MergeRequest true "tokens of the uploads"
+// @Success 201 {object} upload.Result
+// @Failure 400 {object} errors.ProblemDetail
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/upload/merge [post]
+func (h *Handler) MergeUploads(c echo.Context) error {
+	req := new(MergeRequest)
+	if err := c.Bind(req); err != nil {
+		return errors.BadRequestError{Err: fmt.Errorf("could not bind supplied data: %v", err), Request: c.Request()}
+	}
+	if len(req.Tokens) < 2 {
+		return errors.BadRequestError{Err: fmt.Errorf("at least two uploads are needed to merge"), Request: c.Request()}
+	}
+
+	var (
+		uploads   []Upload
+		documents [][]byte
+		seen      = make(map[string]bool)
+	)
+	for _, token := range req.Tokens {
+		if seen[token] {
+			return errors.BadRequestError{Err: fmt.Errorf("the upload '%s' is supplied more than once", token), Request: c.Request()}
+		}
+		seen[token] = true
+
+		u, err := h.r.Read(token)
+		if err != nil || u.Owner != owner(c) {
+			return errors.NotFoundError{Err: fmt.Errorf("the upload '%s' is not available", token), Request: c.Request()}
+		}
+		payload, err := ioutil.ReadFile(h.uploadPath(u))
+		if err != nil {
+			return errors.NotFoundError{Err: fmt.Errorf("the file of upload '%s' is not available: %v", u.ID, err), Request: c.Request()}
+		}
+		switch {
+		case u.MimeType == pdfMimeType:
+		case pdf.IsImage(u.MimeType):
+			if payload, err = pdf.FromImages(payload); err != nil {
+				return errors.BadRequestError{Err: err, Request: c.Request()}
+			}
+		default:
+			return errors.BadRequestError{Err: fmt.Errorf("the upload '%s' of type '%s' cannot be merged", u.ID, u.MimeType), Request: c.Request()}
+		}
+		uploads = append(uploads, u)
+		documents = append(documents, payload)
+	}
+
+	merged, err := pdf.Merge(documents...)
+	if err != nil {
+		return errors.BadRequestError{Err: err, Request: c.Request()}
+	}
+	if h.config.MaxUploadSize > 0 && int64(len(merged)) > h.config.MaxUploadSize {
+		return errors.BadRequestError{
+			Err:     fmt.Errorf("the merged document exceeds the maximum size of %d - filesize is: %d", h.config.MaxUploadSize, len(merged)),
+			Request: c.Request()}
+	}
+
+	fileName := req.FileName
+	if fileName == "" {
+		fileName = uploads[0].FileName
+	}
+	u := Upload{
+		ID:       uuid.New().String(),
+		FileName: pdfName(filepath.Base(fileName)),
+		MimeType: pdfMimeType,
+		Created:  time.Now().UTC(),
+		Owner:    owner(c),
+	}
+	uploadPath := h.uploadPath(u)
+	if err = ioutil.WriteFile(uploadPath, merged, 0640); err != nil {
+		return errors.ServerError{Err: fmt.Errorf("could not create file: %v", err), Request: c.Request()}
+	}
+	if err = h.r.Write(u, persistence.Atomic{}); err != nil {
+		if ioerr := os.Remove(uploadPath); ioerr != nil {
+			log.Warnf("Clean-Up file-upload. Could not delete temp file: '%s': %v", uploadPath, ioerr)
+		}
+		return errors.ServerError{Err: fmt.Errorf("could not save upload item in store: %v", err), Request: c.Request()}
+	}
+
+	// the merged uploads are replaced by the new upload
+	for _, m := range uploads {
+		if err := h.r.Delete(m.ID, persistence.Atomic{}); err != nil {
+			log.Warnf("could not delete merged upload '%s': %v", m.ID, err)
+			continue
+		}
+		h.removeFiles(m.ID)
+	}
+	log.Infof("merged %d uploads to upload '%s'", len(uploads), u.ID)
+
+	return c.JSON(http.StatusCreated, Result{Token: u.ID, Message: fmt.Sprintf("Merged %d uploads to file '%s'", len(uploads), u.FileName)})
+}
@@ -0,0 +1,153 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bihe/mydms/internal/pdf"
+	"github.com/bihe/mydms/internal/security"
+	"github.com/labstack/echo/v4"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+
+	sec "golang.binggl.net/commons/security"
+)
+
+func pngPayload() []byte {
+	var b bytes.Buffer
+	png.Encode(&b, image.NewGray(image.Rect(0, 0, 20, 10)))
+	return b.Bytes()
+}
+
+func userContext(req *http.Request) (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	return &security.ServerContext{Context: c, Identity: sec.User{Username: "user"}}, rec
+}
+
+func TestUploadConvertImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydms-convert")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "receipt.png")
+	if err != nil {
+		t.Fatalf(multipartErr, err)
+	}
+	io.Copy(part, bytes.NewReader(pngPayload()))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Add(contentType, writer.FormDataContentType())
+	c, rec := userContext(req)
+
+	repo := &memRepository{items: make(map[string]Upload)}
+	h := NewHandler(repo, Config{
+		AllowedFileTypes: []string{"png", "pdf"},
+		MaxUploadSize:    10000,
+		UploadPath:       dir,
+		ConvertImages:    true,
+	})
+	if assert.NoError(t, h.UploadFile(c)) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var r Result
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		u := repo.items[r.Token]
+		assert.Equal(t, "receipt.pdf", u.FileName)
+		assert.Equal(t, "application/pdf", u.MimeType)
+		payload, err := ioutil.ReadFile(filepath.Join(dir, r.Token+".pdf"))
+		assert.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(payload, []byte("%PDF-")))
+		_, err = os.Stat(filepath.Join(dir, r.Token+".png"))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestMergeUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydms-merge")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	document, err := pdf.FromImages(pngPayload(), pngPayload())
+	if err != nil {
+		t.Fatalf("could not create document: %v", err)
+	}
+	const (
+		doc   = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0001"
+		img   = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0002"
+		text  = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0003"
+		other = "8b0a3b8a-3ee4-4a4c-9a1b-6d6c3f0a0004"
+	)
+	now := time.Now().UTC()
+	repo := &memRepository{items: map[string]Upload{
+		doc:   {ID: doc, FileName: "invoice.pdf", MimeType: "application/pdf", Created: now, Owner: "user"},
+		img:   {ID: img, FileName: "receipt.png", MimeType: "image/png", Created: now, Owner: "user"},
+		text:  {ID: text, FileName: "notes.txt", MimeType: "text/plain", Created: now, Owner: "user"},
+		other: {ID: other, FileName: "other.pdf", MimeType: "application/pdf", Created: now, Owner: "other"},
+	}}
+	files := map[string][]byte{doc + ".pdf": document, img + ".png": pngPayload(), text + ".txt": []byte("text"), other + ".pdf": document}
+	for name, payload := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), payload, 0640); err != nil {
+			t.Fatalf("could not write file: %v", err)
+		}
+	}
+	h := NewHandler(repo, Config{UploadPath: dir, MaxUploadSize: 100000})
+	merge := func(payload string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c, rec := userContext(req)
+		return rec, h.MergeUploads(c)
+	}
+
+	for _, payload := range []string{
+		`{"tokens":["` + doc + `"]}`,
+		`{"tokens":["` + doc + `","` + doc + `"]}`,
+		`{"tokens":["` + doc + `","` + text + `"]}`,
+		`{"tokens":["` + doc + `","` + other + `"]}`,
+		`{"tokens":["` + doc + `","unknown"]}`,
+	} {
+		_, err := merge(payload)
+		assert.Error(t, err, payload)
+	}
+
+	rec, err := merge(`{"tokens":["` + doc + `","` + img + `"],"fileName":"receipts"}`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var r Result
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		u := repo.items[r.Token]
+		assert.Equal(t, "receipts.pdf", u.FileName)
+		assert.Equal(t, "application/pdf", u.MimeType)
+		assert.Equal(t, "user", u.Owner)
+		pages, err := api.PageCountFile(filepath.Join(dir, r.Token+".pdf"))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, pages)
+
+		// the merged uploads are replaced
+		for _, id := range []string{doc, img} {
+			_, ok := repo.items[id]
+			assert.False(t, ok)
+		}
+		for _, f := range []string{doc + ".pdf", img + ".png"} {
+			_, err := os.Stat(filepath.Join(dir, f))
+			assert.True(t, os.IsNotExist(err))
+		}
+	}
+}
@@ -13,12 +13,16 @@ type Upload struct {
 	FileName string    `db:"filename"`
 	MimeType string    `db:"mimetype"`
 	Created  time.Time `db:"created"`
+	// Owner is the name of the user who uploaded the file
+	Owner string `db:"owner"`
 }
 
 // Repository provides CRUD methods for uploads
 type Repository interface {
 	Write(item Upload, a persistence.Atomic) (err error)
 	Read(id string) (Upload, error)
+	List() ([]Upload, error)
+	ListByOwner(owner string) ([]Upload, error)
 	Delete(id string, a persistence.Atomic) (err error)
 }
 
@@ -46,7 +50,7 @@ func (rw *dbRepository) Write(item Upload, a persistence.Atomic) (err error) {
 		return
 	}
 
-	_, err = atomic.NamedExec("INSERT INTO UPLOADS (id,filename,mimetype,created) VALUES (:id, :filename, :mimetype, :created)", &item)
+	_, err = atomic.NamedExec("INSERT INTO UPLOADS (id,filename,mimetype,created,owner) VALUES (:id, :filename, :mimetype, :created, :owner)", &item)
 	if err != nil {
 		err = fmt.Errorf("cannot write upload item: %v", err)
 		return
@@ -58,13 +62,31 @@ func (rw *dbRepository) Write(item Upload, a persistence.Atomic) (err error) {
 func (rw *dbRepository) Read(id string) (Upload, error) {
 	u := Upload{}
 
-	err := rw.c.Get(&u, "SELECT id, filename, mimetype, created FROM UPLOADS WHERE id=?", id)
+	err := rw.c.Get(&u, rw.c.Rebind("SELECT id, filename, mimetype, created, owner FROM UPLOADS WHERE id=?"), id)
 	if err != nil {
 		return Upload{}, fmt.Errorf("cannot get upload-item by id '%s': %v", id, err)
 	}
 	return u, nil
 }
 
+// List returns all items ordered by their creation
+func (rw *dbRepository) List() ([]Upload, error) {
+	var uploads []Upload
+	if err := rw.c.Select(&uploads, "SELECT id, filename, mimetype, created, owner FROM UPLOADS ORDER BY created"); err != nil {
+		return nil, fmt.Errorf("cannot get the upload-items: %v", err)
+	}
+	return uploads, nil
+}
+
+// ListByOwner returns the items of the given owner ordered by their creation
+func (rw *dbRepository) ListByOwner(owner string) ([]Upload, error) {
+	var uploads []Upload
+	if err := rw.c.Select(&uploads, rw.c.Rebind("SELECT id, filename, mimetype, created, owner FROM UPLOADS WHERE owner = ? ORDER BY created"), owner); err != nil {
+		return nil, fmt.Errorf("cannot get the upload-items of '%s': %v", owner, err)
+	}
+	return uploads, nil
+}
+
 // Delete removes the item with the specified id from the store
 func (rw *dbRepository) Delete(id string, a persistence.Atomic) (err error) {
 	var atomic *persistence.Atomic
@@ -76,7 +98,7 @@ func (rw *dbRepository) Delete(id string, a persistence.Atomic) (err error) {
 	if atomic, err = persistence.CheckTX(rw.c, &a); err != nil {
 		return
 	}
-	_, err = atomic.Exec("DELETE FROM UPLOADS WHERE id = ?", id)
+	_, err = atomic.Exec(atomic.Rebind("DELETE FROM UPLOADS WHERE id = ?"), id)
 	if err != nil {
 		err = fmt.Errorf("cannot delete upload item: %v", err)
 		return
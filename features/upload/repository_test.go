@@ -1,13 +1,17 @@
 package upload
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/schema"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 const fatalErr = "an error '%s' was not expected when opening a stub database connection"
@@ -19,6 +23,7 @@ var uploadItem = Upload{
 	FileName: "filename",
 	MimeType: "mimetype",
 	Created:  time.Now().UTC(),
+	Owner:    "owner",
 }
 
 func TestNewReaderWriter(t *testing.T) {
@@ -55,7 +60,7 @@ func TestWrite(t *testing.T) {
 	item := uploadItem
 
 	mock.ExpectBegin()
-	mock.ExpectExec(stmt).WithArgs(item.ID, item.FileName, item.MimeType, item.Created).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(stmt).WithArgs(item.ID, item.FileName, item.MimeType, item.Created, item.Owner).WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	// now we execute our method
@@ -65,7 +70,7 @@ func TestWrite(t *testing.T) {
 
 	// externally supplied tx
 	mock.ExpectBegin()
-	mock.ExpectExec(stmt).WithArgs(item.ID, item.FileName, item.MimeType, item.Created).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(stmt).WithArgs(item.ID, item.FileName, item.MimeType, item.Created, item.Owner).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	a, err := c.CreateAtomic()
 	if err = rw.Write(item, a); err != nil {
@@ -115,15 +120,15 @@ func TestRead(t *testing.T) {
 	dbx := sqlx.NewDb(db, "mysql")
 	c := persistence.NewFromDB(dbx)
 	rw := dbRepository{c}
-	columns := []string{"id", "filename", "mimetype", "created"}
-	q := "SELECT id, filename, mimetype, created FROM UPLOADS"
+	columns := []string{"id", "filename", "mimetype", "created", "owner"}
+	q := "SELECT id, filename, mimetype, created, owner FROM UPLOADS"
 	id := "id"
 
 	expected := uploadItem
 
 	// success
 	rows := sqlmock.NewRows(columns).
-		AddRow(expected.ID, expected.FileName, expected.MimeType, expected.Created)
+		AddRow(expected.ID, expected.FileName, expected.MimeType, expected.Created, expected.Owner)
 	mock.ExpectQuery(q).WithArgs(id).WillReturnRows(rows)
 
 	item, err := rw.Read(id)
@@ -135,6 +140,7 @@ func TestRead(t *testing.T) {
 	assert.Equal(t, expected.FileName, item.FileName)
 	assert.Equal(t, expected.MimeType, item.MimeType)
 	assert.Equal(t, expected.Created, item.Created)
+	assert.Equal(t, expected.Owner, item.Owner)
 
 	// no result
 	rows = sqlmock.NewRows(columns)
@@ -151,6 +157,54 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf(fatalErr, err)
+	}
+	defer db.Close()
+
+	dbx := sqlx.NewDb(db, "mysql")
+	c := persistence.NewFromDB(dbx)
+	rw := dbRepository{c}
+	columns := []string{"id", "filename", "mimetype", "created", "owner"}
+	q := "SELECT id, filename, mimetype, created, owner FROM UPLOADS ORDER BY created"
+
+	rows := sqlmock.NewRows(columns).
+		AddRow(uploadItem.ID, uploadItem.FileName, uploadItem.MimeType, uploadItem.Created, uploadItem.Owner).
+		AddRow("id2", "filename2", "mimetype", uploadItem.Created, "")
+	mock.ExpectQuery(q).WillReturnRows(rows)
+
+	items, err := rw.List()
+	if err != nil {
+		t.Errorf("could not get items: %v", err)
+	}
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, uploadItem.ID, items[0].ID)
+	assert.Equal(t, "id2", items[1].ID)
+
+	mock.ExpectQuery(q).WillReturnError(fmt.Errorf("error"))
+	if _, err = rw.List(); err == nil {
+		t.Errorf("should have returned an error")
+	}
+
+	q = "SELECT id, filename, mimetype, created, owner FROM UPLOADS WHERE owner = \\? ORDER BY created"
+	rows = sqlmock.NewRows(columns).
+		AddRow(uploadItem.ID, uploadItem.FileName, uploadItem.MimeType, uploadItem.Created, uploadItem.Owner)
+	mock.ExpectQuery(q).WithArgs(uploadItem.Owner).WillReturnRows(rows)
+
+	items, err = rw.ListByOwner(uploadItem.Owner)
+	if err != nil {
+		t.Errorf("could not get items: %v", err)
+	}
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, uploadItem.Owner, items[0].Owner)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf(expectations, err)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -215,3 +269,50 @@ func TestDeleteError(t *testing.T) {
 		t.Errorf(expectations, err)
 	}
 }
+
+func TestSQLiteRepository(t *testing.T) {
+	c := persistence.NewConn("sqlite3", ":memory:")
+	defer c.Close()
+	m, err := persistence.NewMigrator(c, schema.Migrations)
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+
+	repo, err := NewRepository(c)
+	if err != nil {
+		t.Fatalf("could not get a repository: %v", err)
+	}
+	if err = repo.Write(uploadItem, persistence.Atomic{}); err != nil {
+		t.Fatalf("could not write upload item: %v", err)
+	}
+	u, err := repo.Read(uploadItem.ID)
+	if err != nil {
+		t.Fatalf("could not read upload item: %v", err)
+	}
+	assert.Equal(t, uploadItem.FileName, u.FileName)
+	assert.Equal(t, uploadItem.MimeType, u.MimeType)
+	assert.Equal(t, uploadItem.Owner, u.Owner)
+	items, err := repo.List()
+	if err != nil {
+		t.Fatalf("could not list upload items: %v", err)
+	}
+	assert.Equal(t, 1, len(items))
+	if items, err = repo.ListByOwner("other"); err != nil {
+		t.Fatalf("could not list upload items: %v", err)
+	}
+	assert.Equal(t, 0, len(items))
+	if items, err = repo.ListByOwner(uploadItem.Owner); err != nil {
+		t.Fatalf("could not list upload items: %v", err)
+	}
+	assert.Equal(t, 1, len(items))
+
+	if err = repo.Delete(uploadItem.ID, persistence.Atomic{}); err != nil {
+		t.Errorf(deleteExpErr, err)
+	}
+	if _, err = repo.Read(uploadItem.ID); err == nil {
+		t.Errorf("error for deleted item expected")
+	}
+}
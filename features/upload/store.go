@@ -0,0 +1,66 @@
+package upload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Store validates the payload and creates an upload item like a file uploaded by the API
+// it is used to process files which are not received by an API request, e.g. attachments of mails
+func Store(r Repository, config Config, fileName string, payload []byte, owner string) (Upload, error) {
+	ext, err := AllowedType(config.AllowedFileTypes, fileName)
+	if err != nil {
+		return Upload{}, err
+	}
+	if config.MaxUploadSize > 0 && int64(len(payload)) > config.MaxUploadSize {
+		return Upload{}, fmt.Errorf("the upload exceeds the maximum size of %d - filesize is: %d", config.MaxUploadSize, len(payload))
+	}
+	mimeType, err := DetectMimeType(payload, ext)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	id := uuid.New().String()
+	uploadPath := filepath.Join(config.UploadPath, id+"."+ext)
+	if err = ioutil.WriteFile(uploadPath, payload, 0640); err != nil {
+		return Upload{}, fmt.Errorf("could not create file: %v", err)
+	}
+	u := Upload{
+		ID:       id,
+		FileName: fileName,
+		MimeType: mimeType,
+		Created:  time.Now().UTC(),
+		Owner:    owner,
+	}
+	if err = convertImage(config, &u); err != nil {
+		os.Remove(uploadPath)
+		return Upload{}, err
+	}
+	uploadPath = filepath.Join(config.UploadPath, u.ID+filepath.Ext(u.FileName))
+	if err = r.Write(u, persistence.Atomic{}); err != nil {
+		if ioerr := os.Remove(uploadPath); ioerr != nil {
+			log.Warnf("Clean-Up file-upload. Could not delete temp file: '%s': %v", uploadPath, ioerr)
+		}
+		return Upload{}, fmt.Errorf("could not save upload item in store: %v", err)
+	}
+	return u, nil
+}
+
+// AllowedType returns the extension of the given file name if it is one of the allowed types
+func AllowedType(types []string, fileName string) (string, error) {
+	ext := strings.TrimPrefix(filepath.Ext(fileName), ".")
+	for _, t := range types {
+		if strings.EqualFold(t, ext) {
+			return ext, nil
+		}
+	}
+	return "", fmt.Errorf("the uploaded file-type '%s' is not allowed, only use: '%s'", ext, strings.Join(types, ","))
+}
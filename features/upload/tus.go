@@ -0,0 +1,512 @@
+package upload
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// --------------------------------------------------------------------------
+// resumable uploads following the tus protocol
+// https://tus.io/protocols/resumable-upload.html
+// --------------------------------------------------------------------------
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	tusChunkType  = "application/offset+octet-stream"
+
+	headerTusResumable   = "Tus-Resumable"
+	headerTusVersion     = "Tus-Version"
+	headerTusExtension   = "Tus-Extension"
+	headerTusMaxSize     = "Tus-Max-Size"
+	headerUploadOffset   = "Upload-Offset"
+	headerUploadLength   = "Upload-Length"
+	headerUploadMetadata = "Upload-Metadata"
+	headerDeferLength    = "Upload-Defer-Length"
+
+	infoSuffix = ".info"
+	partSuffix = ".part"
+)
+
+// TusHeaders lists the headers of the tus protocol, which need to be exposed to browser clients
+var TusHeaders = []string{headerTusResumable, headerTusVersion, headerTusExtension, headerTusMaxSize,
+	headerUploadOffset, headerUploadLength, headerUploadMetadata, echo.HeaderLocation}
+
+// tusInfo holds the state of a resumable upload, it is stored next to the received data
+type tusInfo struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"fileName"`
+	Length    int64     `json:"length"`
+	Metadata  string    `json:"metadata"`
+	Created   time.Time `json:"created"`
+	Completed bool      `json:"completed"`
+	MimeType  string    `json:"mimeType,omitempty"`
+	Owner     string    `json:"owner"`
+}
+
+// TusOptions godoc
+// @Summary capabilities of the resumable upload
+// @Description returns the supported version, extensions and the maximum size of the tus protocol
+// @Tags upload
+// @Success 204
+// @Router /api/v1/upload/tus [options]
+func (h *Handler) TusOptions(c echo.Context) error {
+	header := c.Response().Header()
+	header.Set(headerTusResumable, tusVersion)
+	header.Set(headerTusVersion, tusVersion)
+	header.Set(headerTusExtension, tusExtensions)
+	header.Set(headerTusMaxSize, strconv.FormatInt(h.config.MaxUploadSize, 10))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TusCreate godoc
+// @Summary create a resumable upload
+// @Description creates a new resumable upload, the URL of the upload is returned in the Location header
+// @Description the last segment of the URL is the upload token, which is valid once all data was received
+// @Tags upload
+// @Param Tus-Resumable header string true "protocol version 1.0.0"
+// @Param Upload-Length header int true "size of the file in bytes"
+// @Param Upload-Metadata header string true "base64 encoded metadata, the key 'filename' is required"
+// @Success 201
+// @Failure 400 {object} errors.ProblemDetail
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 412 {object} errors.ProblemDetail
+// @Failure 413 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/upload/tus [post]
+func (h *Handler) TusCreate(c echo.Context) error {
+	if err := tusResumable(c); err != nil {
+		return tusError(c, http.StatusPreconditionFailed, err)
+	}
+	req := c.Request()
+	if req.Header.Get(headerDeferLength) != "" {
+		return errors.BadRequestError{Err: fmt.Errorf("a deferred upload length is not supported"), Request: req}
+	}
+	length, err := strconv.ParseInt(req.Header.Get(headerUploadLength), 10, 64)
+	if err != nil || length < 1 {
+		return errors.BadRequestError{Err: fmt.Errorf("invalid %s supplied", headerUploadLength), Request: req}
+	}
+	if length > h.config.MaxUploadSize {
+		return tusError(c, http.StatusRequestEntityTooLarge, fmt.Errorf("the upload exceeds the maximum size of %d - filesize is: %d", h.config.MaxUploadSize, length))
+	}
+
+	info := tusInfo{
+		ID:       uuid.New().String(),
+		Length:   length,
+		Metadata: req.Header.Get(headerUploadMetadata),
+		Created:  time.Now().UTC(),
+		Owner:    owner(c),
+	}
+	values, err := parseMetadata(info.Metadata)
+	if err != nil {
+		return errors.BadRequestError{Err: err, Request: req}
+	}
+	info.FileName = values["filename"]
+	if info.FileName == "" {
+		info.FileName = values["name"]
+	}
+	if info.FileName == "" || path.Base(info.FileName) != info.FileName {
+		return errors.BadRequestError{Err: fmt.Errorf("a valid filename needs to be supplied in the %s", headerUploadMetadata), Request: req}
+	}
+	if _, err = h.fileType(info.FileName); err != nil {
+		return errors.BadRequestError{Err: err, Request: req}
+	}
+
+	if err = h.writeInfo(info); err != nil {
+		return errors.ServerError{Err: err, Request: req}
+	}
+	if err = ioutil.WriteFile(h.tusPath(info.ID, partSuffix), []byte{}, 0640); err != nil {
+		h.removeTus(info.ID)
+		return errors.ServerError{Err: fmt.Errorf("could not create upload file: %v", err), Request: req}
+	}
+	log.Infof("created resumable upload '%s' for file '%s' with size %d", info.ID, info.FileName, info.Length)
+
+	c.Response().Header().Set(headerTusResumable, tusVersion)
+	c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(req.URL.Path, "/")+"/"+info.ID)
+	return c.NoContent(http.StatusCreated)
+}
+
+// TusStatus godoc
+// @Summary status of a resumable upload
+// @Description returns the number of bytes received in the Upload-Offset header
+// @Tags upload
+// @Param id path string true "upload token"
+// @Param Tus-Resumable header string true "protocol version 1.0.0"
+// @Success 200
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404
+// @Failure 412
+// @Router /api/v1/upload/tus/{id} [head]
+func (h *Handler) TusStatus(c echo.Context) error {
+	if err := tusResumable(c); err != nil {
+		return tusError(c, http.StatusPreconditionFailed, err)
+	}
+	info, err := h.readInfo(c.Param("id"), owner(c))
+	if err != nil {
+		return tusError(c, http.StatusNotFound, err)
+	}
+	offset, err := h.tusOffset(info)
+	if err != nil {
+		return tusError(c, http.StatusInternalServerError, err)
+	}
+
+	header := c.Response().Header()
+	header.Set(headerTusResumable, tusVersion)
+	header.Set(headerUploadOffset, strconv.FormatInt(offset, 10))
+	header.Set(headerUploadLength, strconv.FormatInt(info.Length, 10))
+	if info.Metadata != "" {
+		header.Set(headerUploadMetadata, info.Metadata)
+	}
+	header.Set("Cache-Control", "no-store")
+	return c.NoContent(http.StatusOK)
+}
+
+// TusPatch godoc
+// @Summary append data to a resumable upload
+// @Description the data is written at the given Upload-Offset, which needs to match the received bytes
+// @Description once all data was received, the upload token can be used to save a document
+// @Tags upload
+// @Consumes application/offset+octet-stream
+// @Param id path string true "upload token"
+// @Param Tus-Resumable header string true "protocol version 1.0.0"
+// @Param Upload-Offset header int true "offset of the supplied data"
+// @Success 204
+// @Failure 400 {object} errors.ProblemDetail
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 409 {object} errors.ProblemDetail
+// @Failure 412 {object} errors.ProblemDetail
+// @Failure 413 {object} errors.ProblemDetail
+// @Failure 415 {object} errors.ProblemDetail
+// @Failure 423 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/upload/tus/{id} [patch]
+func (h *Handler) TusPatch(c echo.Context) error {
+	if err := tusResumable(c); err != nil {
+		return tusError(c, http.StatusPreconditionFailed, err)
+	}
+	req := c.Request()
+	if req.Header.Get(echo.HeaderContentType) != tusChunkType {
+		return tusError(c, http.StatusUnsupportedMediaType, fmt.Errorf("the content-type needs to be '%s'", tusChunkType))
+	}
+	offset, err := strconv.ParseInt(req.Header.Get(headerUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		return errors.BadRequestError{Err: fmt.Errorf("invalid %s supplied", headerUploadOffset), Request: req}
+	}
+
+	id := c.Param("id")
+	if !h.lock(id) {
+		return tusError(c, http.StatusLocked, fmt.Errorf("the upload '%s' is in use by another request", id))
+	}
+	defer h.unlock(id)
+
+	info, err := h.readInfo(id, owner(c))
+	if err != nil {
+		return errors.NotFoundError{Err: err, Request: req}
+	}
+	current, err := h.tusOffset(info)
+	if err != nil {
+		return errors.ServerError{Err: err, Request: req}
+	}
+	if offset != current {
+		return tusError(c, http.StatusConflict, fmt.Errorf("the offset %d does not match the received bytes %d", offset, current))
+	}
+
+	if !info.Completed {
+		if current, err = h.appendChunk(info, current, req.Body); err != nil {
+			if err == errChunkTooLarge {
+				return tusError(c, http.StatusRequestEntityTooLarge, err)
+			}
+			// the data received until the error is kept, the client resumes from the stored offset
+			return errors.ServerError{Err: err, Request: req}
+		}
+		if current == info.Length {
+			if err = h.completeTus(info, req); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.Response().Header().Set(headerTusResumable, tusVersion)
+	c.Response().Header().Set(headerUploadOffset, strconv.FormatInt(current, 10))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// TusTerminate godoc
+// @Summary terminate a resumable upload
+// @Description removes the received data, a completed upload is removed as well
+// @Tags upload
+// @Param id path string true "upload token"
+// @Param Tus-Resumable header string true "protocol version 1.0.0"
+// @Success 204
+// @Failure 401 {object} errors.ProblemDetail
+// @Failure 403 {object} errors.ProblemDetail
+// @Failure 404 {object} errors.ProblemDetail
+// @Failure 412 {object} errors.ProblemDetail
+// @Failure 423 {object} errors.ProblemDetail
+// @Failure 500 {object} errors.ProblemDetail
+// @Router /api/v1/upload/tus/{id} [delete]
+func (h *Handler) TusTerminate(c echo.Context) error {
+	if err := tusResumable(c); err != nil {
+		return tusError(c, http.StatusPreconditionFailed, err)
+	}
+	id := c.Param("id")
+	if !h.lock(id) {
+		return tusError(c, http.StatusLocked, fmt.Errorf("the upload '%s' is in use by another request", id))
+	}
+	defer h.unlock(id)
+
+	info, err := h.readInfo(id, owner(c))
+	if err != nil {
+		return errors.NotFoundError{Err: err, Request: c.Request()}
+	}
+	if info.Completed {
+		if err = h.r.Delete(info.ID, persistence.Atomic{}); err != nil {
+			return errors.ServerError{Err: fmt.Errorf("could not delete upload item: %v", err), Request: c.Request()}
+		}
+		ext, _ := h.fileType(info.FileName)
+		if err = os.Remove(path.Join(h.config.UploadPath, info.ID+"."+ext)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("could not delete upload file of '%s': %v", info.ID, err)
+		}
+	}
+	h.removeTus(info.ID)
+	log.Infof("terminated resumable upload '%s'", info.ID)
+
+	c.Response().Header().Set(headerTusResumable, tusVersion)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// --------------------------------------------------------------------------
+// helpers
+// --------------------------------------------------------------------------
+
+var errChunkTooLarge = fmt.Errorf("the supplied data exceeds the length of the upload")
+
+// appendChunk writes the data to the end of the upload file and returns the new offset
+// data exceeding the length of the upload is rejected and not written
+func (h *Handler) appendChunk(info tusInfo, offset int64, body io.Reader) (int64, error) {
+	partPath := h.tusPath(info.ID, partSuffix)
+	f, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return offset, fmt.Errorf("could not open upload file: %v", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, io.LimitReader(body, info.Length-offset))
+	if err != nil {
+		return offset + n, fmt.Errorf("could not write upload file: %v", err)
+	}
+	if more, _ := body.Read(make([]byte, 1)); more > 0 {
+		if err := f.Truncate(offset); err != nil {
+			return offset + n, fmt.Errorf("could not reset upload file: %v", err)
+		}
+		return offset, errChunkTooLarge
+	}
+	return offset + n, nil
+}
+
+// completeTus validates the content of the received file and provides it with the upload token
+// the returned error is an API error
+func (h *Handler) completeTus(info tusInfo, req *http.Request) error {
+	ext, _ := h.fileType(info.FileName)
+	partPath := h.tusPath(info.ID, partSuffix)
+	f, err := os.Open(partPath)
+	if err != nil {
+		return errors.ServerError{Err: fmt.Errorf("could not open upload file: %v", err), Request: req}
+	}
+	header := make([]byte, sniffLen)
+	n, _ := io.ReadFull(f, header)
+	f.Close()
+
+	if info.MimeType, err = DetectMimeType(header[:n], ext); err != nil {
+		// the upload cannot be used at all
+		h.removeTus(info.ID)
+		return errors.BadRequestError{Err: err, Request: req}
+	}
+
+	u := Upload{
+		ID:       info.ID,
+		FileName: info.FileName,
+		MimeType: info.MimeType,
+		Created:  time.Now().UTC(),
+		Owner:    info.Owner,
+	}
+	// the received data is kept until the upload is stored, completing the upload is retried with the next request
+	converted, err := convertFile(h.config, &u, partPath)
+	if err != nil {
+		h.removeTus(info.ID)
+		os.Remove(path.Join(h.config.UploadPath, info.ID+".pdf"))
+		return errors.BadRequestError{Err: err, Request: req}
+	}
+	uploadPath := h.uploadPath(u)
+	if !converted {
+		uploadPath = path.Join(h.config.UploadPath, info.ID+"."+ext)
+		if err = os.Rename(partPath, uploadPath); err != nil {
+			return errors.ServerError{Err: fmt.Errorf("could not move upload file: %v", err), Request: req}
+		}
+	}
+	if err = h.r.Write(u, persistence.Atomic{}); err != nil {
+		if converted {
+			os.Remove(uploadPath)
+		} else if ioerr := os.Rename(uploadPath, partPath); ioerr != nil {
+			log.Warnf("could not restore upload file '%s': %v", uploadPath, ioerr)
+		}
+		return errors.ServerError{Err: fmt.Errorf("could not save upload item in store: %v", err), Request: req}
+	}
+	if converted {
+		if err = os.Remove(partPath); err != nil {
+			log.Warnf("could not delete the converted image '%s': %v", partPath, err)
+		}
+	}
+	// the info refers to the converted file
+	info.FileName, info.MimeType = u.FileName, u.MimeType
+
+	info.Completed = true
+	if err = h.writeInfo(info); err != nil {
+		log.Warnf("could not mark resumable upload '%s' as completed: %v", info.ID, err)
+	}
+	log.Infof("completed resumable upload '%s' for file '%s'", info.ID, info.FileName)
+	return nil
+}
+
+// tusOffset returns the number of bytes received for the given upload
+func (h *Handler) tusOffset(info tusInfo) (int64, error) {
+	if info.Completed {
+		return info.Length, nil
+	}
+	stat, err := os.Stat(h.tusPath(info.ID, partSuffix))
+	if err != nil {
+		return 0, fmt.Errorf("could not get the upload file of '%s': %v", info.ID, err)
+	}
+	return stat.Size(), nil
+}
+
+// tusPath returns the path of the file with the given suffix of the upload id
+func (h *Handler) tusPath(id, suffix string) string {
+	return path.Join(h.config.UploadPath, id+suffix)
+}
+
+// readInfo loads the state of the upload, the id needs to be a valid token of the given owner
+func (h *Handler) readInfo(id, owner string) (tusInfo, error) {
+	var info tusInfo
+	if _, err := uuid.Parse(id); err != nil {
+		return info, fmt.Errorf("invalid upload id '%s'", id)
+	}
+	payload, err := ioutil.ReadFile(h.tusPath(id, infoSuffix))
+	if err != nil {
+		return info, fmt.Errorf("the upload '%s' is not available", id)
+	}
+	if err = json.Unmarshal(payload, &info); err != nil {
+		return info, fmt.Errorf("could not read the upload '%s': %v", id, err)
+	}
+	if info.Owner != owner {
+		return tusInfo{}, fmt.Errorf("the upload '%s' is not available", id)
+	}
+	return info, nil
+}
+
+// writeInfo stores the state of the upload
+func (h *Handler) writeInfo(info tusInfo) error {
+	payload, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("could not serialize the upload '%s': %v", info.ID, err)
+	}
+	if err = ioutil.WriteFile(h.tusPath(info.ID, infoSuffix), payload, 0640); err != nil {
+		return fmt.Errorf("could not write the upload '%s': %v", info.ID, err)
+	}
+	return nil
+}
+
+// removeTus deletes the state and the received data of the upload
+func (h *Handler) removeTus(id string) {
+	for _, suffix := range []string{partSuffix, infoSuffix} {
+		if err := os.Remove(h.tusPath(id, suffix)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("could not delete file of upload '%s': %v", id, err)
+		}
+	}
+}
+
+// lock marks the upload as in use, false is returned if it is already in use
+func (h *Handler) lock(id string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.active[id] {
+		return false
+	}
+	h.active[id] = true
+	return true
+}
+
+// unlock releases the upload
+func (h *Handler) unlock(id string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.active, id)
+}
+
+// tusResumable checks if the protocol version requested by the client is supported
+func tusResumable(c echo.Context) error {
+	if v := c.Request().Header.Get(headerTusResumable); v != tusVersion {
+		c.Response().Header().Set(headerTusVersion, tusVersion)
+		return fmt.Errorf("the protocol version '%s' is not supported", v)
+	}
+	return nil
+}
+
+// tusError writes a response with the status code required by the protocol
+func tusError(c echo.Context, status int, err error) error {
+	log.Warnf("resumable upload request '%s' failed: %v", c.Request().RequestURI, err)
+	c.Response().Header().Set(headerTusResumable, tusVersion)
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(status)
+	}
+	return c.JSON(status, errors.ProblemDetail{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+	})
+}
+
+// parseMetadata decodes the key-value pairs of the Upload-Metadata header
+// the pairs are separated by comma, the key is separated by a space from the base64 encoded value
+func parseMetadata(metadata string) (map[string]string, error) {
+	values := make(map[string]string)
+	if metadata == "" {
+		return values, nil
+	}
+	for _, pair := range strings.Split(metadata, ",") {
+		kv := strings.Fields(pair)
+		switch len(kv) {
+		case 1:
+			values[kv[0]] = ""
+		case 2:
+			v, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of metadata key '%s': %v", kv[0], err)
+			}
+			values[kv[0]] = string(v)
+		default:
+			return nil, fmt.Errorf("invalid %s supplied", headerUploadMetadata)
+		}
+	}
+	return values, nil
+}
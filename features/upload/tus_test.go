@@ -0,0 +1,234 @@
+package upload
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const tusURL = "/api/v1/upload/tus"
+
+func tusSetup(t *testing.T) (*Handler, string) {
+	dir, err := ioutil.TempDir("", "mydms-tus")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	return NewHandler(mockRepository{}, Config{
+		AllowedFileTypes: []string{"png", "pdf"},
+		MaxUploadSize:    10000,
+		UploadPath:       dir,
+	}), dir
+}
+
+func tusRequest(method, id string, body io.Reader, headers map[string]string) (echo.Context, *httptest.ResponseRecorder) {
+	url := tusURL
+	if id != "" {
+		url += "/" + id
+	}
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set(headerTusResumable, tusVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if id != "" {
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+	}
+	return c, rec
+}
+
+func tusCreate(t *testing.T, h *Handler, name string, length int) string {
+	c, rec := tusRequest(http.MethodPost, "", nil, map[string]string{
+		headerUploadLength:   strconv.Itoa(length),
+		headerUploadMetadata: "filename " + base64.StdEncoding.EncodeToString([]byte(name)) + ",public",
+	})
+	if err := h.TusCreate(c); err != nil {
+		t.Fatalf("could not create upload: %v", err)
+	}
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	location := rec.Header().Get(echo.HeaderLocation)
+	assert.True(t, strings.HasPrefix(location, tusURL+"/"))
+	return path.Base(location)
+}
+
+func tusPatch(h *Handler, id string, offset int, chunk string) (*httptest.ResponseRecorder, error) {
+	c, rec := tusRequest(http.MethodPatch, id, strings.NewReader(chunk), map[string]string{
+		echo.HeaderContentType: tusChunkType,
+		headerUploadOffset:     strconv.Itoa(offset),
+	})
+	return rec, h.TusPatch(c)
+}
+
+func TestTusUpload(t *testing.T) {
+	h, dir := tusSetup(t)
+	defer os.RemoveAll(dir)
+
+	c, rec := tusRequest(http.MethodOptions, "", nil, nil)
+	assert.NoError(t, h.TusOptions(c))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "10000", rec.Header().Get(headerTusMaxSize))
+	assert.Equal(t, tusExtensions, rec.Header().Get(headerTusExtension))
+
+	id := tusCreate(t, h, fileName, len(pdfPayload))
+
+	c, rec = tusRequest(http.MethodHead, id, nil, nil)
+	assert.NoError(t, h.TusStatus(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(headerUploadOffset))
+	assert.Equal(t, strconv.Itoa(len(pdfPayload)), rec.Header().Get(headerUploadLength))
+
+	rec, err := tusPatch(h, id, 0, pdfPayload[:100])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "100", rec.Header().Get(headerUploadOffset))
+
+	// the offset needs to match the received data
+	rec, err = tusPatch(h, id, 50, pdfPayload[50:])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// data exceeding the length of the upload is rejected
+	rec, err = tusPatch(h, id, 100, pdfPayload[100:]+"more")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	c, rec = tusRequest(http.MethodHead, id, nil, nil)
+	assert.NoError(t, h.TusStatus(c))
+	assert.Equal(t, "100", rec.Header().Get(headerUploadOffset))
+
+	rec, err = tusPatch(h, id, 100, pdfPayload[100:])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, strconv.Itoa(len(pdfPayload)), rec.Header().Get(headerUploadOffset))
+
+	// the completed upload is available like a file uploaded by UploadFile
+	payload, err := ioutil.ReadFile(path.Join(dir, id+".pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, pdfPayload, string(payload))
+
+	c, rec = tusRequest(http.MethodHead, id, nil, nil)
+	assert.NoError(t, h.TusStatus(c))
+	assert.Equal(t, strconv.Itoa(len(pdfPayload)), rec.Header().Get(headerUploadOffset))
+
+	c, rec = tusRequest(http.MethodDelete, id, nil, nil)
+	assert.NoError(t, h.TusTerminate(c))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	if _, err := os.Stat(path.Join(dir, id+".pdf")); !os.IsNotExist(err) {
+		t.Errorf("the upload file should be removed")
+	}
+
+	c, rec = tusRequest(http.MethodHead, id, nil, nil)
+	assert.NoError(t, h.TusStatus(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestTusContentMismatch(t *testing.T) {
+	h, dir := tusSetup(t)
+	defer os.RemoveAll(dir)
+
+	content := "MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00"
+	id := tusCreate(t, h, fileName, len(content))
+	if _, err := tusPatch(h, id, 0, content); err == nil {
+		t.Errorf("expected error for content not matching the file-type!")
+	}
+	if _, err := h.readInfo(id, ""); err == nil {
+		t.Errorf("the rejected upload should be removed")
+	}
+}
+
+func TestTusCreateFail(t *testing.T) {
+	h, dir := tusSetup(t)
+	defer os.RemoveAll(dir)
+
+	name := "filename " + base64.StdEncoding.EncodeToString([]byte(fileName))
+	cases := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"missing length", map[string]string{headerUploadMetadata: name}, http.StatusBadRequest},
+		{"deferred length", map[string]string{headerUploadMetadata: name, headerDeferLength: "1"}, http.StatusBadRequest},
+		{"exceeds size", map[string]string{headerUploadMetadata: name, headerUploadLength: "10001"}, http.StatusRequestEntityTooLarge},
+		{"missing filename", map[string]string{headerUploadLength: "100"}, http.StatusBadRequest},
+		{"invalid metadata", map[string]string{headerUploadMetadata: "filename !!!", headerUploadLength: "100"}, http.StatusBadRequest},
+		{"invalid filename", map[string]string{headerUploadMetadata: "filename " + base64.StdEncoding.EncodeToString([]byte("../test.pdf")), headerUploadLength: "100"}, http.StatusBadRequest},
+		{"file type", map[string]string{headerUploadMetadata: "filename " + base64.StdEncoding.EncodeToString([]byte("test.exe")), headerUploadLength: "100"}, http.StatusBadRequest},
+		{"version", map[string]string{headerTusResumable: "0.2.2", headerUploadMetadata: name, headerUploadLength: "100"}, http.StatusPreconditionFailed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, rec := tusRequest(http.MethodPost, "", nil, tc.headers)
+			err := h.TusCreate(c)
+			if tc.status == http.StatusBadRequest {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
+
+func TestTusPatchFail(t *testing.T) {
+	h, dir := tusSetup(t)
+	defer os.RemoveAll(dir)
+
+	id := tusCreate(t, h, fileName, len(pdfPayload))
+
+	c, rec := tusRequest(http.MethodPatch, id, strings.NewReader(pdfPayload), map[string]string{
+		echo.HeaderContentType: "application/pdf",
+		headerUploadOffset:     "0",
+	})
+	assert.NoError(t, h.TusPatch(c))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	if _, err := tusPatch(h, "../../etc/passwd", 0, pdfPayload); err == nil {
+		t.Errorf("expected error for an invalid upload id!")
+	}
+
+	h.lock(id)
+	rec, err := tusPatch(h, id, 0, pdfPayload)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusLocked, rec.Code)
+	h.unlock(id)
+}
+
+func TestTusConvertFail(t *testing.T) {
+	h, dir := tusSetup(t)
+	defer os.RemoveAll(dir)
+	h.config.ConvertImages = true
+
+	// the converted upload cannot be stored
+	content := string(pngPayload())
+	id := tusCreate(t, h, "receipt.png", len(content))
+	if _, err := tusPatch(h, id, 0, content); err == nil {
+		t.Errorf("expected error for a failed store of the upload!")
+	}
+	if _, err := os.Stat(path.Join(dir, id+".pdf")); !os.IsNotExist(err) {
+		t.Errorf("the converted file should be removed")
+	}
+	// the received image is kept to complete the upload with the next request
+	received, err := ioutil.ReadFile(h.tusPath(id, partSuffix))
+	if err != nil {
+		t.Fatalf("the received data should be kept: %v", err)
+	}
+	assert.Equal(t, content, string(received))
+	info, err := h.readInfo(id, "")
+	if err != nil {
+		t.Fatalf("could not read upload: %v", err)
+	}
+	assert.False(t, info.Completed)
+	assert.Equal(t, "receipt.png", info.FileName)
+}
@@ -8,12 +8,17 @@ import (
 
 // AppConfig holds the application configuration
 type AppConfig struct {
-	Sec   Security     `json:"security"`
-	DB    Database     `json:"database"`
-	Log   LogConfig    `json:"logging"`
-	UP    UploadConfig `json:"upload"`
-	Store FileStore    `json:"filestore"`
-	Cors  CorsSettings `json:"cors"`
+	Sec    Security     `json:"security"`
+	DB     Database     `json:"database"`
+	Log    LogConfig    `json:"logging"`
+	UP     UploadConfig `json:"upload"`
+	Store  FileStore    `json:"filestore"`
+	Cors   CorsSettings `json:"cors"`
+	Ingest IngestConfig `json:"ingest"`
+	Mail   MailConfig   `json:"mail"`
+	Trash  TrashConfig  `json:"trash"`
+	// Reconcile compares the documents with the files of the backend file store
+	Reconcile ReconcileConfig `json:"reconcile"`
 }
 
 // Security settings for the application
@@ -24,11 +29,17 @@ type Security struct {
 	LoginRedirect string `json:"loginRedirect"`
 	Claim         Claim  `json:"claim"`
 	CacheDuration string `json:"cacheDuration"`
+	// AdminRole is the role of the claim needed for the admin API, the admin API is not available without a role
+	AdminRole string `json:"adminRole"`
 }
 
 // Database defines the connection string
 type Database struct {
+	// Driver defines the database driver: mysql (default), sqlite3 or postgres
+	Driver  string `json:"driver"`
 	ConnStr string `json:"connectionString"`
+	// Migrate applies pending schema migrations on startup
+	Migrate bool `json:"migrate"`
 }
 
 // Claim defines the required claims
@@ -52,14 +63,97 @@ type UploadConfig struct {
 	MaxUploadSize int64 `json:"maxUploadSize"`
 	// UploadPath defines a directory where uploaded files are stored
 	UploadPath string `json:"uploadPath"`
+	// TokenTTL defines how long an upload is kept without saving a document, e.g. "24h"
+	// expired uploads are removed, no cleanup is done if the value is empty
+	TokenTTL string `json:"tokenTTL"`
+	// CleanupInterval defines how often expired uploads are removed, default is "1h"
+	CleanupInterval string `json:"cleanupInterval"`
+	// ConvertImages wraps uploaded images (jpg, png, tiff, webp) in a PDF document
+	ConvertImages bool `json:"convertImages"`
+	// RejectDuplicates refuses to save a document, if the file is already stored by another document
+	// by default the existing documents are only reported
+	RejectDuplicates bool `json:"rejectDuplicates"`
+}
+
+// IngestConfig defines a watched folder, files placed in the folder are imported
+type IngestConfig struct {
+	// Enabled starts watching the folder
+	Enabled bool `json:"enabled"`
+	// Path is the watched folder, the names of subfolders are used as tags of the documents
+	Path string `json:"path"`
+	// ArchivePath receives the imported files
+	ArchivePath string `json:"archivePath"`
+	// ErrorPath receives the files which could not be imported
+	ErrorPath string `json:"errorPath"`
+	// Mode defines what is created for a file: "document" (default) or "upload"
+	Mode string `json:"mode"`
+	// Owner is used for the created uploads
+	Owner string `json:"owner"`
+	// Interval defines how often the folder is checked, default is "1m"
+	Interval string `json:"interval"`
+	// SettleTime defines how long a file needs to be unchanged before it is imported, default is "30s"
+	SettleTime string `json:"settleTime"`
+}
+
+// MailConfig defines an IMAP mailbox, the attachments of the received mails are imported as documents
+type MailConfig struct {
+	// Enabled starts polling the mailbox
+	Enabled bool `json:"enabled"`
+	// Address of the IMAP server, e.g. "imap.example.com:993"
+	Address string `json:"address"`
+	// TLS connects to the server using an implicit TLS connection
+	TLS bool `json:"tls"`
+	// InsecureSkipVerify does not verify the certificate of the server
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	User               string `json:"user"`
+	Password           string `json:"password"`
+	// Mailbox is checked for unread mails, default is "INBOX"
+	Mailbox string `json:"mailbox"`
+	// ProcessedMailbox receives the imported mails, if empty the mails are only marked as read
+	ProcessedMailbox string `json:"processedMailbox"`
+	// ErrorMailbox receives the mails which could not be imported, if empty the mails are only marked as read and flagged
+	ErrorMailbox string `json:"errorMailbox"`
+	// Interval defines how often the mailbox is checked, default is "5m"
+	Interval string `json:"interval"`
+}
+
+// TrashConfig defines how long deleted documents are kept in the trash
+type TrashConfig struct {
+	// PurgeAfterDays defines how many days deleted documents are kept, documents are only purged manually if the value is 0
+	PurgeAfterDays int `json:"purgeAfterDays"`
+	// PurgeInterval defines how often expired documents are purged, default is "1h"
+	PurgeInterval string `json:"purgeInterval"`
+}
+
+// ReconcileConfig defines how the documents and the files of the backend file store are reconciled
+type ReconcileConfig struct {
+	// Enabled compares the files with the documents, failed deletes of files are retried in any case
+	Enabled bool `json:"enabled"`
+	// Interval defines how often the files are reconciled, default is "1h"
+	Interval string `json:"interval"`
+	// GracePeriod is the minimum age of a file without document to be deleted, default is "1h"
+	GracePeriod string `json:"gracePeriod"`
+	// Fix deletes files without document and moves documents without file to the trash, otherwise they are only reported
+	Fix bool `json:"fix"`
 }
 
 // FileStore holds configuration settings for the backend file store
 type FileStore struct {
-	Region string
-	Bucket string
-	Key    string
-	Secret string
+	// Backend selects the store implementation, either "s3" (default) or "local"
+	Backend string `json:"backend"`
+	// LocalPath defines the root directory of the "local" backend
+	LocalPath string `json:"localPath"`
+
+	Region string `json:"region"`
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Secret string `json:"secret"`
+	// Endpoint is the URL of a S3 compatible service (MinIO, Ceph, ...), empty for AWS
+	Endpoint string `json:"endpoint"`
+	// PathStyle addresses buckets by path (host/bucket/key) instead of by sub-domain
+	PathStyle bool `json:"pathStyle"`
+	// InsecureSkipVerify disables the verification of the endpoint TLS certificate
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
 }
 
 // CorsSettings specifies the used settings
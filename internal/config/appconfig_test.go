@@ -18,25 +18,37 @@ const configString = `{
             "url": "http://localhost:3000",
             "roles": ["User", "Admin"]
 	},
-	"cacheDuration": "10m"
+	"cacheDuration": "10m",
+	"adminRole": "Admin"
     },
     "database": {
-	"connectionString": "./bookmarks.db"
+	"driver": "sqlite3",
+	"connectionString": "./bookmarks.db",
+	"migrate": true
     },
     "upload": {
         "allowedFileTypes": ["pdf","png"],
         "maxUploadSize": 1000,
-        "UploadPath": "/PATH"
+        "UploadPath": "/PATH",
+        "tokenTTL": "24h",
+        "cleanupInterval": "30m",
+        "convertImages": true,
+        "rejectDuplicates": true
     },
     "logging": {
 	"filePath": "/temp/file",
 	"logLevel": "debug"
     },
     "filestore": {
+        "backend": "local",
+        "localPath": "/opt/mydms/files",
         "region": "_REGION_",
         "bucket": "_BUCKET_NAME_",
         "key": "key",
-        "secret": "secret"
+        "secret": "secret",
+        "endpoint": "http://localhost:9000",
+        "pathStyle": true,
+        "insecureSkipVerify": true
     },
     "cors": {
 	"origins": ["*"],
@@ -44,6 +56,33 @@ const configString = `{
 	"headers": ["Accept", "Authorization"],
 	"credentials": true,
 	"maxAge": 500
+    },
+    "ingest": {
+        "enabled": true,
+        "path": "/scans",
+        "archivePath": "/scans-archive",
+        "errorPath": "/scans-error",
+        "mode": "upload",
+        "interval": "2m"
+    },
+    "mail": {
+        "enabled": true,
+        "address": "imap.example.com:993",
+        "tls": true,
+        "user": "invoices",
+        "password": "secret",
+        "processedMailbox": "Archive",
+        "errorMailbox": "Failed"
+    },
+    "trash": {
+        "purgeAfterDays": 30,
+        "purgeInterval": "12h"
+    },
+    "reconcile": {
+        "enabled": true,
+        "interval": "6h",
+        "gracePeriod": "2h",
+        "fix": true
     }
 }`
 
@@ -55,25 +94,58 @@ func TestConfigReader(t *testing.T) {
 		t.Error("Could not read.", err)
 	}
 
+	assert.Equal(t, "sqlite3", config.DB.Driver)
 	assert.Equal(t, "./bookmarks.db", config.DB.ConnStr)
+	assert.Equal(t, true, config.DB.Migrate)
 
 	assert.Equal(t, "https://login.url.com", config.Sec.LoginRedirect)
 	assert.Equal(t, "bookmarks", config.Sec.Claim.Name)
 	assert.Equal(t, "secret", config.Sec.JwtSecret)
 	assert.Equal(t, "10m", config.Sec.CacheDuration)
+	assert.Equal(t, "Admin", config.Sec.AdminRole)
 
 	assert.Equal(t, int64(1000), config.UP.MaxUploadSize)
 	assert.Equal(t, "/PATH", config.UP.UploadPath)
 	assert.Equal(t, 2, len(config.UP.AllowedFileTypes))
+	assert.Equal(t, "24h", config.UP.TokenTTL)
+	assert.Equal(t, "30m", config.UP.CleanupInterval)
+	assert.True(t, config.UP.ConvertImages)
+	assert.True(t, config.UP.RejectDuplicates)
+
+	assert.True(t, config.Ingest.Enabled)
+	assert.Equal(t, "/scans", config.Ingest.Path)
+	assert.Equal(t, "/scans-archive", config.Ingest.ArchivePath)
+	assert.Equal(t, "/scans-error", config.Ingest.ErrorPath)
+	assert.Equal(t, "upload", config.Ingest.Mode)
+	assert.Equal(t, "2m", config.Ingest.Interval)
+	assert.True(t, config.Mail.Enabled)
+	assert.Equal(t, "imap.example.com:993", config.Mail.Address)
+	assert.True(t, config.Mail.TLS)
+	assert.Equal(t, "invoices", config.Mail.User)
+	assert.Equal(t, "secret", config.Mail.Password)
+	assert.Equal(t, "", config.Mail.Mailbox)
+	assert.Equal(t, "Archive", config.Mail.ProcessedMailbox)
+	assert.Equal(t, "Failed", config.Mail.ErrorMailbox)
+	assert.Equal(t, 30, config.Trash.PurgeAfterDays)
+	assert.Equal(t, "12h", config.Trash.PurgeInterval)
+	assert.True(t, config.Reconcile.Enabled)
+	assert.Equal(t, "6h", config.Reconcile.Interval)
+	assert.Equal(t, "2h", config.Reconcile.GracePeriod)
+	assert.True(t, config.Reconcile.Fix)
 
 	assert.Equal(t, "/temp/file", config.Log.FilePath)
 	assert.Equal(t, "debug", config.Log.LogLevel)
 
+	assert.Equal(t, "local", config.Store.Backend)
+	assert.Equal(t, "/opt/mydms/files", config.Store.LocalPath)
 	assert.Equal(t, "_REGION_", config.Store.Region)
 	assert.Equal(t, "_BUCKET_NAME_", config.Store.Bucket)
 	assert.Equal(t, "_BUCKET_NAME_", config.Store.Bucket)
 	assert.Equal(t, "key", config.Store.Key)
 	assert.Equal(t, "secret", config.Store.Secret)
+	assert.Equal(t, "http://localhost:9000", config.Store.Endpoint)
+	assert.Equal(t, true, config.Store.PathStyle)
+	assert.Equal(t, true, config.Store.InsecureSkipVerify)
 
 	assert.Equal(t, 500, config.Cors.MaxAge)
 	assert.Equal(t, true, config.Cors.AllowCredentials)
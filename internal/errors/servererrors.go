@@ -68,6 +68,30 @@ func (e ServerError) Error() string {
 	return fmt.Sprintf("the request '%s' resulted in an unexpected error: %v", e.Request.RequestURI, e.Err)
 }
 
+// ConflictError indicates that the request conflicts with an existing object
+type ConflictError struct {
+	Err     error
+	Request *http.Request
+	// URL references the existing object
+	URL string
+}
+
+// Error implements the error interface
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("the request '%s' conflicts with an existing object: %v", e.Request.RequestURI, e.Err)
+}
+
+// ForbiddenError indicates that the authenticated user lacks the permission for the request
+type ForbiddenError struct {
+	Err     error
+	Request *http.Request
+}
+
+// Error implements the error interface
+func (e ForbiddenError) Error() string {
+	return fmt.Sprintf("the request '%s' is not permitted: %v", e.Request.RequestURI, e.Err)
+}
+
 // RedirectError is a specific error indicating a necessary redirect
 type RedirectError struct {
 	Err     error
@@ -117,6 +141,27 @@ func ErrServerError(err ServerError) *ProblemDetail {
 	}
 }
 
+// ErrConflict returns a http.StatusConflict
+func ErrConflict(err ConflictError) *ProblemDetail {
+	return &ProblemDetail{
+		Type:     t,
+		Title:    "the request conflicts with an existing object",
+		Status:   http.StatusConflict,
+		Detail:   err.Error(),
+		Instance: err.URL,
+	}
+}
+
+// ErrForbidden returns a http.StatusForbidden
+func ErrForbidden(err ForbiddenError) *ProblemDetail {
+	return &ProblemDetail{
+		Type:   t,
+		Title:  "the request is not permitted",
+		Status: http.StatusForbidden,
+		Detail: err.Error(),
+	}
+}
+
 // ErrRedirectError returns a http.StatusTemporaryRedirect
 func ErrRedirectError(err RedirectError) *ProblemDetail {
 	return &ProblemDetail{
@@ -148,6 +193,18 @@ func CustomErrorHandler(err error, c echo.Context) {
 		return
 	}
 
+	if conflict, ok := err.(ConflictError); ok {
+		e = ErrConflict(conflict)
+		_ = c.JSON(e.Status, e)
+		return
+	}
+
+	if forbidden, ok := err.(ForbiddenError); ok {
+		e = ErrForbidden(forbidden)
+		_ = c.JSON(e.Status, e)
+		return
+	}
+
 	if redirect, ok := err.(RedirectError); ok {
 		e = ErrRedirectError(redirect)
 		switch content {
@@ -42,6 +42,16 @@ func TestErrorHandler(t *testing.T) {
 			Status: http.StatusBadRequest,
 			Error:  BadRequestError{Err: fmt.Errorf(errText), Request: errReq},
 		},
+		{
+			Name:   "ConflictError",
+			Status: http.StatusConflict,
+			Error:  ConflictError{Err: fmt.Errorf(errText), Request: errReq, URL: redirect},
+		},
+		{
+			Name:   "ForbiddenError",
+			Status: http.StatusForbidden,
+			Error:  ForbiddenError{Err: fmt.Errorf(errText), Request: errReq},
+		},
 		{
 			Name:   "RedirectError",
 			Status: http.StatusTemporaryRedirect,
@@ -88,7 +98,7 @@ func TestErrorHandler(t *testing.T) {
 
 			assert.Equal(t, tc.Status, pd.Status)
 
-			if tc.Name == "RedirectError" {
+			if tc.Name == "RedirectError" || tc.Name == "ConflictError" {
 				assert.Equal(t, redirect, pd.Instance)
 			}
 		})
@@ -0,0 +1,103 @@
+package fulltext
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bihe/mydms/internal/persistence"
+)
+
+// batchSize defines the number of index entries which are written with a single statement
+const batchSize = 100
+
+// Field is a text of an indexed item, the weight defines the relevance of a match within the field
+// multiple fields with the same ID are indexed as separate values, a phrase does not match across values
+type Field struct {
+	ID     int
+	Weight int
+	Text   string
+}
+
+// Update replaces the index entries of the item with the given id
+// the index entries are stored in the table SEARCH_INDEX
+func Update(a *persistence.Atomic, id string, fields ...Field) error {
+	if err := Remove(a, id); err != nil {
+		return err
+	}
+
+	var (
+		values []string
+		args   []interface{}
+	)
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		stmt := "INSERT INTO SEARCH_INDEX (document_id,field,position,term,weight) VALUES " + strings.Join(values, ",")
+		if _, err := a.Exec(a.Rebind(stmt), args...); err != nil {
+			return fmt.Errorf("could not write search index: %v", err)
+		}
+		values, args = values[:0], args[:0]
+		return nil
+	}
+
+	positions := make(map[int]int)
+	for _, f := range fields {
+		pos := positions[f.ID]
+		for _, term := range Tokenize(f.Text) {
+			values = append(values, "(?,?,?,?,?)")
+			args = append(args, id, f.ID, pos, term, f.Weight)
+			pos++
+			if len(values) == batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		// leave a gap to the next value of the field
+		positions[f.ID] = pos + 1
+	}
+	return flush()
+}
+
+// Remove deletes the index entries of the item with the given id
+func Remove(a *persistence.Atomic, id string) error {
+	if _, err := a.Exec(a.Rebind("DELETE FROM SEARCH_INDEX WHERE document_id = ?"), id); err != nil {
+		return fmt.Errorf("could not delete search index: %v", err)
+	}
+	return nil
+}
+
+// Match returns the condition to filter the items of the id column and the expression to rank the items by relevance
+// the values of the named parameters used in the SQL fragments are added to args
+func Match(q Query, idColumn string, args map[string]interface{}) (condition, relevance string) {
+	param := func(term string) string {
+		name := fmt.Sprintf("ft%d", len(args))
+		args[name] = term
+		return ":" + name
+	}
+
+	var groups []string
+	for _, g := range q.Groups {
+		var clauses []string
+		for _, c := range g {
+			// the terms of a phrase are consecutive positions within the same field
+			from := "SEARCH_INDEX s0"
+			where := fmt.Sprintf("s0.document_id = %s AND s0.term = %s", idColumn, param(c[0]))
+			for i := 1; i < len(c); i++ {
+				from += fmt.Sprintf(" JOIN SEARCH_INDEX s%[1]d ON s%[1]d.document_id = s0.document_id AND s%[1]d.field = s0.field AND s%[1]d.position = s0.position + %[1]d", i)
+				where += fmt.Sprintf(" AND s%d.term = %s", i, param(c[i]))
+			}
+			clauses = append(clauses, fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", from, where))
+		}
+		groups = append(groups, "("+strings.Join(clauses, " AND ")+")")
+	}
+	condition = "(" + strings.Join(groups, " OR ") + ")"
+
+	var terms []string
+	for _, t := range q.Terms() {
+		terms = append(terms, param(t))
+	}
+	relevance = fmt.Sprintf("(SELECT COALESCE(SUM(r.weight), 0) FROM SEARCH_INDEX r WHERE r.document_id = %s AND r.term IN (%s))", idColumn, strings.Join(terms, ","))
+	return condition, relevance
+}
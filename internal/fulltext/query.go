@@ -0,0 +1,120 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTermLength limits the length of an indexed term, longer terms are truncated
+const maxTermLength = 64
+
+// Tokenize splits the given text into lower-case terms
+// letters and digits form a term, all other characters are separators
+func Tokenize(text string) []string {
+	var (
+		terms []string
+		term  []rune
+	)
+	flush := func() {
+		if len(term) > 0 {
+			if len(term) > maxTermLength {
+				term = term[:maxTermLength]
+			}
+			terms = append(terms, string(term))
+			term = term[:0]
+		}
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			term = append(term, unicode.ToLower(r))
+			continue
+		}
+		flush()
+	}
+	flush()
+	return terms
+}
+
+// Clause is a single word or a phrase, the terms of a phrase need to occur in the given order
+type Clause []string
+
+// Query is a parsed full-text query. The groups are combined with OR, the clauses of a group with AND
+type Query struct {
+	Groups [][]Clause
+}
+
+// ParseQuery parses the search syntax: terms separated by whitespace need to match all (AND),
+// the keyword OR (or |) combines alternatives and "quoted terms" are matched as a phrase
+func ParseQuery(s string) Query {
+	var (
+		q     Query
+		group []Clause
+	)
+	add := func(text string) {
+		if terms := Tokenize(text); len(terms) > 0 {
+			group = append(group, Clause(terms))
+		}
+	}
+	next := func() {
+		if len(group) > 0 {
+			q.Groups = append(q.Groups, group)
+			group = nil
+		}
+	}
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			add(s[1 : end+1])
+			s = s[min(end+2, len(s)):]
+			continue
+		}
+
+		end := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(s)
+		}
+		switch word := s[:end]; word {
+		case "OR", "|", "||":
+			next()
+		case "AND", "&", "&&":
+		default:
+			add(word)
+		}
+		s = s[end:]
+	}
+	next()
+	return q
+}
+
+// Empty returns true if the query has no terms
+func (q Query) Empty() bool {
+	return len(q.Groups) == 0
+}
+
+// Terms returns the distinct terms of the query
+func (q Query) Terms() []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, g := range q.Groups {
+		for _, c := range g {
+			for _, t := range c {
+				if !seen[t] {
+					seen[t] = true
+					terms = append(terms, t)
+				}
+			}
+		}
+	}
+	return terms
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,51 @@
+package fulltext
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"invoice", "2020", "01", "straße"}, Tokenize("Invoice 2020-01, Straße!"))
+	assert.Equal(t, 0, len(Tokenize(" - ; ")))
+	assert.Equal(t, maxTermLength, len(Tokenize(strings.Repeat("a", 100))[0]))
+}
+
+func TestParseQuery(t *testing.T) {
+	cases := []struct {
+		query  string
+		groups [][]Clause
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"invoice", [][]Clause{{{"invoice"}}}},
+		{"Invoice Tax", [][]Clause{{{"invoice"}, {"tax"}}}},
+		{"invoice AND tax", [][]Clause{{{"invoice"}, {"tax"}}}},
+		{"invoice OR tax", [][]Clause{{{"invoice"}}, {{"tax"}}}},
+		{"invoice | tax car", [][]Clause{{{"invoice"}}, {{"tax"}, {"car"}}}},
+		{`"tax return" 2019`, [][]Clause{{{"tax", "return"}, {"2019"}}}},
+		{`insurance "car`, [][]Clause{{{"insurance"}, {"car"}}}},
+		{`a-b OR OR c`, [][]Clause{{{"a", "b"}}, {{"c"}}}},
+		{`"" OR`, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			q := ParseQuery(c.query)
+			assert.Equal(t, c.groups, q.Groups)
+			assert.Equal(t, len(c.groups) == 0, q.Empty())
+		})
+	}
+
+	assert.Equal(t, []string{"tax", "return", "car"}, ParseQuery(`"tax return" OR tax car`).Terms())
+}
+
+func TestMatch(t *testing.T) {
+	args := make(map[string]interface{})
+	condition, relevance := Match(ParseQuery(`"tax return" OR car`), "DOCUMENTS.id", args)
+
+	assert.Equal(t, "((EXISTS (SELECT 1 FROM SEARCH_INDEX s0 JOIN SEARCH_INDEX s1 ON s1.document_id = s0.document_id AND s1.field = s0.field AND s1.position = s0.position + 1 WHERE s0.document_id = DOCUMENTS.id AND s0.term = :ft0 AND s1.term = :ft1)) OR (EXISTS (SELECT 1 FROM SEARCH_INDEX s0 WHERE s0.document_id = DOCUMENTS.id AND s0.term = :ft2)))", condition)
+	assert.Equal(t, "(SELECT COALESCE(SUM(r.weight), 0) FROM SEARCH_INDEX r WHERE r.document_id = DOCUMENTS.id AND r.term IN (:ft3,:ft4,:ft5))", relevance)
+	assert.Equal(t, map[string]interface{}{"ft0": "tax", "ft1": "return", "ft2": "car", "ft3": "tax", "ft4": "return", "ft5": "car"}, args)
+}
@@ -0,0 +1,71 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// imageTypes lists the mime-types of images which can be converted to a PDF document
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/tiff": true,
+	"image/webp": true,
+}
+
+func init() {
+	// pdfcpu should not create a configuration directory for the user running the application
+	pdfcpu.ConfigPath = "disable"
+}
+
+// IsImage returns true if an image of the given mime-type can be converted to a PDF document
+func IsImage(mimeType string) bool {
+	return imageTypes[mimeType]
+}
+
+// FromImages creates a PDF document with a page for each image, the page has the size of the image
+func FromImages(images ...[]byte) ([]byte, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to convert")
+	}
+	readers := make([]io.Reader, len(images))
+	for i, img := range images {
+		readers[i] = bytes.NewReader(img)
+	}
+	var b bytes.Buffer
+	if err := api.ImportImages(nil, &b, readers, pdfcpu.DefaultImportConfig(), config()); err != nil {
+		return nil, fmt.Errorf("could not convert the images to a PDF document: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// Merge combines the pages of the given PDF documents in a single document
+func Merge(documents ...[]byte) ([]byte, error) {
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("no documents to merge")
+	}
+	if len(documents) == 1 {
+		return documents[0], nil
+	}
+	readers := make([]io.ReadSeeker, len(documents))
+	for i, d := range documents {
+		readers[i] = bytes.NewReader(d)
+	}
+	var b bytes.Buffer
+	if err := api.Merge(readers, &b, config()); err != nil {
+		return nil, fmt.Errorf("could not merge the PDF documents: %v", err)
+	}
+	return b.Bytes(), nil
+}
+
+// config returns the pdfcpu configuration, documents are only validated in a relaxed way
+// scanners and other applications often create documents which do not follow the specification in detail
+func config() *pdfcpu.Configuration {
+	c := pdfcpu.NewDefaultConfiguration()
+	c.ValidationMode = pdfcpu.ValidationRelaxed
+	return c
+}
@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func pageCount(t *testing.T, payload []byte) int {
+	n, err := api.PageCount(bytes.NewReader(payload), config())
+	if err != nil {
+		t.Fatalf("could not read the PDF document: %v", err)
+	}
+	return n
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		img.Set(x, x/2, color.RGBA{R: 255, A: 255})
+	}
+	return img
+}
+
+func TestFromImages(t *testing.T) {
+	var p, j bytes.Buffer
+	png.Encode(&p, testImage())
+	jpeg.Encode(&j, testImage(), nil)
+
+	payload, err := FromImages(p.Bytes(), j.Bytes())
+	if err != nil {
+		t.Fatalf("could not convert images: %v", err)
+	}
+	assert.True(t, bytes.HasPrefix(payload, []byte("%PDF-")))
+	assert.Equal(t, 2, pageCount(t, payload))
+
+	if _, err := FromImages([]byte("no image")); err == nil {
+		t.Errorf("error for invalid image expected")
+	}
+	if _, err := FromImages(); err == nil {
+		t.Errorf("error for missing images expected")
+	}
+	assert.True(t, IsImage("image/png"))
+	assert.False(t, IsImage("application/pdf"))
+}
+
+func TestMerge(t *testing.T) {
+	payload, err := Merge(textPDF("Invoice", "Page 2"), textPDF("Delivery note"))
+	if err != nil {
+		t.Fatalf("could not merge documents: %v", err)
+	}
+	assert.Equal(t, 3, pageCount(t, payload))
+	text, err := ExtractText(payload)
+	if err != nil {
+		t.Fatalf("could not extract text: %v", err)
+	}
+	assert.Contains(t, text, "Invoice")
+	assert.Contains(t, text, "Delivery note")
+
+	if _, err := Merge(textPDF("Invoice"), []byte("no pdf")); err == nil {
+		t.Errorf("error for invalid document expected")
+	}
+	if _, err := Merge(); err == nil {
+		t.Errorf("error for missing documents expected")
+	}
+}
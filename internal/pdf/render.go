@@ -0,0 +1,131 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	pdfreader "github.com/ledongthuc/pdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	// decoders of the images embedded in a document
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+)
+
+// maxPageSize limits the size of a rendered page in points
+const maxPageSize = 2000
+
+// minImageSize is the minimal width and height of an embedded image to represent a page
+// smaller images are logos or signatures, not the scan of a page
+const minImageSize = 200
+
+// RenderPage returns an image of the given page (starting with 1) of the PDF document.
+// The page of a scanned document is represented by its embedded image, for other documents
+// the text of the page is drawn on a blank page. Graphics and the fonts of the document are
+// not considered, the image is only meant to be used as a thumbnail.
+func RenderPage(payload []byte, page int) (image.Image, error) {
+	if img := pageImage(payload, page); img != nil {
+		return img, nil
+	}
+	return renderText(payload, page)
+}
+
+// pageImage returns the largest embedded image of the page, nil if there is no suitable image
+func pageImage(payload []byte, page int) image.Image {
+	ctx, err := api.ReadContext(bytes.NewReader(payload), config())
+	if err != nil {
+		return nil
+	}
+	if err = api.OptimizeContext(ctx); err != nil {
+		return nil
+	}
+	if err = ctx.EnsurePageCount(); err != nil || page < 1 || page > ctx.PageCount {
+		return nil
+	}
+	images, err := ctx.ExtractPageImages(page)
+	if err != nil {
+		return nil
+	}
+
+	var (
+		largest image.Image
+		area    int
+	)
+	for _, i := range images {
+		img, _, err := image.Decode(i)
+		if err != nil {
+			continue
+		}
+		b := img.Bounds()
+		if b.Dx() < minImageSize || b.Dy() < minImageSize {
+			continue
+		}
+		if a := b.Dx() * b.Dy(); a > area {
+			largest, area = img, a
+		}
+	}
+	return largest
+}
+
+// renderText draws the text of the page at its position on a white page
+func renderText(payload []byte, page int) (img image.Image, err error) {
+	defer func() {
+		// the pdf reader panics on malformed documents
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not read the PDF document: %v", r)
+		}
+	}()
+
+	r, err := pdfreader.NewReader(bytes.NewReader(payload), int64(len(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the PDF document: %v", err)
+	}
+	if page < 1 || page > r.NumPage() {
+		return nil, fmt.Errorf("the document has no page %d", page)
+	}
+	p := r.Page(page)
+	if p.V.IsNull() {
+		return nil, fmt.Errorf("could not read page %d", page)
+	}
+
+	width, height := mediaBox(p)
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	d := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(color.Gray{Y: 64}),
+		Face: basicfont.Face7x13,
+	}
+	for _, t := range p.Content().Text {
+		// the coordinates of PDF start at the bottom
+		d.Dot = fixed.P(int(t.X), height-int(t.Y))
+		d.DrawString(t.S)
+	}
+	return canvas, nil
+}
+
+// mediaBox returns the size of the page in points, an A4 page is used if the size is not defined
+func mediaBox(p pdfreader.Page) (int, int) {
+	for v := p.V; !v.IsNull(); v = v.Key("Parent") {
+		box := v.Key("MediaBox")
+		if box.Len() != 4 {
+			continue
+		}
+		w := int(math.Abs(box.Index(2).Float64() - box.Index(0).Float64()))
+		h := int(math.Abs(box.Index(3).Float64() - box.Index(1).Float64()))
+		if w > 0 && h > 0 && w <= maxPageSize && h <= maxPageSize {
+			return w, h
+		}
+		break
+	}
+	return 595, 842
+}
@@ -0,0 +1,38 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPage(t *testing.T) {
+	img, err := RenderPage(textPDF("Invoice 2020-0815", "Page 2"), 1)
+	if err != nil {
+		t.Fatalf("could not render page: %v", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 200, 50), img.Bounds())
+
+	// the page of a scanned document is the embedded image
+	var scan bytes.Buffer
+	png.Encode(&scan, image.NewGray(image.Rect(0, 0, 400, 300)))
+	payload, err := FromImages(scan.Bytes())
+	if err != nil {
+		t.Fatalf("could not create document: %v", err)
+	}
+	img, err = RenderPage(payload, 1)
+	if err != nil {
+		t.Fatalf("could not render page: %v", err)
+	}
+	assert.Equal(t, image.Rect(0, 0, 400, 300), img.Bounds())
+
+	if _, err := RenderPage(textPDF("Invoice"), 2); err == nil {
+		t.Errorf("error for missing page expected")
+	}
+	if _, err := RenderPage([]byte("no pdf"), 1); err == nil {
+		t.Errorf("error for invalid document expected")
+	}
+}
@@ -0,0 +1,66 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	pdfreader "github.com/ledongthuc/pdf"
+)
+
+// MaxTextLength limits the size of the extracted text in bytes
+const MaxTextLength = 1 << 20
+
+// ExtractText returns the embedded text layer of the given PDF document
+// documents without a text layer (e.g. plain scans) return an empty string
+func ExtractText(payload []byte) (text string, err error) {
+	defer func() {
+		// the pdf reader panics on malformed documents
+		if r := recover(); r != nil {
+			err = fmt.Errorf("could not read the PDF document: %v", r)
+		}
+	}()
+
+	r, err := pdfreader.NewReader(bytes.NewReader(payload), int64(len(payload)))
+	if err != nil {
+		return "", fmt.Errorf("could not read the PDF document: %v", err)
+	}
+
+	var b strings.Builder
+	fonts := make(map[string]*pdfreader.Font)
+	for i := 1; i <= r.NumPage() && b.Len() < MaxTextLength; i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		for _, name := range p.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := p.Font(name)
+				fonts[name] = &f
+			}
+		}
+		t, err := p.GetPlainText(fonts)
+		if err != nil {
+			return "", fmt.Errorf("could not read the text of page %d: %v", i, err)
+		}
+		if t = strings.Join(strings.Fields(t), " "); t != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(t)
+		}
+	}
+	return truncate(b.String(), MaxTextLength), nil
+}
+
+// truncate shortens the text to max bytes without splitting a character
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return text[:max]
+}
@@ -0,0 +1,71 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// textPDF creates a PDF document with a page for each of the given texts
+func textPDF(texts ...string) []byte {
+	var objects []string
+	kids := ""
+	for i, t := range texts {
+		page := 4 + 2*i
+		kids += fmt.Sprintf("%d 0 R ", page)
+		content := fmt.Sprintf("BT /F1 12 Tf 10 10 Td (%s) Tj ET", t)
+		objects = append(objects,
+			fmt.Sprintf("<</Type/Page/Parent 2 0 R/MediaBox[0 0 200 50]/Resources<</Font<</F1 3 0 R>>>>/Contents %d 0 R>>", page+1),
+			fmt.Sprintf("<</Length %d>>\nstream\n%s\nendstream", len(content), content))
+	}
+	objects = append([]string{
+		"<</Type/Catalog/Pages 2 0 R>>",
+		fmt.Sprintf("<</Type/Pages/Kids[%s]/Count %d>>", kids, len(texts)),
+		"<</Type/Font/Subtype/Type1/BaseFont/Helvetica/Encoding/WinAnsiEncoding>>",
+	}, objects...)
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestExtractText(t *testing.T) {
+	text, err := ExtractText(textPDF("Invoice 2020-0815", "Amount: 42.00 EUR"))
+	if err != nil {
+		t.Fatalf("could not extract text: %v", err)
+	}
+	assert.Contains(t, text, "Invoice 2020-0815")
+	assert.Contains(t, text, "42.00 EUR")
+
+	text, err = ExtractText(textPDF(""))
+	if err != nil {
+		t.Fatalf("could not extract text: %v", err)
+	}
+	assert.Equal(t, "", text)
+
+	if _, err := ExtractText([]byte("no pdf")); err == nil {
+		t.Errorf("error for invalid document expected")
+	}
+	if _, err := ExtractText([]byte("%PDF-1.4\n1 0 obj<</Type/Catalog>>endobj\ntrailer<</Root 1 0 R>>\n%%EOF")); err == nil {
+		t.Errorf("error for malformed document expected")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 5))
+	assert.Equal(t, "ab", truncate("abc", 2))
+	assert.Equal(t, "a", truncate("aü", 2))
+}
@@ -15,9 +15,17 @@ type Connection struct {
 }
 
 // NewConn creates a connection to a store/repository
-func NewConn(connstr string) Connection {
-	// dialect is specifically set to "mysql"
-	db := sqlx.MustConnect("mysql", connstr)
+// the driver defines the SQL dialect, if no driver is supplied "mysql" is used
+func NewConn(driver, connstr string) Connection {
+	dialect, err := ParseDialect(driver)
+	if err != nil {
+		panic(err)
+	}
+	db := sqlx.MustConnect(string(dialect), connstr)
+	if dialect == SQLite {
+		// a SQLite database only supports a single writer
+		db.SetMaxOpenConns(1)
+	}
 	return Connection{DB: db, Active: true}
 }
 
@@ -0,0 +1,61 @@
+package persistence
+
+import "fmt"
+
+// Dialect identifies the SQL flavor of a database, the value is the name of the database driver
+type Dialect string
+
+const (
+	// MySQL is used for MySQL and MariaDB databases
+	MySQL Dialect = "mysql"
+	// SQLite is used for file-based SQLite databases
+	SQLite Dialect = "sqlite3"
+	// Postgres is used for PostgreSQL databases
+	Postgres Dialect = "postgres"
+)
+
+// ParseDialect returns the dialect for the given driver name, the default is MySQL
+func ParseDialect(driver string) (Dialect, error) {
+	switch Dialect(driver) {
+	case "", MySQL:
+		return MySQL, nil
+	case SQLite:
+		return SQLite, nil
+	case Postgres:
+		return Postgres, nil
+	}
+	return "", fmt.Errorf("the database driver '%s' is not supported", driver)
+}
+
+// LockForUpdate returns the clause to lock selected rows for the current transaction
+// SQLite locks the whole database on write, therefore no clause is necessary
+func (d Dialect) LockForUpdate() string {
+	if d == SQLite {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// Paging returns the clause to limit the number of rows and to skip rows
+// the clause uses the named parameters :limit and :offset, which need to be supplied by the caller
+// MySQL and SQLite do not support an OFFSET without a LIMIT, the maximum number of rows is used instead
+func (d Dialect) Paging(limit, offset int) string {
+	paging := ""
+	switch {
+	case limit > 0:
+		paging += "\nLIMIT :limit"
+	case offset > 0 && d == MySQL:
+		paging += "\nLIMIT 18446744073709551615"
+	case offset > 0 && d == SQLite:
+		paging += "\nLIMIT -1"
+	}
+	if offset > 0 {
+		paging += "\nOFFSET :offset"
+	}
+	return paging
+}
+
+// Dialect returns the SQL dialect of the connection
+func (c Connection) Dialect() Dialect {
+	return Dialect(c.DriverName())
+}
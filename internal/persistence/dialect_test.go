@@ -0,0 +1,41 @@
+package persistence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDialect(t *testing.T) {
+	cases := map[string]Dialect{
+		"":         MySQL,
+		"mysql":    MySQL,
+		"sqlite3":  SQLite,
+		"postgres": Postgres,
+	}
+	for driver, dialect := range cases {
+		d, err := ParseDialect(driver)
+		if err != nil {
+			t.Errorf("could not parse dialect '%s': %v", driver, err)
+		}
+		assert.Equal(t, dialect, d)
+	}
+	if _, err := ParseDialect("oracle"); err == nil {
+		t.Errorf("error for unsupported driver expected")
+	}
+}
+
+func TestPaging(t *testing.T) {
+	assert.Equal(t, "", MySQL.Paging(0, 0))
+	assert.Equal(t, "\nLIMIT :limit", Postgres.Paging(10, 0))
+	assert.Equal(t, "\nLIMIT :limit\nOFFSET :offset", SQLite.Paging(10, 20))
+	assert.Equal(t, "\nOFFSET :offset", Postgres.Paging(0, 20))
+	assert.Equal(t, "\nLIMIT -1\nOFFSET :offset", SQLite.Paging(0, 20))
+	assert.Equal(t, "\nLIMIT 18446744073709551615\nOFFSET :offset", MySQL.Paging(0, 20))
+}
+
+func TestLockForUpdate(t *testing.T) {
+	assert.Equal(t, " FOR UPDATE", MySQL.LockForUpdate())
+	assert.Equal(t, " FOR UPDATE", Postgres.LockForUpdate())
+	assert.Equal(t, "", SQLite.LockForUpdate())
+}
@@ -0,0 +1,196 @@
+package persistence
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration defines a versioned change of the database schema
+type Migration struct {
+	// Version is the unique, ascending number of the migration
+	Version int
+	// Description explains the purpose of the migration
+	Description string
+	// Up holds the statements to apply the migration
+	Up Statements
+	// Down holds the statements to revert the migration
+	Down Statements
+	// UpFunc is executed after the Up statements within the same transaction, e.g. to migrate data
+	UpFunc func(a *Atomic) error
+}
+
+// AnyDialect is used for statements which are valid for all dialects
+const AnyDialect Dialect = "*"
+
+// Statements holds the SQL statements of a migration per dialect
+type Statements map[Dialect][]string
+
+// For returns the statements of the given dialect or the statements of AnyDialect
+func (s Statements) For(d Dialect) []string {
+	if stmts, ok := s[d]; ok {
+		return stmts
+	}
+	return s[AnyDialect]
+}
+
+// MigrationStatus combines a migration and the time it was applied
+// the time is zero if the migration is not applied
+type MigrationStatus struct {
+	Migration
+	Applied time.Time
+}
+
+// Migrator applies or reverts the migrations of a database
+// applied versions are tracked in the table SCHEMA_MIGRATIONS
+type Migrator struct {
+	c          Connection
+	migrations []Migration
+}
+
+const createMigrationTable = `CREATE TABLE IF NOT EXISTS SCHEMA_MIGRATIONS (
+	version INT NOT NULL,
+	description VARCHAR(255) NOT NULL,
+	applied %s NOT NULL,
+	PRIMARY KEY (version)
+)`
+
+// NewMigrator creates a migrator for the given connection and the list of available migrations
+func NewMigrator(c Connection, migrations []Migration) (*Migrator, error) {
+	if !c.Active {
+		return nil, fmt.Errorf("no connection available")
+	}
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("invalid version %d of migration '%s'", m.Version, m.Description)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+	return &Migrator{c: c, migrations: sorted}, nil
+}
+
+// Up applies the pending migrations in ascending order, the number of migrations
+// is limited by steps. If steps is not a positive number all pending migrations are applied
+func (m *Migrator) Up(steps int) (applied []Migration, err error) {
+	versions, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range m.migrations {
+		if steps > 0 && len(applied) == steps {
+			break
+		}
+		if _, ok := versions[mig.Version]; ok {
+			continue
+		}
+		log.Infof("apply migration %d: %s", mig.Version, mig.Description)
+		if err = m.run(mig.Up.For(m.c.Dialect()), mig.UpFunc, func(a *Atomic) error {
+			_, err := a.Exec(a.Rebind("INSERT INTO SCHEMA_MIGRATIONS (version,description,applied) VALUES (?,?,?)"), mig.Version, mig.Description, time.Now().UTC())
+			return err
+		}); err != nil {
+			return applied, fmt.Errorf("could not apply migration %d: %v", mig.Version, err)
+		}
+		applied = append(applied, mig)
+	}
+	return applied, nil
+}
+
+// Down reverts the given number of applied migrations, starting with the latest version
+func (m *Migrator) Down(steps int) (reverted []Migration, err error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("the number of migrations to revert is required")
+	}
+	versions, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := versions[mig.Version]; !ok {
+			continue
+		}
+		log.Infof("revert migration %d: %s", mig.Version, mig.Description)
+		if err = m.run(mig.Down.For(m.c.Dialect()), nil, func(a *Atomic) error {
+			_, err := a.Exec(a.Rebind("DELETE FROM SCHEMA_MIGRATIONS WHERE version = ?"), mig.Version)
+			return err
+		}); err != nil {
+			return reverted, fmt.Errorf("could not revert migration %d: %v", mig.Version, err)
+		}
+		reverted = append(reverted, mig)
+	}
+	return reverted, nil
+}
+
+// Status lists all available migrations and when they were applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	versions, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status = append(status, MigrationStatus{Migration: mig, Applied: versions[mig.Version]})
+	}
+	return status, nil
+}
+
+// appliedVersions returns the applied versions, the tracking table is created if necessary
+func (m *Migrator) appliedVersions() (map[int]time.Time, error) {
+	timestamp := "DATETIME"
+	if m.c.Dialect() == Postgres {
+		timestamp = "TIMESTAMP"
+	}
+	if _, err := m.c.Exec(fmt.Sprintf(createMigrationTable, timestamp)); err != nil {
+		return nil, fmt.Errorf("could not create the migration table: %v", err)
+	}
+	rows, err := m.c.Query("SELECT version, applied FROM SCHEMA_MIGRATIONS")
+	if err != nil {
+		return nil, fmt.Errorf("could not read the applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			v int
+			t time.Time
+		)
+		if err := rows.Scan(&v, &t); err != nil {
+			return nil, fmt.Errorf("could not read the applied migrations: %v", err)
+		}
+		versions[v] = t
+	}
+	return versions, rows.Err()
+}
+
+// run executes the statements, the optional function and the bookkeeping in a transaction
+// NOTE: some databases (e.g. mysql) implicitly commit DDL statements, a failing
+// migration can therefore leave partial changes, which need to be fixed manually
+func (m *Migrator) run(statements []string, fn, track func(a *Atomic) error) (err error) {
+	var atomic Atomic
+	if atomic, err = m.c.CreateAtomic(); err != nil {
+		return
+	}
+	defer func() {
+		err = HandleTX(true, &atomic, err)
+	}()
+
+	for _, stmt := range statements {
+		if _, err = atomic.Exec(stmt); err != nil {
+			return
+		}
+	}
+	if fn != nil {
+		if err = fn(&atomic); err != nil {
+			return
+		}
+	}
+	return track(&atomic)
+}
@@ -0,0 +1,148 @@
+package persistence
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMigrations = []Migration{
+	{Version: 2, Description: "second", Up: Statements{AnyDialect: {"CREATE TABLE B (id INT)"}}, Down: Statements{AnyDialect: {"DROP TABLE B"}}},
+	{Version: 1, Description: "first", Up: Statements{MySQL: {"CREATE TABLE A (id INT)"}, SQLite: {"CREATE TABLE A (id INTEGER)"}}, Down: Statements{AnyDialect: {"DROP TABLE A"}},
+		UpFunc: func(a *Atomic) error {
+			_, err := a.Exec("INSERT INTO A (id) VALUES (1)")
+			return err
+		}},
+}
+
+func mockMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	dbx := sqlx.NewDb(db, "mysql")
+	m, err := NewMigrator(Connection{DB: dbx, Active: true}, testMigrations)
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	return m, mock
+}
+
+func expectApplied(mock sqlmock.Sqlmock, versions ...int) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS SCHEMA_MIGRATIONS").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied"})
+	for _, v := range versions {
+		rows.AddRow(v, time.Now())
+	}
+	mock.ExpectQuery("SELECT version, applied FROM SCHEMA_MIGRATIONS").WillReturnRows(rows)
+}
+
+func TestNewMigrator(t *testing.T) {
+	if _, err := NewMigrator(Connection{}, testMigrations); err == nil {
+		t.Errorf("error for inactive connection expected")
+	}
+	c := Connection{Active: true}
+	if _, err := NewMigrator(c, []Migration{{Version: 1}, {Version: 1}}); err == nil {
+		t.Errorf("error for duplicate versions expected")
+	}
+	if _, err := NewMigrator(c, []Migration{{Version: 0}}); err == nil {
+		t.Errorf("error for invalid version expected")
+	}
+}
+
+func TestMigrateUp(t *testing.T) {
+	m, mock := mockMigrator(t)
+
+	expectApplied(mock)
+	for _, v := range []struct {
+		version int
+		stmt    string
+	}{{1, "CREATE TABLE A"}, {2, "CREATE TABLE B"}} {
+		mock.ExpectBegin()
+		mock.ExpectExec(v.stmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		if v.version == 1 {
+			mock.ExpectExec("INSERT INTO A").WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectExec("INSERT INTO SCHEMA_MIGRATIONS").WithArgs(v.version, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	applied, err := m.Up(0)
+	if err != nil {
+		t.Fatalf("could not apply migrations: %v", err)
+	}
+	assert.Equal(t, 2, len(applied))
+	assert.Equal(t, 1, applied[0].Version)
+	assert.Equal(t, 2, applied[1].Version)
+
+	// only the pending migration is applied
+	expectApplied(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE B").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO SCHEMA_MIGRATIONS").WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	applied, err = m.Up(0)
+	if err != nil {
+		t.Fatalf("could not apply migrations: %v", err)
+	}
+	assert.Equal(t, 1, len(applied))
+
+	// a failing migration is rolled back and stops the process
+	expectApplied(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE A").WillReturnError(fmt.Errorf("error"))
+	mock.ExpectRollback()
+	applied, err = m.Up(0)
+	if err == nil {
+		t.Errorf("error expected")
+	}
+	assert.Equal(t, 0, len(applied))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	m, mock := mockMigrator(t)
+
+	if _, err := m.Down(0); err == nil {
+		t.Errorf("error for missing steps expected")
+	}
+
+	expectApplied(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE B").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM SCHEMA_MIGRATIONS").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	reverted, err := m.Down(1)
+	if err != nil {
+		t.Fatalf("could not revert migrations: %v", err)
+	}
+	assert.Equal(t, 1, len(reverted))
+	assert.Equal(t, 2, reverted[0].Version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMigrateStatus(t *testing.T) {
+	m, mock := mockMigrator(t)
+
+	expectApplied(mock, 1)
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("could not get migration status: %v", err)
+	}
+	assert.Equal(t, 2, len(status))
+	assert.False(t, status[0].Applied.IsZero())
+	assert.True(t, status[1].Applied.IsZero())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/bihe/mydms/internal/persistence"
+)
+
+// listMigration defines the source column in DOCUMENTS and the target tables of a list
+type listMigration struct {
+	column string
+	table  string
+	join   string
+	ref    string
+}
+
+// migrateLists transfers the semicolon separated tags and senders of the documents into the relational tables
+// the logic is kept within the migration on purpose, later changes of the application must not change the migration
+func migrateLists(a *persistence.Atomic) error {
+	lists := []listMigration{
+		{column: "taglist", table: "TAGS", join: "DOCUMENT_TAGS", ref: "tag_id"},
+		{column: "senderlist", table: "SENDERS", join: "DOCUMENT_SENDERS", ref: "sender_id"},
+	}
+	for _, l := range lists {
+		var docs []struct {
+			ID   string `db:"id"`
+			List string `db:"list"`
+		}
+		if err := a.Select(&docs, fmt.Sprintf("SELECT id, %s AS list FROM DOCUMENTS", l.column)); err != nil {
+			return fmt.Errorf("could not read the %s of the documents: %v", l.column, err)
+		}
+
+		ids := make(map[string]string)
+		for _, d := range docs {
+			linked := make(map[string]bool)
+			for _, name := range strings.Split(d.List, ";") {
+				name = strings.TrimSpace(name)
+				normalized := strings.ToLower(name)
+				if name == "" || linked[normalized] {
+					continue
+				}
+				id, err := listEntry(a, l.table, name, normalized, ids)
+				if err != nil {
+					return err
+				}
+				if _, err := a.Exec(a.Rebind(fmt.Sprintf("INSERT INTO %s (document_id,%s) VALUES (?,?)", l.join, l.ref)), d.ID, id); err != nil {
+					return fmt.Errorf("could not link '%s' to document '%s': %v", name, d.ID, err)
+				}
+				linked[normalized] = true
+			}
+		}
+	}
+	return nil
+}
+
+// listEntry returns the id of the entry with the normalized name, the entry is created if it does not exist
+func listEntry(a *persistence.Atomic, table, name, normalized string, ids map[string]string) (string, error) {
+	if id, ok := ids[normalized]; ok {
+		return id, nil
+	}
+	var id string
+	err := a.Get(&id, a.Rebind(fmt.Sprintf("SELECT id FROM %s WHERE normalized = ?", table)), normalized)
+	switch {
+	case err == sql.ErrNoRows:
+		id = uuid.New().String()
+		if _, err := a.Exec(a.Rebind(fmt.Sprintf("INSERT INTO %s (id,name,normalized) VALUES (?,?,?)", table)), id, name, normalized); err != nil {
+			return "", fmt.Errorf("could not create '%s' in %s: %v", name, table, err)
+		}
+	case err != nil:
+		return "", fmt.Errorf("could not read '%s' from %s: %v", name, table, err)
+	}
+	ids[normalized] = id
+	return id, nil
+}
@@ -0,0 +1,420 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bihe/mydms/internal/persistence"
+)
+
+// Migrations lists the schema changes in ascending order
+// existing entries must not be changed, a change of the schema needs a new version
+var Migrations = []persistence.Migration{
+	{
+		Version:     1,
+		Description: "create table DOCUMENTS",
+		Up: persistence.Statements{
+			persistence.MySQL: {
+				`CREATE TABLE IF NOT EXISTS DOCUMENTS (
+	id VARCHAR(36) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	modified DATETIME,
+	invoicenumber VARCHAR(128),
+	PRIMARY KEY (id),
+	INDEX IX_DOCUMENTS_CREATED (created)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			persistence.SQLite: {
+				`CREATE TABLE IF NOT EXISTS DOCUMENTS (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	modified DATETIME,
+	invoicenumber VARCHAR(128)
+)`,
+				"CREATE INDEX IF NOT EXISTS IX_DOCUMENTS_CREATED ON DOCUMENTS (created)",
+			},
+			persistence.Postgres: {
+				`CREATE TABLE IF NOT EXISTS DOCUMENTS (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created TIMESTAMP NOT NULL,
+	modified TIMESTAMP,
+	invoicenumber VARCHAR(128)
+)`,
+				"CREATE INDEX IF NOT EXISTS IX_DOCUMENTS_CREATED ON DOCUMENTS (created)",
+			},
+		},
+		Down: persistence.Statements{
+			persistence.AnyDialect: {"DROP TABLE DOCUMENTS"},
+		},
+	},
+	{
+		Version:     2,
+		Description: "create table UPLOADS",
+		Up: persistence.Statements{
+			persistence.MySQL: {
+				`CREATE TABLE IF NOT EXISTS UPLOADS (
+	id VARCHAR(36) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	mimetype VARCHAR(128) NOT NULL,
+	created DATETIME NOT NULL,
+	PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			persistence.SQLite: {
+				`CREATE TABLE IF NOT EXISTS UPLOADS (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	filename VARCHAR(255) NOT NULL,
+	mimetype VARCHAR(128) NOT NULL,
+	created DATETIME NOT NULL
+)`,
+			},
+			persistence.Postgres: {
+				`CREATE TABLE IF NOT EXISTS UPLOADS (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	filename VARCHAR(255) NOT NULL,
+	mimetype VARCHAR(128) NOT NULL,
+	created TIMESTAMP NOT NULL
+)`,
+			},
+		},
+		Down: persistence.Statements{
+			persistence.AnyDialect: {"DROP TABLE UPLOADS"},
+		},
+	},
+	{
+		Version:     3,
+		Description: "normalize tags and senders of DOCUMENTS",
+		Up:          merge(listTables("TAGS", "DOCUMENT_TAGS", "tag_id"), listTables("SENDERS", "DOCUMENT_SENDERS", "sender_id")),
+		Down: persistence.Statements{
+			persistence.AnyDialect: {"DROP TABLE DOCUMENT_SENDERS", "DROP TABLE SENDERS", "DROP TABLE DOCUMENT_TAGS", "DROP TABLE TAGS"},
+		},
+		UpFunc: migrateLists,
+	},
+	{
+		Version:     4,
+		Description: "create the full-text index SEARCH_INDEX",
+		Up: persistence.Statements{
+			persistence.MySQL: {
+				`CREATE TABLE IF NOT EXISTS SEARCH_INDEX (
+	document_id VARCHAR(36) NOT NULL,
+	field SMALLINT NOT NULL,
+	position INT NOT NULL,
+	term VARCHAR(64) NOT NULL,
+	weight SMALLINT NOT NULL,
+	PRIMARY KEY (document_id, field, position),
+	INDEX IX_SEARCH_INDEX_TERM (term, document_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			persistence.SQLite:   searchIndex,
+			persistence.Postgres: searchIndex,
+		},
+		Down: persistence.Statements{
+			persistence.AnyDialect: {"DROP TABLE SEARCH_INDEX"},
+		},
+		UpFunc: indexDocuments,
+	},
+	{
+		Version:     5,
+		Description: "add the extracted text content to DOCUMENTS",
+		Up: persistence.Statements{
+			persistence.MySQL:      {"ALTER TABLE DOCUMENTS ADD COLUMN content MEDIUMTEXT"},
+			persistence.AnyDialect: {"ALTER TABLE DOCUMENTS ADD COLUMN content TEXT"},
+		},
+		Down: persistence.Statements{
+			persistence.SQLite:     sqliteRebuild("DOCUMENTS", sqliteDocuments, sqliteDocumentsIndex),
+			persistence.AnyDialect: {"ALTER TABLE DOCUMENTS DROP COLUMN content"},
+		},
+	},
+	{
+		Version:     6,
+		Description: "add the owner to UPLOADS",
+		Up: persistence.Statements{
+			persistence.AnyDialect: {"ALTER TABLE UPLOADS ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT ''"},
+		},
+		Down: persistence.Statements{
+			persistence.SQLite:     sqliteRebuild("UPLOADS", sqliteUploads),
+			persistence.AnyDialect: {"ALTER TABLE UPLOADS DROP COLUMN owner"},
+		},
+	},
+	{
+		Version:     7,
+		Description: "add the SHA-256 hash of the file to DOCUMENTS",
+		Up: persistence.Statements{
+			persistence.AnyDialect: {
+				"ALTER TABLE DOCUMENTS ADD COLUMN hash VARCHAR(64)",
+				"CREATE INDEX IX_DOCUMENTS_HASH ON DOCUMENTS (hash)",
+			},
+		},
+		Down: persistence.Statements{
+			persistence.SQLite:     sqliteRebuild("DOCUMENTS", sqliteDocuments+",\n\tcontent TEXT", sqliteDocumentsIndex),
+			persistence.AnyDialect: {"ALTER TABLE DOCUMENTS DROP COLUMN hash"},
+		},
+	},
+	{
+		Version:     8,
+		Description: "create the history of DOCUMENTS in DOCUMENT_VERSIONS",
+		Up: persistence.Statements{
+			persistence.MySQL: {
+				`CREATE TABLE IF NOT EXISTS DOCUMENT_VERSIONS (
+	document_id VARCHAR(36) NOT NULL,
+	version INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	modified DATETIME,
+	invoicenumber VARCHAR(128),
+	content MEDIUMTEXT,
+	hash VARCHAR(64),
+	versioned DATETIME NOT NULL,
+	PRIMARY KEY (document_id, version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+				initialVersions,
+			},
+			persistence.SQLite: {
+				`CREATE TABLE IF NOT EXISTS DOCUMENT_VERSIONS (
+	document_id VARCHAR(36) NOT NULL,
+	version INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	modified DATETIME,
+	invoicenumber VARCHAR(128),
+	content TEXT,
+	hash VARCHAR(64),
+	versioned DATETIME NOT NULL,
+	PRIMARY KEY (document_id, version)
+)`,
+				initialVersions,
+			},
+			persistence.Postgres: {
+				`CREATE TABLE IF NOT EXISTS DOCUMENT_VERSIONS (
+	document_id VARCHAR(36) NOT NULL,
+	version INT NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created TIMESTAMP NOT NULL,
+	modified TIMESTAMP,
+	invoicenumber VARCHAR(128),
+	content TEXT,
+	hash VARCHAR(64),
+	versioned TIMESTAMP NOT NULL,
+	PRIMARY KEY (document_id, version)
+)`,
+				initialVersions,
+			},
+		},
+		Down: persistence.Statements{
+			persistence.AnyDialect: {"DROP TABLE DOCUMENT_VERSIONS"},
+		},
+	},
+	{
+		Version:     9,
+		Description: "add the time a document was moved to the trash to DOCUMENTS",
+		Up: persistence.Statements{
+			persistence.Postgres: {
+				"ALTER TABLE DOCUMENTS ADD COLUMN deleted TIMESTAMP",
+				"CREATE INDEX IX_DOCUMENTS_DELETED ON DOCUMENTS (deleted)",
+			},
+			persistence.AnyDialect: {
+				"ALTER TABLE DOCUMENTS ADD COLUMN deleted DATETIME",
+				"CREATE INDEX IX_DOCUMENTS_DELETED ON DOCUMENTS (deleted)",
+			},
+		},
+		Down: persistence.Statements{
+			persistence.SQLite: sqliteRebuild("DOCUMENTS", sqliteDocuments+",\n\tcontent TEXT,\n\thash VARCHAR(64)",
+				sqliteDocumentsIndex, "CREATE INDEX IX_DOCUMENTS_HASH ON DOCUMENTS (hash)"),
+			persistence.AnyDialect: {"ALTER TABLE DOCUMENTS DROP COLUMN deleted"},
+		},
+	},
+	{
+		Version:     10,
+		Description: "create FILE_OUTBOX for the pending deletes of stored files",
+		Up: persistence.Statements{
+			persistence.MySQL: {
+				`CREATE TABLE IF NOT EXISTS FILE_OUTBOX (
+	id VARCHAR(36) NOT NULL,
+	path VARCHAR(255) NOT NULL,
+	created DATETIME NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	lasterror TEXT,
+	PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+			},
+			persistence.Postgres: {
+				`CREATE TABLE IF NOT EXISTS FILE_OUTBOX (
+	id VARCHAR(36) NOT NULL,
+	path VARCHAR(255) NOT NULL,
+	created TIMESTAMP NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	lasterror TEXT,
+	PRIMARY KEY (id)
+)`,
+			},
+			persistence.AnyDialect: {
+				`CREATE TABLE IF NOT EXISTS FILE_OUTBOX (
+	id VARCHAR(36) NOT NULL,
+	path VARCHAR(255) NOT NULL,
+	created DATETIME NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	lasterror TEXT,
+	PRIMARY KEY (id)
+)`,
+			},
+		},
+		Down: persistence.Statements{
+			persistence.AnyDialect: {"DROP TABLE FILE_OUTBOX"},
+		},
+	},
+}
+
+// sqliteDocuments are the columns of DOCUMENTS created by the first migration on SQLite
+const sqliteDocuments = `id VARCHAR(36) NOT NULL PRIMARY KEY,
+	title VARCHAR(255) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	alternativeid VARCHAR(128) NOT NULL,
+	previewlink VARCHAR(255),
+	amount DECIMAL(10,2) NOT NULL DEFAULT 0,
+	taglist TEXT NOT NULL,
+	senderlist TEXT NOT NULL,
+	created DATETIME NOT NULL,
+	modified DATETIME,
+	invoicenumber VARCHAR(128)`
+
+const sqliteDocumentsIndex = "CREATE INDEX IX_DOCUMENTS_CREATED ON DOCUMENTS (created)"
+
+// sqliteUploads are the columns of UPLOADS created by the second migration on SQLite
+const sqliteUploads = `id VARCHAR(36) NOT NULL PRIMARY KEY,
+	filename VARCHAR(255) NOT NULL,
+	mimetype VARCHAR(128) NOT NULL,
+	created DATETIME NOT NULL`
+
+// sqliteRebuild removes columns of a table on SQLite, the used version cannot drop columns:
+// the table is created again with the remaining columns, the data is copied and the indexes are created again
+func sqliteRebuild(table, columns string, indexes ...string) []string {
+	var names []string
+	for _, c := range strings.Split(columns, ",\n") {
+		names = append(names, strings.Fields(c)[0])
+	}
+	list := strings.Join(names, ",")
+	stmts := []string{
+		fmt.Sprintf("CREATE TABLE %s_REBUILD (\n\t%s\n)", table, columns),
+		fmt.Sprintf("INSERT INTO %[1]s_REBUILD (%[2]s) SELECT %[2]s FROM %[1]s", table, list),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %[1]s_REBUILD RENAME TO %[1]s", table),
+	}
+	return append(stmts, indexes...)
+}
+
+// initialVersions adds the current state of the existing documents as their first version
+const initialVersions = `INSERT INTO DOCUMENT_VERSIONS (document_id,version,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,content,hash,versioned)
+SELECT id,1,title,filename,alternativeid,previewlink,amount,taglist,senderlist,created,modified,invoicenumber,content,hash,COALESCE(modified,created) FROM DOCUMENTS`
+
+var searchIndex = []string{
+	`CREATE TABLE IF NOT EXISTS SEARCH_INDEX (
+	document_id VARCHAR(36) NOT NULL,
+	field SMALLINT NOT NULL,
+	position INT NOT NULL,
+	term VARCHAR(64) NOT NULL,
+	weight SMALLINT NOT NULL,
+	PRIMARY KEY (document_id, field, position)
+)`,
+	"CREATE INDEX IF NOT EXISTS IX_SEARCH_INDEX_TERM ON SEARCH_INDEX (term, document_id)",
+}
+
+// listTables creates the statements for a list of names (e.g. tags) and the join table to DOCUMENTS
+func listTables(table, join, ref string) persistence.Statements {
+	return persistence.Statements{
+		persistence.MySQL: {
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	id VARCHAR(36) NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	normalized VARCHAR(128) NOT NULL,
+	PRIMARY KEY (id),
+	UNIQUE INDEX UX_%[1]s_NORMALIZED (normalized)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, table),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	document_id VARCHAR(36) NOT NULL,
+	%[2]s VARCHAR(36) NOT NULL,
+	PRIMARY KEY (document_id, %[2]s),
+	INDEX IX_%[1]s_REF (%[2]s)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, join, ref),
+		},
+		persistence.SQLite: {
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	name VARCHAR(128) NOT NULL,
+	normalized VARCHAR(128) NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS UX_%[1]s_NORMALIZED ON %[1]s (normalized)", table),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	document_id VARCHAR(36) NOT NULL,
+	%[2]s VARCHAR(36) NOT NULL,
+	PRIMARY KEY (document_id, %[2]s)
+)`, join, ref),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS IX_%[1]s_REF ON %[1]s (%[2]s)", join, ref),
+		},
+		persistence.Postgres: {
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(36) NOT NULL PRIMARY KEY,
+	name VARCHAR(128) NOT NULL,
+	normalized VARCHAR(128) NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS UX_%[1]s_NORMALIZED ON %[1]s (normalized)", table),
+			// prefix searches with LIKE need the pattern operators to use an index
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS IX_%[1]s_PREFIX ON %[1]s (normalized varchar_pattern_ops)", table),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (
+	document_id VARCHAR(36) NOT NULL,
+	%[2]s VARCHAR(36) NOT NULL,
+	PRIMARY KEY (document_id, %[2]s)
+)`, join, ref),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS IX_%[1]s_REF ON %[1]s (%[2]s)", join, ref),
+		},
+	}
+}
+
+// merge combines the statements of the given sets in order
+func merge(sets ...persistence.Statements) persistence.Statements {
+	merged := make(persistence.Statements)
+	for _, set := range sets {
+		for d, stmts := range set {
+			merged[d] = append(merged[d], stmts...)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bihe/mydms/internal/persistence"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrateLists(t *testing.T) {
+	c := persistence.NewConn("sqlite3", ":memory:")
+	defer c.Close()
+
+	// create the schema before the normalization of tags and senders
+	m, err := persistence.NewMigrator(c, Migrations[:2])
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	insert := "INSERT INTO DOCUMENTS (id,title,filename,alternativeid,taglist,senderlist,created) VALUES (?,?,?,?,?,?,?)"
+	c.MustExec(insert, "1", "doc1", "doc1.pdf", "a1", "Tax;Invoice", "Office", time.Now().UTC())
+	c.MustExec(insert, "2", "doc2", "doc2.pdf", "a2", "tax ; taxi;TAX", "", time.Now().UTC())
+
+	m, err = persistence.NewMigrator(c, Migrations[:4])
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+
+	var tags []string
+	if err := c.Select(&tags, "SELECT normalized FROM TAGS ORDER BY normalized"); err != nil {
+		t.Fatalf("could not read tags: %v", err)
+	}
+	assert.Equal(t, []string{"invoice", "tax", "taxi"}, tags)
+
+	var count int
+	if err := c.Get(&count, "SELECT count(*) FROM DOCUMENT_TAGS j JOIN TAGS t ON t.id = j.tag_id WHERE t.normalized = 'tax'"); err != nil {
+		t.Fatalf("could not read tags: %v", err)
+	}
+	assert.Equal(t, 2, count)
+	if err := c.Get(&count, "SELECT count(*) FROM DOCUMENT_SENDERS"); err != nil {
+		t.Fatalf("could not read senders: %v", err)
+	}
+	assert.Equal(t, 1, count)
+
+	// the existing documents are added to the full-text index
+	if err := c.Get(&count, "SELECT count(*) FROM SEARCH_INDEX WHERE term = 'taxi'"); err != nil {
+		t.Fatalf("could not read search index: %v", err)
+	}
+	assert.Equal(t, 1, count)
+
+	// revert the full-text index and the normalization
+	reverted, err := m.Down(2)
+	if err != nil {
+		t.Fatalf("could not revert migration: %v", err)
+	}
+	assert.Equal(t, 4, reverted[0].Version)
+	assert.Equal(t, 3, reverted[1].Version)
+}
+
+func TestInitialVersions(t *testing.T) {
+	c := persistence.NewConn("sqlite3", ":memory:")
+	defer c.Close()
+
+	// create the schema before the history of documents
+	m, err := persistence.NewMigrator(c, Migrations[:7])
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	insert := "INSERT INTO DOCUMENTS (id,title,filename,alternativeid,taglist,senderlist,created,modified) VALUES (?,?,?,?,?,?,?,?)"
+	created := time.Now().UTC().Add(-time.Hour)
+	c.MustExec(insert, "1", "doc1", "doc1.pdf", "a1", "", "", created, nil)
+	c.MustExec(insert, "2", "doc2", "doc2.pdf", "a2", "", "", created, time.Now().UTC())
+
+	m, err = persistence.NewMigrator(c, Migrations[:8])
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+
+	// the existing documents are the first version
+	var versions []struct {
+		ID        string    `db:"document_id"`
+		Version   int       `db:"version"`
+		FileName  string    `db:"filename"`
+		Versioned time.Time `db:"versioned"`
+	}
+	if err := c.Select(&versions, "SELECT document_id,version,filename,versioned FROM DOCUMENT_VERSIONS ORDER BY document_id"); err != nil {
+		t.Fatalf("could not read versions: %v", err)
+	}
+	if assert.Equal(t, 2, len(versions)) {
+		assert.Equal(t, 1, versions[0].Version)
+		assert.Equal(t, "doc1.pdf", versions[0].FileName)
+		assert.Equal(t, created.Unix(), versions[0].Versioned.Unix())
+		assert.True(t, versions[1].Versioned.After(created))
+	}
+}
+
+func TestDownRemovesColumns(t *testing.T) {
+	c := persistence.NewConn("sqlite3", ":memory:")
+	defer c.Close()
+
+	m, err := persistence.NewMigrator(c, Migrations)
+	if err != nil {
+		t.Fatalf("could not create migrator: %v", err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	c.MustExec("INSERT INTO DOCUMENTS (id,title,filename,alternativeid,taglist,senderlist,created,content,hash) VALUES (?,?,?,?,?,?,?,?,?)",
+		"1", "doc1", "doc1.pdf", "a1", "", "", time.Now().UTC(), "text", "h1")
+
+	// revert to the schema before the content of the documents was stored
+	if _, err := m.Down(len(Migrations) - 4); err != nil {
+		t.Fatalf("could not revert migration: %v", err)
+	}
+	var title string
+	if err := c.Get(&title, "SELECT title FROM DOCUMENTS WHERE id = '1'"); err != nil {
+		t.Fatalf("could not read document: %v", err)
+	}
+	assert.Equal(t, "doc1", title)
+	for _, q := range []string{"SELECT content FROM DOCUMENTS", "SELECT hash FROM DOCUMENTS", "SELECT deleted FROM DOCUMENTS", "SELECT owner FROM UPLOADS"} {
+		_, err := c.Exec(q)
+		assert.Error(t, err, q)
+	}
+
+	// the columns can be added again
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("could not migrate database: %v", err)
+	}
+	if err := c.Get(&title, "SELECT title FROM DOCUMENTS WHERE id = '1' AND content IS NULL AND hash IS NULL"); err != nil {
+		t.Fatalf("could not read document: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/bihe/mydms/internal/fulltext"
+	"github.com/bihe/mydms/internal/persistence"
+)
+
+// indexDocuments creates the full-text index of the existing documents
+// the fields and weights correspond to the initial definition of the documents repository
+func indexDocuments(a *persistence.Atomic) error {
+	var docs []struct {
+		ID            string         `db:"id"`
+		Title         string         `db:"title"`
+		TagList       string         `db:"taglist"`
+		SenderList    string         `db:"senderlist"`
+		InvoiceNumber sql.NullString `db:"invoicenumber"`
+	}
+	if err := a.Select(&docs, "SELECT id, title, taglist, senderlist, invoicenumber FROM DOCUMENTS"); err != nil {
+		return fmt.Errorf("could not read the documents: %v", err)
+	}
+	for _, d := range docs {
+		fields := []fulltext.Field{
+			{ID: 1, Weight: 4, Text: d.Title},
+			{ID: 4, Weight: 2, Text: d.InvoiceNumber.String},
+		}
+		for _, t := range strings.Split(d.TagList, ";") {
+			fields = append(fields, fulltext.Field{ID: 2, Weight: 3, Text: t})
+		}
+		for _, s := range strings.Split(d.SenderList, ";") {
+			fields = append(fields, fulltext.Field{ID: 3, Weight: 3, Text: s})
+		}
+		if err := fulltext.Update(a, d.ID, fields...); err != nil {
+			return fmt.Errorf("could not index document '%s': %v", d.ID, err)
+		}
+	}
+	return nil
+}
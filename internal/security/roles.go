@@ -0,0 +1,31 @@
+package security
+
+import (
+	"fmt"
+
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// RequireRole returns a middleware which permits the request only for users with the given role
+// the role needs to be one of the roles of the RequiredClaim, the middleware is used after the JWT middleware
+// requests are not permitted if no role is defined
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if role == "" {
+				return errors.ForbiddenError{Err: fmt.Errorf("no role defined for the resource"), Request: c.Request()}
+			}
+			sc, ok := c.(*ServerContext)
+			if !ok {
+				return errors.ForbiddenError{Err: fmt.Errorf("no authenticated user"), Request: c.Request()}
+			}
+			for _, r := range sc.Identity.Roles {
+				if r == role {
+					return next(c)
+				}
+			}
+			return errors.ForbiddenError{Err: fmt.Errorf("the user '%s' lacks the role '%s'", sc.Identity.Username, role), Request: c.Request()}
+		}
+	}
+}
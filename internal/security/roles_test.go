@@ -0,0 +1,35 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bihe/mydms/internal/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	sec "golang.binggl.net/commons/security"
+)
+
+func TestRequireRole(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	next := func(c echo.Context) error {
+		return c.String(http.StatusOK, "test")
+	}
+
+	// no authenticated user
+	_, ok := RequireRole("admin")(next)(c).(errors.ForbiddenError)
+	assert.True(t, ok, "forbidden expected")
+
+	sc := &ServerContext{Context: c, Identity: sec.User{Username: "user", Roles: []string{"user"}}}
+	_, ok = RequireRole("admin")(next)(sc).(errors.ForbiddenError)
+	assert.True(t, ok, "forbidden expected")
+
+	// no role defined
+	_, ok = RequireRole("")(next)(sc).(errors.ForbiddenError)
+	assert.True(t, ok, "forbidden expected")
+
+	sc.Identity.Roles = append(sc.Identity.Roles, "admin")
+	assert.NoError(t, RequireRole("admin")(next)(sc))
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/bihe/mydms/features/appinfo"
 	"github.com/bihe/mydms/features/documents"
 	"github.com/bihe/mydms/features/filestore"
+	"github.com/bihe/mydms/features/ingest"
 	"github.com/bihe/mydms/features/upload"
 	"github.com/bihe/mydms/internal"
 	"github.com/bihe/mydms/internal/config"
 	"github.com/bihe/mydms/internal/persistence"
+	"github.com/bihe/mydms/internal/security"
 	"github.com/labstack/echo/v4"
 )
 
 // registerRoutes defines the routes of the available handlers
-func registerRoutes(e *echo.Echo, con persistence.Connection, config config.AppConfig, version internal.VersionInfo) (err error) {
+// the background workers run until the context is done, wg waits for them to return
+func registerRoutes(ctx context.Context, wg *sync.WaitGroup, e *echo.Echo, con persistence.Connection, config config.AppConfig, version internal.VersionInfo) (err error) {
 	var (
 		ur upload.Repository
 		dr documents.Repository
@@ -41,22 +49,53 @@ func registerRoutes(e *echo.Echo, con persistence.Connection, config config.AppC
 		AllowedFileTypes: config.UP.AllowedFileTypes,
 		MaxUploadSize:    config.UP.MaxUploadSize,
 		UploadPath:       config.UP.UploadPath,
+		ConvertImages:    config.UP.ConvertImages,
+		RejectDuplicates: config.UP.RejectDuplicates,
+	}
+	if uploadConfig.TokenTTL, err = optionalDuration(config.UP.TokenTTL); err != nil {
+		return
 	}
+	if uploadConfig.CleanupInterval, err = optionalDuration(config.UP.CleanupInterval); err != nil {
+		return
+	}
+	upload.NewJanitor(ur, uploadConfig).Start(ctx, wg)
 	uh := upload.NewHandler(ur, uploadConfig)
 	u.POST("/file", uh.UploadFile)
+	u.POST("/files", uh.UploadFiles)
+	u.POST("/merge", uh.MergeUploads)
+	u.GET("", uh.ListUploads)
+	u.GET("/:id", uh.GetUpload)
+	u.GET("/:id/preview", uh.PreviewUpload)
+	u.DELETE("/:id", uh.DeleteUpload)
+	u.OPTIONS("/tus", uh.TusOptions)
+	u.POST("/tus", uh.TusCreate)
+	u.HEAD("/tus/:id", uh.TusStatus)
+	u.PATCH("/tus/:id", uh.TusPatch)
+	u.DELETE("/tus/:id", uh.TusTerminate)
 
 	// file
-	storeSvc := filestore.NewService(filestore.S3Config{
-		Region: config.Store.Region,
-		Bucket: config.Store.Bucket,
-		Key:    config.Store.Key,
-		Secret: config.Store.Secret,
-	})
+	storeSvc, err := newFileService(config.Store)
+	if err != nil {
+		return
+	}
 	f := api.Group("/file")
 	fh := filestore.NewHandler(storeSvc)
 	f.GET("", fh.GetFile)
 	f.GET("/", fh.GetFile)
 
+	// watched folder
+	if config.Ingest.Enabled {
+		if err = startIngest(ctx, wg, config.Ingest, ingest.Repositories{DocRepo: dr, UploadRepo: ur}, storeSvc, uploadConfig); err != nil {
+			return
+		}
+	}
+	// mailbox
+	if config.Mail.Enabled {
+		if err = startMail(ctx, wg, config.Mail, ingest.Repositories{DocRepo: dr, UploadRepo: ur}, storeSvc, uploadConfig); err != nil {
+			return
+		}
+	}
+
 	// documents
 	d := api.Group("/documents")
 	dh := documents.NewHandler(documents.Repositories{
@@ -64,12 +103,126 @@ func registerRoutes(e *echo.Echo, con persistence.Connection, config config.AppC
 		UploadRepo: ur,
 	}, storeSvc, uploadConfig)
 
+	d.GET("/duplicates", dh.GetDuplicates)
+	d.GET("/trash", dh.GetTrash)
+	d.POST("/trash/:id/restore", dh.RestoreDocument)
+	d.DELETE("/trash/:id", dh.PurgeDocument)
 	d.GET("/:type/search", dh.SearchList)
 	d.GET("/:id", dh.GetDocumentByID)
+	d.GET("/:id/preview", dh.GetPreview)
+	d.GET("/:id/versions", dh.GetVersions)
+	d.GET("/:id/versions/:version", dh.GetVersion)
+	d.POST("/:id/versions/:version/restore", dh.RestoreVersion)
 	d.DELETE("/:id", dh.DeleteDocumentByID)
 	d.GET("/search", dh.SearchDocuments)
 	d.POST("", dh.SaveDocument)
 	d.POST("/", dh.SaveDocument)
 
+	// trash
+	tc := documents.TrashConfig{
+		Retention: time.Duration(config.Trash.PurgeAfterDays) * 24 * time.Hour,
+	}
+	if tc.Interval, err = optionalDuration(config.Trash.PurgeInterval); err != nil {
+		return
+	}
+	documents.NewPurger(documents.Repositories{DocRepo: dr, UploadRepo: ur}, storeSvc, tc).Start(ctx, wg)
+
+	// reconciliation of documents and files
+	rc := documents.ReconcileConfig{
+		Enabled: config.Reconcile.Enabled,
+		Fix:     config.Reconcile.Fix,
+	}
+	if rc.Interval, err = optionalDuration(config.Reconcile.Interval); err != nil {
+		return
+	}
+	if rc.GracePeriod, err = optionalDuration(config.Reconcile.GracePeriod); err != nil {
+		return
+	}
+	documents.NewReconciler(documents.Repositories{DocRepo: dr, UploadRepo: ur}, storeSvc, rc).Start(ctx, wg)
+
+	// admin
+	admin := api.Group("/admin", security.RequireRole(config.Sec.AdminRole))
+	admin.GET("/verify", dh.VerifyFiles)
+
 	return
 }
+
+// startIngest watches the configured folder to import files
+func startIngest(ctx context.Context, wg *sync.WaitGroup, c config.IngestConfig, repos ingest.Repositories, fs filestore.FileService, uc upload.Config) (err error) {
+	ic := ingest.Config{
+		Path:        c.Path,
+		ArchivePath: c.ArchivePath,
+		ErrorPath:   c.ErrorPath,
+		Mode:        c.Mode,
+		Owner:       c.Owner,
+	}
+	if ic.Interval, err = optionalDuration(c.Interval); err != nil {
+		return
+	}
+	if ic.SettleTime, err = optionalDuration(c.SettleTime); err != nil {
+		return
+	}
+	w, err := ingest.NewWatcher(ic, repos, fs, uc)
+	if err != nil {
+		return
+	}
+	w.Start(ctx, wg)
+	return
+}
+
+// startMail checks the configured mailbox to import the attachments of mails
+func startMail(ctx context.Context, wg *sync.WaitGroup, c config.MailConfig, repos ingest.Repositories, fs filestore.FileService, uc upload.Config) (err error) {
+	mc := ingest.MailConfig{
+		Address:            c.Address,
+		TLS:                c.TLS,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		User:               c.User,
+		Password:           c.Password,
+		Mailbox:            c.Mailbox,
+		ProcessedMailbox:   c.ProcessedMailbox,
+		ErrorMailbox:       c.ErrorMailbox,
+	}
+	if mc.Interval, err = optionalDuration(c.Interval); err != nil {
+		return
+	}
+	p, err := ingest.NewMailPoller(mc, repos, fs, uc)
+	if err != nil {
+		return
+	}
+	p.Start(ctx, wg)
+	return
+}
+
+// optionalDuration parses the given duration, an empty value is returned as zero
+func optionalDuration(d string) (time.Duration, error) {
+	if d == "" {
+		return 0, nil
+	}
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s': %v", d, err)
+	}
+	return v, nil
+}
+
+// newFileService creates the backend file store defined by the configuration
+func newFileService(c config.FileStore) (filestore.FileService, error) {
+	switch c.Backend {
+	case "", filestore.S3Backend:
+		return filestore.NewService(filestore.S3Config{
+			Region: c.Region,
+			Bucket: c.Bucket,
+			Key:    c.Key,
+			Secret: c.Secret,
+
+			Endpoint:           c.Endpoint,
+			PathStyle:          c.PathStyle,
+			InsecureSkipVerify: c.InsecureSkipVerify,
+		}), nil
+	case filestore.LocalBackend:
+		return filestore.NewLocalService(filestore.LocalConfig{
+			RootPath: c.LocalPath,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown filestore backend '%s'", c.Backend)
+}
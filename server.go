@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
+	"github.com/bihe/mydms/features/upload"
 	"github.com/bihe/mydms/internal"
 	"github.com/bihe/mydms/internal/config"
 	"github.com/bihe/mydms/internal/errors"
@@ -16,6 +18,8 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 
 	_ "github.com/bihe/mydms/docs"
 	echoSwagger "github.com/swaggo/echo-swagger"
@@ -45,7 +49,18 @@ type ServerArgs struct {
 // @license.url https://raw.githubusercontent.com/bihe/mydms-go/master/LICENSE
 
 func main() {
-	api, addr := setupAPIServer()
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// the background workers are stopped before the server is shut down
+	workers, stop := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	api, addr := setupAPIServer(workers, &wg)
 
 	// Start server
 	go func() {
@@ -60,9 +75,12 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
+	stop()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := api.Shutdown(ctx); err != nil {
+	err := api.Shutdown(ctx)
+	wg.Wait()
+	if err != nil {
 		api.Logger.Fatal(err)
 	}
 }
@@ -90,7 +108,7 @@ func configFromFile(configFileName string) config.AppConfig {
 	return *c
 }
 
-func setupAPIServer() (*echo.Echo, string) {
+func setupAPIServer(ctx context.Context, wg *sync.WaitGroup) (*echo.Echo, string) {
 	args := parseFlags()
 	c := configFromFile(args.ConfigFile)
 
@@ -108,6 +126,7 @@ func setupAPIServer() (*echo.Echo, string) {
 		AllowMethods:     c.Cors.AllowedMethods,
 		AllowCredentials: c.Cors.AllowCredentials,
 		MaxAge:           c.Cors.MaxAge,
+		ExposeHeaders:    upload.TusHeaders,
 	}))
 
 	e.Use(middleware.Secure())
@@ -125,12 +144,17 @@ func setupAPIServer() (*echo.Echo, string) {
 	}))
 
 	// persistence store && application version
-	con := persistence.NewConn(c.DB.ConnStr)
+	con := persistence.NewConn(c.DB.Driver, c.DB.ConnStr)
+	if c.DB.Migrate {
+		if err := migrateDatabase(con); err != nil {
+			panic(fmt.Sprintf("error: %v", err))
+		}
+	}
 	version := internal.VersionInfo{
 		Version: Version,
 		Build:   Build,
 	}
-	if err := registerRoutes(e, con, c, version); err != nil {
+	if err := registerRoutes(ctx, wg, e, con, c, version); err != nil {
 		panic(fmt.Sprintf("error: %v", err))
 	}
 